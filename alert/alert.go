@@ -0,0 +1,236 @@
+// Package alert watches the Vochain through the gateway and notifies webhooks when the chain
+// halts, the gateway node falls back to syncing or the gateway turns unhealthy, and again
+// once the problem is over.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"go.vocdoni.io/dvote/log"
+)
+
+const (
+	// CheckInterval is the time between two checks of the chain and the gateway
+	CheckInterval = 10 * time.Second
+	// defaultBlockTime is the block time assumed while the gateway reports none
+	defaultBlockTime = 10 * time.Second
+)
+
+// Conditions watched
+const (
+	// ChainHalted fires when no block is produced within HaltFactor times the average block time
+	ChainHalted = "chainHalted"
+	// GatewaySyncing fires while the gateway node is syncing the chain
+	GatewaySyncing = "gatewaySyncing"
+	// GatewayUnhealthy fires while the gateway is unreachable, reports no health or lacks
+	// the APIs the explorer needs
+	GatewayUnhealthy = "gatewayUnhealthy"
+)
+
+// Alert statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert is a condition starting or ceasing to hold
+type Alert struct {
+	Condition string `json:"condition"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	Gateway   string `json:"gateway"`
+	Height    uint32 `json:"height"`
+	// Since is when the condition started to hold
+	Since time.Time `json:"since"`
+	Time  time.Time `json:"time"`
+}
+
+// Source is the gateway data the watcher checks
+type Source interface {
+	GetGatewayInfo() error
+	GetBlockStatus() (*[5]int32, *uint32, int32, error)
+	GetStats() (*client.VochainStats, error)
+	Address() string
+}
+
+// Notifier delivers alerts
+type Notifier interface {
+	Notify(ctx context.Context, a *Alert) error
+}
+
+// Config sets when the watcher alerts
+type Config struct {
+	// HaltFactor is the number of average block times without a new block after which the
+	// chain is considered halted
+	HaltFactor int
+	// Debounce is the time a condition must hold before alerting, and must be over before
+	// notifying the recovery, so a single slow check doesn't fire alerts
+	Debounce time.Duration
+}
+
+// condition tracks a watched condition across checks
+type condition struct {
+	// holds is the state of the condition at the last check, and changed when it last changed
+	holds   bool
+	changed time.Time
+	// firing is true once an alert has been sent and until its recovery is, and since
+	// is when the condition started to hold for the alert sent
+	firing  bool
+	since   time.Time
+	message string
+}
+
+// Watcher checks the chain and the gateway every CheckInterval and notifies the changes
+type Watcher struct {
+	src       Source
+	notifiers []Notifier
+	cfg       Config
+
+	conditions map[string]*condition
+	// height is the latest height seen, and heightChanged when it was first seen
+	height        uint32
+	heightChanged time.Time
+}
+
+// NewWatcher returns a watcher checking src and notifying every notifier. Call Run to start it.
+func NewWatcher(src Source, cfg Config, notifiers ...Notifier) *Watcher {
+	if cfg.HaltFactor <= 0 {
+		cfg.HaltFactor = 1
+	}
+	return &Watcher{
+		src:       src,
+		notifiers: notifiers,
+		cfg:       cfg,
+		conditions: map[string]*condition{
+			ChainHalted:      {},
+			GatewaySyncing:   {},
+			GatewayUnhealthy: {},
+		},
+	}
+}
+
+// Run watches the chain until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+	for {
+		w.check(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check evaluates every condition and notifies the ones which changed for longer than Debounce
+func (w *Watcher) check(ctx context.Context, now time.Time) {
+	if err := w.src.GetGatewayInfo(); err != nil {
+		w.set(GatewayUnhealthy, true, err.Error(), now)
+	} else {
+		w.set(GatewayUnhealthy, false, "", now)
+	}
+
+	// Stats and block status can't be trusted from an unhealthy gateway, so the other
+	// conditions keep their state until it's back
+	if !w.conditions[GatewayUnhealthy].holds {
+		if stats, err := w.src.GetStats(); err != nil {
+			log.Debugf("alert: cannot get stats: %v", err)
+		} else {
+			w.set(GatewaySyncing, stats.Syncing, "gateway node is syncing the chain", now)
+		}
+		if halted, msg, err := w.checkHalt(now); err != nil {
+			log.Debugf("alert: cannot get block status: %v", err)
+		} else {
+			w.set(ChainHalted, halted, msg, now)
+		}
+	}
+
+	for _, name := range []string{GatewayUnhealthy, GatewaySyncing, ChainHalted} {
+		c := w.conditions[name]
+		if c.holds == c.firing || now.Sub(c.changed) < w.cfg.Debounce {
+			continue
+		}
+		c.firing = c.holds
+		a := &Alert{
+			Condition: name,
+			Status:    StatusFiring,
+			Message:   c.message,
+			Gateway:   w.src.Address(),
+			Height:    w.height,
+			Since:     c.since,
+			Time:      now,
+		}
+		if c.firing {
+			c.since = c.changed
+			a.Since = c.since
+		} else {
+			a.Status = StatusResolved
+			a.Message = fmt.Sprintf("recovered after %s: %s", c.changed.Sub(c.since).Round(time.Second), c.message)
+		}
+		w.notify(ctx, a)
+	}
+}
+
+// checkHalt returns true if the height hasn't changed within HaltFactor average block times
+func (w *Watcher) checkHalt(now time.Time) (bool, string, error) {
+	blockTimes, height, timestamp, err := w.src.GetBlockStatus()
+	if err != nil {
+		return false, "", err
+	}
+	if height == nil {
+		return false, "", fmt.Errorf("no height reported")
+	}
+	if *height != w.height {
+		w.height = *height
+		w.heightChanged = now
+		// Start from the latest block time, so a chain already halted at startup is detected
+		if last := time.Unix(int64(timestamp), 0); timestamp > 0 && last.Before(now) {
+			w.heightChanged = last
+		}
+	}
+	blockTime := defaultBlockTime
+	if blockTimes != nil {
+		for _, bt := range blockTimes {
+			if bt > 0 {
+				blockTime = time.Duration(bt) * time.Millisecond
+				break
+			}
+		}
+	}
+	stalled := now.Sub(w.heightChanged)
+	if stalled <= time.Duration(w.cfg.HaltFactor)*blockTime {
+		return false, "", nil
+	}
+	return true, fmt.Sprintf("no new block since height %d, %s ago (average block time %s)",
+		w.height, stalled.Round(time.Second), blockTime.Round(time.Millisecond)), nil
+}
+
+// set records the state of a condition. The message of a holding condition is kept
+// from when it started, so the alert describes its cause.
+func (w *Watcher) set(name string, holds bool, message string, now time.Time) {
+	c := w.conditions[name]
+	if holds != c.holds {
+		c.holds = holds
+		c.changed = now
+		if holds {
+			c.message = message
+		}
+	}
+	if holds && name == ChainHalted {
+		// The halt message reports for how long, so keep it current
+		c.message = message
+	}
+}
+
+func (w *Watcher) notify(ctx context.Context, a *Alert) {
+	log.Infof("alert %s %s: %s", a.Condition, a.Status, a.Message)
+	for _, n := range w.notifiers {
+		if err := n.Notify(ctx, a); err != nil {
+			log.Warnf("cannot notify alert %s: %v", a.Condition, err)
+		}
+	}
+}
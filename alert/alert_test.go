@@ -0,0 +1,98 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/mockgateway"
+)
+
+// state is the gateway at a check: down, syncing, or serving the chain up to height
+type state struct {
+	down    bool
+	syncing bool
+	height  uint32
+}
+
+// recorder keeps the alerts notified as "<condition> <status> at <seconds>"
+type recorder struct {
+	start  time.Time
+	alerts []string
+}
+
+func (r *recorder) Notify(ctx context.Context, a *Alert) error {
+	r.alerts = append(r.alerts, fmt.Sprintf("%s %s at %d", a.Condition, a.Status, int(a.Time.Sub(r.start).Seconds())))
+	return nil
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	up := func(height uint32) state { return state{height: height} }
+	down := state{down: true}
+	syncing := func(height uint32) state { return state{syncing: true, height: height} }
+	for _, tc := range []struct {
+		name string
+		// checks are the states reported at each check, one every 10 seconds
+		checks []state
+		alerts []string
+	}{
+		{
+			name:   "single failed check",
+			checks: []state{up(1), down, up(2), up(3), up(4), up(5)},
+		},
+		{
+			name:   "unhealthy fires and resolves",
+			checks: []state{up(1), down, down, down, down, up(2), up(3), up(4), up(5)},
+			alerts: []string{"gatewayUnhealthy firing at 40", "gatewayUnhealthy resolved at 80"},
+		},
+		{
+			name:   "recovered before resolving",
+			checks: []state{up(1), down, down, down, down, up(2), down, down},
+			alerts: []string{"gatewayUnhealthy firing at 40"},
+		},
+		{
+			name:   "syncing",
+			checks: []state{syncing(1), syncing(2), syncing(3), syncing(4), syncing(5), up(6), up(7), up(8), up(9)},
+			alerts: []string{"gatewaySyncing firing at 30", "gatewaySyncing resolved at 80"},
+		},
+		{
+			name:   "halted",
+			checks: []state{up(5), up(5), up(5), up(5), up(5), up(5), up(5), up(6), up(7), up(8), up(9)},
+			alerts: []string{"chainHalted firing at 60", "chainHalted resolved at 100"},
+		},
+		{
+			name:   "unhealthy gateway holds the height",
+			checks: []state{up(5), down, down, down, down, down, down, down},
+			alerts: []string{"gatewayUnhealthy firing at 40"},
+		},
+	} {
+		gw, cli := mockgateway.Start(t, nil)
+		gw.Update(func(f *mockgateway.Fixtures) {
+			f.Blocks = nil
+			f.BlockTime = [5]int32{}
+		})
+		rec := &recorder{start: time.Unix(1600000000, 0)}
+		// Halted after 2 default block times without blocks, notified after 30s
+		w := NewWatcher(cli, Config{HaltFactor: 2, Debounce: 30 * time.Second}, rec)
+		for i, st := range tc.checks {
+			now := rec.start.Add(time.Duration(i) * CheckInterval)
+			// The blocks up to the height of the state are committed by now
+			gw.Update(func(f *mockgateway.Fixtures) {
+				f.Health = 100
+				if st.down {
+					f.Health = 0
+				}
+				f.Syncing = st.syncing
+				for f.Height() <= st.height {
+					f.AddBlock().Timestamp = now
+				}
+			})
+			w.check(context.Background(), now)
+		}
+		if !reflect.DeepEqual(rec.alerts, tc.alerts) {
+			t.Errorf("%s: got alerts %q, want %q", tc.name, rec.alerts, tc.alerts)
+		}
+	}
+}
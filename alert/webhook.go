@@ -0,0 +1,117 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds the delivery of an alert to a webhook
+const webhookTimeout = 10 * time.Second
+
+// Webhook payload formats
+const (
+	// FormatJSON posts the Alert as is
+	FormatJSON = "json"
+	// FormatSlack posts a Slack incoming webhook message
+	FormatSlack = "slack"
+	// FormatMatrix sends an m.room.message event. Client-Server API send URLs, with a path
+	// ending in /send/m.room.message, get a transaction id appended and are sent with PUT;
+	// any other URL, as the ones of webhook bridges, is posted the event content.
+	FormatMatrix = "matrix"
+)
+
+// Webhook is a Notifier sending alerts to an URL
+type Webhook struct {
+	URL    string
+	Format string
+	http   *http.Client
+}
+
+// NewWebhook returns a webhook sending alerts to url in the given format
+func NewWebhook(format, url string) (*Webhook, error) {
+	switch format {
+	case FormatJSON, FormatSlack, FormatMatrix:
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q", format)
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("webhook url is not http nor https: %s", url)
+	}
+	return &Webhook{URL: url, Format: format, http: &http.Client{Timeout: webhookTimeout}}, nil
+}
+
+// ParseWebhook parses a webhook given as <format>=<url>, or as a bare url for FormatJSON
+func ParseWebhook(s string) (*Webhook, error) {
+	if parts := strings.SplitN(s, "=", 2); len(parts) == 2 && !strings.Contains(parts[0], "/") {
+		return NewWebhook(parts[0], parts[1])
+	}
+	return NewWebhook(FormatJSON, s)
+}
+
+// Notify implements Notifier
+func (h *Webhook) Notify(ctx context.Context, a *Alert) error {
+	method, url := http.MethodPost, h.URL
+	var payload interface{}
+	switch h.Format {
+	case FormatSlack:
+		title, details := describe(a)
+		payload = map[string]string{"text": "*" + title + "* " + details}
+	case FormatMatrix:
+		title, details := describe(a)
+		payload = map[string]string{
+			"msgtype":        "m.notice",
+			"body":           title + " " + details,
+			"format":         "org.matrix.custom.html",
+			"formatted_body": "<b>" + html.EscapeString(title) + "</b> " + html.EscapeString(details),
+		}
+		if u, err := neturl.Parse(url); err == nil && strings.HasSuffix(u.Path, "/send/m.room.message") {
+			method = http.MethodPut
+			u.Path += "/" + strconv.FormatInt(a.Time.UnixNano(), 10)
+			url = u.String()
+		}
+	default:
+		payload = a
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", h.Format, resp.Status)
+	}
+	return nil
+}
+
+// titles are the human readable alert titles, by condition
+var titles = map[string]string{
+	ChainHalted:      "Vochain halted",
+	GatewaySyncing:   "Gateway syncing",
+	GatewayUnhealthy: "Gateway unhealthy",
+}
+
+// describe returns the title and the details of a chat message for an alert
+func describe(a *Alert) (title, details string) {
+	title = titles[a.Condition]
+	if a.Status == StatusResolved {
+		title += " resolved"
+	}
+	return title, fmt.Sprintf("at height %d on %s: %s", a.Height, a.Gateway, a.Message)
+}
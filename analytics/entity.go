@@ -0,0 +1,137 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/util"
+)
+
+// processPageSize is the number of process ids requested per getProcessList call
+const processPageSize = 64
+
+// participationBuckets is the number of block ranges the participation of an entity is split in
+const participationBuckets = 12
+
+// EntitySource is the subset of the gateway client needed to compute the analytics of an entity
+type EntitySource interface {
+	GetProcessList(entityId []byte, searchTerm string, namespace uint32, status string, withResults bool, srcNetId string, from, listSize int) ([]string, error)
+	GetProcessSummary(pid []byte) (*client.ProcessSummary, error)
+	GetEnvelopeHeight(pid []byte) (uint32, error)
+}
+
+// EntityStats summarizes the activity of an entity across all its processes
+type EntityStats struct {
+	EntityID  string `json:"entityId"`
+	Processes int    `json:"processes"`
+	// ByState is the number of processes in each state
+	ByState   map[string]int `json:"byState"`
+	Envelopes uint64         `json:"envelopes"`
+	// FirstActivityBlock is the start block of the first process, and LastActivityBlock
+	// the end block of the latest ending one
+	FirstActivityBlock uint32 `json:"firstActivityBlock"`
+	LastActivityBlock  uint32 `json:"lastActivityBlock"`
+	// Timeline lists the processes by start block
+	Timeline []ProcessActivity `json:"timeline"`
+	// Participation splits the blocks from the first to the last process start in ranges,
+	// adding up the processes started and the envelopes they received in each range
+	Participation []Bucket `json:"participation"`
+}
+
+// ProcessActivity is a process in the timeline of an entity
+type ProcessActivity struct {
+	ProcessID  string `json:"processId"`
+	State      string `json:"state"`
+	StartBlock uint32 `json:"startBlock"`
+	EndBlock   uint32 `json:"endBlock"`
+	Envelopes  uint32 `json:"envelopes"`
+}
+
+// Bucket is the activity of an entity in the blocks from FromBlock to ToBlock, both included
+type Bucket struct {
+	FromBlock uint32 `json:"fromBlock"`
+	ToBlock   uint32 `json:"toBlock"`
+	Processes int    `json:"processes"`
+	Envelopes uint64 `json:"envelopes"`
+}
+
+// Entity walks every process of entity eid and computes its stats, unless ctx is done first
+func Entity(ctx context.Context, src EntitySource, eid []byte) (*EntityStats, error) {
+	var pids []string
+	for from := 0; ; from += processPageSize {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		list, err := src.GetProcessList(eid, "", 0, "", false, "", from, processPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get process list: %v", err)
+		}
+		pids = append(pids, list...)
+		if len(list) < processPageSize {
+			break
+		}
+	}
+
+	stats := &EntityStats{
+		EntityID: util.HexToString(eid),
+		ByState:  make(map[string]int),
+		Timeline: make([]ProcessActivity, 0, len(pids)),
+	}
+	for _, pid := range pids {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		summary, err := src.GetProcessSummary(util.StringToHex(pid))
+		if err != nil {
+			return nil, fmt.Errorf("cannot get process %s summary: %v", pid, err)
+		}
+		var envelopes uint32
+		if summary.EnvelopeHeight != nil {
+			envelopes = *summary.EnvelopeHeight
+		} else if envelopes, err = src.GetEnvelopeHeight(util.StringToHex(pid)); err != nil {
+			return nil, fmt.Errorf("cannot get process %s envelope count: %v", pid, err)
+		}
+		stats.Timeline = append(stats.Timeline, ProcessActivity{
+			ProcessID:  util.TrimHex(pid),
+			State:      summary.State,
+			StartBlock: summary.StartBlock,
+			EndBlock:   summary.StartBlock + summary.BlockCount,
+			Envelopes:  envelopes,
+		})
+	}
+	stats.compute()
+	return stats, nil
+}
+
+// compute derives every stat from the timeline
+func (s *EntityStats) compute() {
+	sort.SliceStable(s.Timeline, func(i, j int) bool {
+		return s.Timeline[i].StartBlock < s.Timeline[j].StartBlock
+	})
+	s.Processes = len(s.Timeline)
+	if s.Processes == 0 {
+		return
+	}
+	s.FirstActivityBlock = s.Timeline[0].StartBlock
+	for _, p := range s.Timeline {
+		s.ByState[p.State]++
+		s.Envelopes += uint64(p.Envelopes)
+		if p.EndBlock > s.LastActivityBlock {
+			s.LastActivityBlock = p.EndBlock
+		}
+	}
+
+	// Processes are assigned to the range their start block falls in
+	lastStart := s.Timeline[len(s.Timeline)-1].StartBlock
+	size := (lastStart - s.FirstActivityBlock + participationBuckets) / participationBuckets
+	for from := s.FirstActivityBlock; from <= lastStart; from += size {
+		s.Participation = append(s.Participation, Bucket{FromBlock: from, ToBlock: from + size - 1})
+	}
+	for _, p := range s.Timeline {
+		b := &s.Participation[(p.StartBlock-s.FirstActivityBlock)/size]
+		b.Processes++
+		b.Envelopes += uint64(p.Envelopes)
+	}
+}
@@ -0,0 +1,209 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+const (
+	// blockPageSize is the number of blocks requested per getBlockList call
+	blockPageSize = 64
+	// DefaultValidatorWindow is the number of latest blocks the validator stats are computed over
+	DefaultValidatorWindow = 1000
+	// MaxValidatorWindow is the largest window of the validator stats
+	MaxValidatorWindow = 10000
+	// proposalHistorySize is the number of proposed blocks listed per validator
+	proposalHistorySize = 50
+)
+
+// ValidatorWindows are the only windows the validator stats are computed over, so that
+// a report is walked and cached for a few of them at most
+var ValidatorWindows = []int{100, DefaultValidatorWindow, MaxValidatorWindow}
+
+// ValidWindow returns an error unless the validator stats can be computed over window
+func ValidWindow(window int) error {
+	for _, w := range ValidatorWindows {
+		if w == window {
+			return nil
+		}
+	}
+	return fmt.Errorf("window must be one of %v blocks", ValidatorWindows)
+}
+
+// ValidatorSource is the subset of the gateway client needed to compute the validator stats
+type ValidatorSource interface {
+	GetValidatorList() ([]*models.Validator, error)
+	GetBlockStatus() (*[5]int32, *uint32, int32, error)
+	GetBlockList(from, listSize int) ([]*indexertypes.BlockMetadata, error)
+}
+
+// ValidatorReport holds the block proposal stats of every validator over a window of blocks
+type ValidatorReport struct {
+	// FromBlock and ToBlock are the first and last blocks of the window, both included
+	FromBlock uint32 `json:"fromBlock"`
+	ToBlock   uint32 `json:"toBlock"`
+	// Blocks is the number of blocks walked, which may be less than the window on a young chain
+	Blocks int `json:"blocks"`
+	// Validators are sorted by proposed blocks, most first
+	Validators []*ValidatorStats `json:"validators"`
+}
+
+// ValidatorStats are the block proposals of a validator within the window of a report
+type ValidatorStats struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	Power   uint64 `json:"power"`
+	// Active is false for proposers which aren't validators anymore
+	Active   bool `json:"active"`
+	Proposed int  `json:"proposed"`
+	// Share is the fraction of the blocks proposed, and ExpectedShare the fraction of the
+	// voting power, which proposals follow on a healthy chain
+	Share         float64 `json:"share"`
+	ExpectedShare float64 `json:"expectedShare"`
+	// LastProposed is the height of the latest block proposed, 0 if none within the window
+	LastProposed uint32 `json:"lastProposed"`
+	// EstimatedMissedStreak estimates the proposal turns missed since the last block proposed,
+	// or since the window start, and EstimatedLongestMissedStreak the longest run of them
+	// within the window. Blocks don't record the rounds their proposers failed, so the turns
+	// are estimated as the blocks proposed by others times the expected share.
+	EstimatedMissedStreak        int `json:"estimatedMissedStreak"`
+	EstimatedLongestMissedStreak int `json:"estimatedLongestMissedStreak"`
+	// History lists the heights of the latest blocks proposed, newest first
+	History []uint32 `json:"history,omitempty"`
+}
+
+// Find returns the stats of the validator with the given address, or nil
+func (r *ValidatorReport) Find(address []byte) *ValidatorStats {
+	addr := util.HexToString(address)
+	for _, v := range r.Validators {
+		if v.Address == addr {
+			return v
+		}
+	}
+	return nil
+}
+
+// Validators walks the latest window blocks and computes the proposal stats of every
+// validator, and of any former one which proposed some of them, unless ctx is done first
+func Validators(ctx context.Context, src ValidatorSource, window int) (*ValidatorReport, error) {
+	if err := ValidWindow(window); err != nil {
+		return nil, err
+	}
+	list, err := src.GetValidatorList()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get validator list: %v", err)
+	}
+	_, height, _, err := src.GetBlockStatus()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get block status: %v", err)
+	}
+	if height == nil || *height < 2 {
+		return &ValidatorReport{Validators: []*ValidatorStats{}}, nil
+	}
+
+	// The block at height is still being built
+	report := &ValidatorReport{ToBlock: *height - 1, FromBlock: 1}
+	if int(report.ToBlock) > window {
+		report.FromBlock = report.ToBlock - uint32(window) + 1
+	}
+	var totalPower uint64
+	for _, v := range list {
+		totalPower += v.Power
+	}
+	byAddress := make(map[string]*ValidatorStats)
+	for _, v := range list {
+		stats := &ValidatorStats{
+			Address: util.HexToString(v.Address),
+			Name:    v.Name,
+			Power:   v.Power,
+			Active:  true,
+		}
+		if totalPower > 0 {
+			stats.ExpectedShare = float64(v.Power) / float64(totalPower)
+		}
+		byAddress[stats.Address] = stats
+		report.Validators = append(report.Validators, stats)
+	}
+
+	for from := report.FromBlock; from <= report.ToBlock; from += blockPageSize {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		size := util.Min(blockPageSize, int(report.ToBlock-from)+1)
+		blocks, err := src.GetBlockList(int(from), size)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get block list: %v", err)
+		}
+		for _, block := range blocks {
+			if block == nil || block.Height < report.FromBlock || block.Height > report.ToBlock {
+				continue
+			}
+			report.Blocks++
+			addr := util.HexToString(block.ProposerAddress)
+			stats, ok := byAddress[addr]
+			if !ok {
+				stats = &ValidatorStats{Address: addr}
+				byAddress[addr] = stats
+				report.Validators = append(report.Validators, stats)
+			}
+			stats.propose(block.Height, report.FromBlock)
+		}
+	}
+
+	for _, stats := range report.Validators {
+		if report.Blocks > 0 {
+			stats.Share = float64(stats.Proposed) / float64(report.Blocks)
+		}
+		last := stats.LastProposed
+		if last == 0 {
+			last = report.FromBlock - 1
+		}
+		stats.EstimatedMissedStreak = stats.missed(report.ToBlock - last)
+		if stats.EstimatedMissedStreak > stats.EstimatedLongestMissedStreak {
+			stats.EstimatedLongestMissedStreak = stats.EstimatedMissedStreak
+		}
+		// Blocks are walked oldest first
+		for i, j := 0, len(stats.History)-1; i < j; i, j = i+1, j-1 {
+			stats.History[i], stats.History[j] = stats.History[j], stats.History[i]
+		}
+	}
+	sort.SliceStable(report.Validators, func(i, j int) bool {
+		a, b := report.Validators[i], report.Validators[j]
+		if a.Proposed != b.Proposed {
+			return a.Proposed > b.Proposed
+		}
+		if a.Power != b.Power {
+			return a.Power > b.Power
+		}
+		return a.Address < b.Address
+	})
+	return report, nil
+}
+
+// propose records a block proposed at height, in a window starting at windowStart
+func (s *ValidatorStats) propose(height, windowStart uint32) {
+	last := s.LastProposed
+	if last == 0 {
+		last = windowStart - 1
+	}
+	if missed := s.missed(height - last - 1); missed > s.EstimatedLongestMissedStreak {
+		s.EstimatedLongestMissedStreak = missed
+	}
+	s.Proposed++
+	s.LastProposed = height
+	s.History = append(s.History, height)
+	if len(s.History) > proposalHistorySize {
+		s.History = s.History[1:]
+	}
+}
+
+// missed estimates the proposal turns the validator missed within a run of blocks proposed
+// by others, as the turns expected from its share of the voting power
+func (s *ValidatorStats) missed(blocks uint32) int {
+	return int(float64(blocks) * s.ExpectedShare)
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -9,6 +10,33 @@ import (
 	"go.vocdoni.io/proto/build/go/models"
 )
 
+// ErrNotFound is matched by the errors of the requests for objects the gateway doesn't
+// know, such as unknown blocks, transactions, processes or envelopes
+var ErrNotFound = errors.New("not found")
+
+// gatewayError is a request the gateway answered as failed, with its message
+type gatewayError struct {
+	message string
+}
+
+func (e *gatewayError) Error() string {
+	return e.message
+}
+
+// Is matches ErrNotFound when the gateway answered it doesn't know the object requested
+func (e *gatewayError) Is(target error) bool {
+	if target != ErrNotFound {
+		return false
+	}
+	msg := strings.ToLower(e.message)
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "does not exist")
+}
+
+// responseError returns the error of a response the gateway answered as failed
+func responseError(resp *APIresponse) error {
+	return &gatewayError{message: resp.Message}
+}
+
 func (c *Client) GetGatewayInfo() error {
 	var req APIrequest
 	req.Method = "getInfo"
@@ -16,22 +44,49 @@ func (c *Client) GetGatewayInfo() error {
 	if err != nil {
 		return err
 	}
+	if signer := c.UntrustedSigner(); signer != "" {
+		return fmt.Errorf("gateway %s responses are signed by untrusted key %s", c.Address(), signer)
+	}
+	return checkGatewayInfo(c.Address(), resp)
+}
+
+// checkGatewayInfo returns an error if a getInfo response reports the gateway at addr as unhealthy
+// or without the APIs needed by the explorer
+func checkGatewayInfo(addr string, resp *APIresponse) error {
 	if !resp.Ok {
-		return fmt.Errorf(resp.Message)
+		return responseError(resp)
 	}
 	if resp.Health <= 0 {
-		return fmt.Errorf("gateway %s health is %d", c.Address, resp.Health)
+		return fmt.Errorf("gateway %s health is %d", addr, resp.Health)
 	}
 	apiList := strings.Join(resp.APIList, "")
 	if !strings.Contains(apiList, "vote") {
-		return fmt.Errorf("gateway %s does not enable vote api", c.Address)
+		return fmt.Errorf("gateway %s does not enable vote api", addr)
 	}
 	if !strings.Contains(apiList, "indexer") {
-		return fmt.Errorf("gateway %s does not enable indexer api", c.Address)
+		return fmt.Errorf("gateway %s does not enable indexer api", addr)
 	}
 	return nil
 }
 
+// GetGatewayStatus returns the health and enabled APIs reported by the gateway in use
+func (c *Client) GetGatewayStatus() (*GatewayStatus, error) {
+	var req APIrequest
+	req.Method = "getInfo"
+	resp, err := c.Request(req)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Ok {
+		return nil, responseError(resp)
+	}
+	return &GatewayStatus{
+		Address: c.Address(),
+		Health:  resp.Health,
+		APIs:    resp.APIList,
+	}, nil
+}
+
 func (c *Client) GetStats() (*VochainStats, error) {
 	var req APIrequest
 	req.Method = "getStats"
@@ -40,7 +95,7 @@ func (c *Client) GetStats() (*VochainStats, error) {
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf(resp.Message)
+		return nil, responseError(resp)
 	}
 	return resp.Stats, nil
 }
@@ -54,7 +109,7 @@ func (c *Client) GetEnvelopeHeight(pid []byte) (uint32, error) {
 		return 0, err
 	}
 	if !resp.Ok {
-		return 0, fmt.Errorf(resp.Message)
+		return 0, responseError(resp)
 	}
 	return *resp.Height, nil
 }
@@ -67,7 +122,7 @@ func (c *Client) GetBlockStatus() (*[5]int32, *uint32, int32, error) {
 		return nil, nil, 0, err
 	}
 	if !resp.Ok {
-		return nil, nil, 0, fmt.Errorf(resp.Message)
+		return nil, nil, 0, responseError(resp)
 	}
 	return resp.BlockTime, resp.Height, resp.BlockTimestamp, nil
 }
@@ -88,7 +143,7 @@ func (c *Client) GetProcessList(entityId []byte, searchTerm string, namespace ui
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get process list: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get process list: (%w)", responseError(resp))
 	}
 	if resp.Message == "no results yet" {
 		return nil, nil
@@ -105,7 +160,7 @@ func (c *Client) GetProcess(pid []byte) (*indexertypes.Process, error) {
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf(resp.Message)
+		return nil, responseError(resp)
 	}
 	return resp.Process, nil
 }
@@ -119,7 +174,7 @@ func (c *Client) GetProcessSummary(pid []byte) (*ProcessSummary, error) {
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf(resp.Message)
+		return nil, responseError(resp)
 	}
 	// Remove need to null-check envelope height
 	if resp.ProcessSummary != nil {
@@ -139,7 +194,7 @@ func (c *Client) GetProcessKeys(pid []byte) ([]Key, []Key, error) {
 		return nil, nil, err
 	}
 	if !resp.Ok {
-		return nil, nil, fmt.Errorf(resp.Message)
+		return nil, nil, responseError(resp)
 	}
 	return resp.EncryptionPublicKeys, resp.EncryptionPrivKeys, nil
 }
@@ -153,7 +208,7 @@ func (c *Client) GetProcessCount(entityId []byte) (int64, error) {
 		return 0, err
 	}
 	if !resp.Ok {
-		return 0, fmt.Errorf(resp.Message)
+		return 0, responseError(resp)
 	}
 	return *resp.Size, nil
 }
@@ -167,7 +222,7 @@ func (c *Client) GetResults(pid []byte) ([][]string, string, string, bool, error
 		return nil, "", "", false, err
 	}
 	if !resp.Ok {
-		return nil, "", "", false, fmt.Errorf("cannot get results: (%s)", resp.Message)
+		return nil, "", "", false, fmt.Errorf("cannot get results: (%w)", responseError(resp))
 	}
 	if resp.Message == "no results yet" {
 		return nil, resp.State, resp.Type, false, nil
@@ -188,7 +243,7 @@ func (c *Client) GetEntityList(searchTerm string, listSize, from int) ([]string,
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get entity list: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get entity list: (%w)", responseError(resp))
 	}
 	return resp.EntityIDs, nil
 }
@@ -201,7 +256,7 @@ func (c *Client) GetEntityCount() (int64, error) {
 		return 0, err
 	}
 	if !resp.Ok {
-		return 0, fmt.Errorf("cannot get entity count: (%s)", resp.Message)
+		return 0, fmt.Errorf("cannot get entity count: (%w)", responseError(resp))
 	}
 	return *resp.Size, nil
 }
@@ -214,7 +269,7 @@ func (c *Client) GetValidatorList() ([]*models.Validator, error) {
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get validator list: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get validator list: (%w)", responseError(resp))
 	}
 	return resp.ValidatorList, nil
 }
@@ -228,7 +283,7 @@ func (c *Client) GetEnvelope(nullifier []byte) (*indexertypes.EnvelopePackage, e
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get envelope: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get envelope: (%w)", responseError(resp))
 	}
 	resp.Envelope.Meta.Nullifier = nullifier
 	return resp.Envelope, nil
@@ -246,7 +301,7 @@ func (c *Client) GetEnvelopeList(pid []byte, from, listSize int, searchTerm stri
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get envelope list: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get envelope list: (%w)", responseError(resp))
 	}
 	return resp.Envelopes, nil
 }
@@ -260,7 +315,7 @@ func (c *Client) GetBlock(height uint32) (*indexertypes.BlockMetadata, error) {
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get block: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get block: (%w)", responseError(resp))
 	}
 	if resp.Block.Height == 0 {
 		resp.Block.Height = height
@@ -277,7 +332,7 @@ func (c *Client) GetBlockByHash(hash []byte) (*indexertypes.BlockMetadata, error
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get block: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get block: (%w)", responseError(resp))
 	}
 	if len(resp.Block.Hash) == 0 {
 		resp.Block.Hash = hash
@@ -295,7 +350,7 @@ func (c *Client) GetBlockList(from, listSize int) ([]*indexertypes.BlockMetadata
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get block: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get block: (%w)", responseError(resp))
 	}
 	return resp.BlockList, nil
 }
@@ -310,7 +365,7 @@ func (c *Client) GetTx(blockHeight uint32, txIndex int32) (*indexertypes.TxPacka
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get tx: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get tx: (%w)", responseError(resp))
 	}
 	if resp.Tx.BlockHeight == 0 {
 		resp.Tx.BlockHeight = blockHeight
@@ -327,7 +382,7 @@ func (c *Client) GetTxByID(id uint32) (*indexertypes.TxPackage, error) {
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get tx: (%s)", resp.Message)
+		return nil, fmt.Errorf("cannot get tx: (%w)", responseError(resp))
 	}
 	if resp.Tx != nil {
 		resp.Tx.ID = id
@@ -346,7 +401,7 @@ func (c *Client) GetTxListForBlock(blockHeight uint32, from, listSize int) ([]*i
 		return nil, err
 	}
 	if !resp.Ok {
-		return nil, fmt.Errorf("cannot get tx list for block %d: (%s)", blockHeight, resp.Message)
+		return nil, fmt.Errorf("cannot get tx list for block %d: (%w)", blockHeight, responseError(resp))
 	}
 	for _, tx := range resp.TxList {
 		if tx.BlockHeight == 0 {
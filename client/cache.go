@@ -0,0 +1,177 @@
+package client
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCacheSize is the number of responses kept by the cache of the web client
+const DefaultCacheSize = 2000
+
+// noExpiry marks responses which never change, so they're cached until evicted
+const noExpiry time.Duration = 0
+
+// cacheTTLs is the time responses are cached for, by method. Immutable data is kept until
+// evicted, data which changes with every block expires quickly, and methods not listed
+// here are never cached. Only successful responses are cached, so an unknown block or
+// envelope is looked up again. The lists refreshed by the pages on every block are cached
+// too, so the pages of all browsers fetching them from the server cost a single request.
+var cacheTTLs = map[string]time.Duration{
+	"getBlock":          noExpiry,
+	"getBlockByHash":    noExpiry,
+	"getTx":             noExpiry,
+	"getTxById":         noExpiry,
+	"getTxListForBlock": noExpiry,
+	"getEnvelope":       noExpiry,
+	"getStats":          5 * time.Second,
+	"getBlockStatus":    2 * time.Second,
+	"getBlockList":      2 * time.Second,
+	"getResults":        10 * time.Second,
+	"getProcessList":    5 * time.Second,
+	"getProcessSummary": 5 * time.Second,
+	"getProcessCount":   5 * time.Second,
+	"getEntityList":     5 * time.Second,
+	"getValidatorList":  10 * time.Second,
+}
+
+// Cache stores encoded gateway responses by key. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored at key, if it's present and not expired
+	Get(key string) ([]byte, bool)
+	// Set stores value at key for ttl, or until evicted if ttl is zero
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// CacheStats counts the cache lookups of a client
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// SetCache sets the cache used for the responses of the methods in cacheTTLs.
+// The same cache may be shared by several clients. A nil cache disables caching.
+func (c *Client) SetCache(cache Cache) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+	c.cache = cache
+}
+
+// CacheStats returns the number of cache hits and misses since the client was created
+func (c *Client) CacheStats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.cacheHits),
+		Misses: atomic.LoadUint64(&c.cacheMisses),
+	}
+}
+
+// CacheTTL returns the time the responses of method may be cached for, and false if
+// they mustn't be cached. A zero ttl means until evicted.
+func CacheTTL(method string) (time.Duration, bool) {
+	ttl, ok := cacheTTLs[method]
+	return ttl, ok
+}
+
+// cacheFor returns the cache and ttl to be used for req, or a nil cache if it's not cacheable
+func (c *Client) cacheFor(req APIrequest) (Cache, time.Duration) {
+	ttl, ok := cacheTTLs[req.Method]
+	if !ok {
+		return nil, 0
+	}
+	c.cacheLock.RLock()
+	defer c.cacheLock.RUnlock()
+	return c.cache, ttl
+}
+
+// CacheKey identifies a request by its method and params
+func CacheKey(req APIrequest) (string, error) {
+	req.Timestamp = 0
+	key, err := json.Marshal(req)
+	return string(key), err
+}
+
+// cacheGet returns the cached response for key, decoded anew so callers can't modify the cached one
+func (c *Client) cacheGet(cache Cache, key string) (*APIresponse, bool) {
+	if data, ok := cache.Get(key); ok {
+		var resp APIresponse
+		if err := json.Unmarshal(data, &resp); err == nil {
+			atomic.AddUint64(&c.cacheHits, 1)
+			return &resp, true
+		}
+	}
+	atomic.AddUint64(&c.cacheMisses, 1)
+	return nil, false
+}
+
+func (c *Client) cacheSet(cache Cache, key string, resp *APIresponse, ttl time.Duration) {
+	if data, err := json.Marshal(resp); err == nil {
+		cache.Set(key, data, ttl)
+	}
+}
+
+// lruCache is an in-memory Cache which evicts the least recently used entries
+type lruCache struct {
+	size int
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries from most to least recently used
+	order *list.List
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache returns an in-memory cache holding up to size responses
+func NewLRUCache(size int) Cache {
+	return &lruCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (l *lruCache) Get(key string) ([]byte, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	elem, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		l.order.Remove(elem)
+		delete(l.entries, key)
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (l *lruCache) Set(key string, value []byte, ttl time.Duration) {
+	entry := &lruEntry{key: key, value: value}
+	if ttl != noExpiry {
+		entry.expires = time.Now().Add(ttl)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		elem.Value = entry
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.entries[key] = l.order.PushFront(entry)
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
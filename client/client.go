@@ -4,116 +4,633 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	ethcommon "github.com/ethereum/go-ethereum/common"
 	"gitlab.com/vocdoni/vocexplorer/logger"
 	"go.vocdoni.io/dvote/httprouter/jsonrpcapi"
 	"nhooyr.io/websocket"
 )
 
+const (
+	// DefaultTimeout is the maximum time Request waits for a response
+	DefaultTimeout = 1 * time.Minute
+	// ConnectWait is the maximum time a request waits for a lost websocket to reconnect
+	ConnectWait = 10 * time.Second
+	// HealthCheckInterval is the time between gateway health checks
+	HealthCheckInterval = 30 * time.Second
+
+	// writeTimeout bounds a single websocket write. Writes never use the caller's context,
+	// since cancelling a write closes the websocket shared by all in-flight requests.
+	writeTimeout = 20 * time.Second
+	// minBackoff and maxBackoff bound the wait between reconnection rounds
+	minBackoff = 1 * time.Second
+	maxBackoff = 1 * time.Minute
+)
+
+// errConnLost is returned to the requests in flight when their websocket is closed
+var errConnLost = errors.New("connection lost")
+
+// Client is a gateway client backed by a pool of gateways.
+// Over websockets, a single connection is shared by all callers: requests are tagged with
+// unique IDs and each response is routed back to the caller waiting for it, so the client
+// is safe for concurrent use. When the gateway in use drops or turns unhealthy, the client
+// reconnects with exponential backoff and fails over to the next healthy gateway.
 type Client struct {
-	Address string
-	ws      *websocket.Conn
-	http    *http.Client
+	// lastID is the last request ID used, accessed atomically.
+	// Kept first in the struct so it's 64-bit aligned on 32-bit platforms.
+	lastID uint64
+	// cacheHits and cacheMisses count the cache lookups, accessed atomically
+	cacheHits   uint64
+	cacheMisses uint64
+
+	addrs []string
+	http  *http.Client
+
+	// lock guards current, conn and connected
+	lock sync.RWMutex
+	// current is the index in addrs of the gateway in use
+	current int
+	// conn is the websocket in use, nil while reconnecting
+	conn *wsConn
+	// connected is closed once conn is set again after a reconnection
+	connected chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// trustLock guards trusted, strict and untrusted, see SetTrustedSigners
+	trustLock sync.RWMutex
+	trusted   map[ethcommon.Address]bool
+	strict    bool
+	// untrusted holds the untrusted key which signed a response of a gateway, by gateway address
+	untrusted map[string]string
+
+	// cacheLock guards cache, see SetCache
+	cacheLock sync.RWMutex
+	cache     Cache
+
+	// statsLock guards methodStats, see MethodStats
+	statsLock   sync.Mutex
+	methodStats map[string]*MethodStats
 }
 
-// New starts a connection with the given endpoint address.
-// Supported protocols are ws(s):// and http(s)://
-func New(addr string) (*Client, error) {
-	cli := &Client{Address: addr}
-	var err error
-	if strings.HasPrefix(addr, "ws") {
-		logger.Info(fmt.Sprintf("Connecting to gateway: %v", addr))
-		cli.ws, _, err = websocket.Dial(context.Background(), addr, nil)
-		if err != nil {
-			return nil, err
+// wsConn is a single websocket connection and the requests waiting on it
+type wsConn struct {
+	addr string
+	ws   *websocket.Conn
+
+	// lock guards pending and err
+	lock sync.Mutex
+	// pending holds the requests waiting for a response, by request ID
+	pending map[string]*wsPending
+	// err is set once the read loop stops, failing any further request
+	err error
+}
+
+// wsPending is a request waiting for its response. Requests relayed with the ID of their
+// caller may share an ID, so a request waits for the previous one with its ID to be done.
+type wsPending struct {
+	ch   chan wsResponse
+	done chan struct{}
+}
+
+// wsResponse is a raw websocket response, or the error which prevented receiving it
+type wsResponse struct {
+	message []byte
+	err     error
+}
+
+// New creates a client for the given gateway endpoint addresses, in order of preference.
+// Supported protocols are ws(s):// and http(s)://, and all addresses must share the same one.
+// Websocket gateways are dialed right away; if none is available the client keeps
+// reconnecting in the background, so an error is only returned for invalid addresses.
+func New(addrs ...string) (*Client, error) {
+	return NewTrusted(nil, false, addrs...)
+}
+
+// NewTrusted creates a client like New, which checks the signer of every response against
+// the trusted signers from the first request on, see SetTrustedSigners
+func NewTrusted(signers []string, strict bool, addrs ...string) (*Client, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no gateway address provided")
+	}
+	trusted, err := parseSigners(signers)
+	if err != nil {
+		return nil, err
+	}
+	cli := &Client{
+		addrs:       addrs,
+		connected:   make(chan struct{}),
+		closed:      make(chan struct{}),
+		trusted:     trusted,
+		strict:      strict,
+		untrusted:   make(map[string]string),
+		methodStats: make(map[string]*MethodStats),
+	}
+	isWs := strings.HasPrefix(addrs[0], "ws")
+	for _, addr := range addrs {
+		if !strings.HasPrefix(addr, "ws") && !strings.HasPrefix(addr, "http") {
+			return nil, fmt.Errorf("address is not websockets nor http: %s", addr)
+		}
+		if strings.HasPrefix(addr, "ws") != isWs {
+			return nil, fmt.Errorf("cannot mix websockets and http gateways: %s", addr)
 		}
-	} else if strings.HasPrefix(addr, "http") {
+	}
+	if isWs {
+		if !cli.connect() {
+			go cli.reconnect()
+		}
+	} else {
 		tr := &http.Transport{
 			MaxIdleConns:       10,
 			IdleConnTimeout:    10 * time.Second,
 			DisableCompression: false,
 		}
 		cli.http = &http.Client{Transport: tr, Timeout: time.Second * 20}
-		if cli.http == nil {
-			return nil, fmt.Errorf("unable to connect to %s", addr)
-		}
-	} else {
-		return nil, fmt.Errorf("address is not websockets nor http: %s", addr)
 	}
+	go cli.healthLoop()
 	return cli, nil
 }
 
+// Address returns the address of the gateway currently in use
+func (c *Client) Address() string {
+	if c == nil {
+		return ""
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.addrs[c.current]
+}
+
+// Close closes the connection to the endpoint and stops reconnecting
 func (c *Client) Close() error {
+	if c == nil {
+		return nil
+	}
 	var err error
-	if c.ws != nil {
-		err = c.ws.Close(websocket.StatusNormalClosure, "")
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.lock.RLock()
+		conn := c.conn
+		c.lock.RUnlock()
+		if conn != nil {
+			err = conn.ws.Close(websocket.StatusNormalClosure, "")
+		}
+		if c.http != nil {
+			c.http.CloseIdleConnections()
+		}
+	})
+	return err
+}
+
+// connect tries every gateway once, starting from the current one, and keeps the first
+// one which reports itself healthy. If none is healthy, the first reachable one is kept anyway.
+func (c *Client) connect() bool {
+	c.lock.RLock()
+	first := c.current
+	c.lock.RUnlock()
+	var fallback *wsConn
+	fallbackIdx := 0
+	for i := 0; i < len(c.addrs); i++ {
+		idx := (first + i) % len(c.addrs)
+		conn, err := c.dial(c.addrs[idx])
+		if conn == nil {
+			logger.Warn(fmt.Sprintf("cannot connect to gateway %s: %v", c.addrs[idx], err))
+			continue
+		}
+		if err != nil {
+			logger.Warn(fmt.Sprintf("gateway %s is unhealthy: %v", c.addrs[idx], err))
+			if fallback == nil {
+				fallback, fallbackIdx = conn, idx
+			} else {
+				conn.ws.Close(websocket.StatusNormalClosure, "")
+			}
+			continue
+		}
+		if fallback != nil {
+			fallback.ws.Close(websocket.StatusNormalClosure, "")
+		}
+		c.setConn(idx, conn)
+		return true
+	}
+	if fallback != nil {
+		c.setConn(fallbackIdx, fallback)
+		return true
+	}
+	return false
+}
+
+// setConn makes conn the websocket in use, releasing the requests waiting for it
+func (c *Client) setConn(idx int, conn *wsConn) {
+	c.lock.Lock()
+	c.current = idx
+	c.conn = conn
+	close(c.connected)
+	c.lock.Unlock()
+	logger.Info(fmt.Sprintf("Connected to gateway: %v", conn.addr))
+}
+
+// dial opens a websocket to addr and checks the gateway health through it.
+// The connection is returned along with the health check error if the gateway is reachable but unhealthy.
+func (c *Client) dial(addr string) (*wsConn, error) {
+	logger.Info(fmt.Sprintf("Connecting to gateway: %v", addr))
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectWait)
+	defer cancel()
+	ws, _, err := websocket.Dial(ctx, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn := &wsConn{addr: addr, ws: ws, pending: make(map[string]*wsPending)}
+	go c.readLoop(conn)
+	msg, err := c.wsRequest(ctx, conn, c.nextID(), APIrequest{Method: "getInfo"})
+	if errors.Is(err, errConnLost) {
+		return nil, err
+	}
+	var resp *APIresponse
+	if err == nil {
+		resp, err = decodeAPIresponse("getInfo", msg)
+	}
+	if err == nil {
+		err = checkGatewayInfo(addr, resp)
+	}
+	return conn, err
+}
+
+// reconnect retries connecting to the gateway pool with exponential backoff until it succeeds
+func (c *Client) reconnect() {
+	backoff := minBackoff
+	for !c.connect() {
+		logger.Warn(fmt.Sprintf("no gateway available, retrying in %s", backoff))
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
 	}
+}
+
+// dropConn discards a failed websocket and, if it was the one in use,
+// starts reconnecting from the next gateway in the pool
+func (c *Client) dropConn(conn *wsConn) {
+	c.lock.Lock()
+	if c.conn != conn {
+		c.lock.Unlock()
+		return
+	}
+	c.conn = nil
+	c.connected = make(chan struct{})
+	c.current = (c.current + 1) % len(c.addrs)
+	c.lock.Unlock()
+	select {
+	case <-c.closed:
+	default:
+		go c.reconnect()
+	}
+}
+
+// failover abandons the gateway in use, so the next request goes to the next gateway in the pool
+func (c *Client) failover() {
 	if c.http != nil {
-		c.http.CloseIdleConnections()
+		c.lock.Lock()
+		c.current = (c.current + 1) % len(c.addrs)
+		c.lock.Unlock()
+		return
+	}
+	c.lock.RLock()
+	conn := c.conn
+	c.lock.RUnlock()
+	if conn != nil {
+		// Closing the websocket stops its read loop, which drops the connection
+		conn.ws.Close(websocket.StatusGoingAway, "unhealthy gateway")
+	}
+}
+
+// healthLoop periodically checks the gateway in use, failing over when it's unhealthy
+func (c *Client) healthLoop() {
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			c.lock.RLock()
+			reconnecting := c.http == nil && c.conn == nil
+			c.lock.RUnlock()
+			// With a single gateway there's nowhere to fail over to
+			if reconnecting || len(c.addrs) < 2 {
+				continue
+			}
+			if err := c.GetGatewayInfo(); err != nil {
+				logger.Warn(fmt.Sprintf("gateway %s unhealthy, failing over: %v", c.Address(), err))
+				c.failover()
+			}
+		}
+	}
+}
+
+// readLoop reads every websocket message and hands it to the request waiting for its ID.
+// When the connection fails, all pending requests fail and the connection is dropped.
+func (c *Client) readLoop(conn *wsConn) {
+	for {
+		_, message, err := conn.ws.Read(context.Background())
+		if err != nil {
+			logger.Warn(fmt.Sprintf("connection to %s lost: %v", conn.addr, err))
+			conn.lock.Lock()
+			conn.err = errConnLost
+			for id, p := range conn.pending {
+				p.ch <- wsResponse{err: errConnLost}
+				delete(conn.pending, id)
+				close(p.done)
+			}
+			conn.lock.Unlock()
+			c.dropConn(conn)
+			return
+		}
+		var respOuter jsonrpcapi.ResponseMessage
+		if err := json.Unmarshal(message, &respOuter); err != nil {
+			logger.Warn(fmt.Sprintf("cannot decode gateway message: %v", err))
+			continue
+		}
+		conn.lock.Lock()
+		p, ok := conn.pending[respOuter.ID]
+		if ok {
+			delete(conn.pending, respOuter.ID)
+			close(p.done)
+		}
+		conn.lock.Unlock()
+		if !ok {
+			// The request was probably cancelled before its response arrived
+			logger.Warn(fmt.Sprintf("dropping response with unknown request ID %s", respOuter.ID))
+			continue
+		}
+		p.ch <- wsResponse{message: message}
 	}
-	return err
 }
 
-// Request makes a request to the previously connected endpoint
+// waitConn returns the websocket in use, waiting at most ConnectWait for a reconnection
+func (c *Client) waitConn(ctx context.Context) (*wsConn, error) {
+	timeout := time.NewTimer(ConnectWait)
+	defer timeout.Stop()
+	for {
+		c.lock.RLock()
+		conn, connected := c.conn, c.connected
+		c.lock.RUnlock()
+		if conn != nil {
+			return conn, nil
+		}
+		select {
+		case <-connected:
+		case <-c.closed:
+			return nil, fmt.Errorf("client not connected: client closed")
+		case <-timeout.C:
+			return nil, fmt.Errorf("client not connected: no gateway available")
+		case <-ctx.Done():
+			return nil, fmt.Errorf("client not connected: %v", ctx.Err())
+		}
+	}
+}
+
+// nextID returns a request ID which is unique for this client
+func (c *Client) nextID() string {
+	return strconv.FormatUint(atomic.AddUint64(&c.lastID, 1), 10)
+}
+
+// Request makes a request to the gateway in use, waiting at most DefaultTimeout
 func (c *Client) Request(req APIrequest) (*APIresponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	return c.RequestContext(ctx, req)
+}
+
+// RequestContext makes a request to the gateway in use, unless its response is cached.
+// It returns as soon as ctx is done, even if the response is still in flight.
+// Requests interrupted by a connection loss are retried once on the next gateway.
+func (c *Client) RequestContext(ctx context.Context, req APIrequest) (*APIresponse, error) {
 	if c == nil {
 		return nil, fmt.Errorf("unable to make request %s: client not connected", req.Method)
 	}
-	method := req.Method
-	req.Timestamp = int32(time.Now().Unix())
-	reqInner, err := json.Marshal(req)
+	cache, ttl := c.cacheFor(req)
+	if cache == nil {
+		return c.request(ctx, req)
+	}
+	key, err := CacheKey(req)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %v", method, err)
+		return c.request(ctx, req)
+	}
+	if resp, ok := c.cacheGet(cache, key); ok {
+		return resp, nil
 	}
+	resp, err := c.request(ctx, req)
+	if err == nil && resp.Ok {
+		c.cacheSet(cache, key, resp, ttl)
+	}
+	return resp, err
+}
 
-	reqOuter := jsonrpcapi.RequestMessage{
-		ID:         fmt.Sprintf("%d", rand.Intn(1000)),
-		MessageAPI: reqInner,
+// request sends a request to the gateway in use, counting it in the method stats
+func (c *Client) request(ctx context.Context, req APIrequest) (*APIresponse, error) {
+	resp, _, err := c.signedRequest(ctx, c.nextID(), req)
+	return resp, err
+}
+
+// Relay makes a request to the gateway in use with the request ID of the caller, and returns
+// the response message as signed by the gateway, so it can be relayed to callers verifying
+// by themselves the signature and the request ID it answers.
+// The response isn't cached, but the request is counted in the method stats.
+func (c *Client) Relay(ctx context.Context, id string, req APIrequest) (*jsonrpcapi.ResponseMessage, error) {
+	if c == nil {
+		return nil, fmt.Errorf("unable to make request %s: client not connected", req.Method)
 	}
-	reqBody, err := json.Marshal(reqOuter)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %v", method, err)
+	if id == "" {
+		return nil, fmt.Errorf("unable to make request %s: empty request ID", req.Method)
 	}
+	_, msg, err := c.signedRequest(ctx, id, req)
+	return msg, err
+}
 
-	message := []byte{}
-	if c.ws != nil {
-		tctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-		defer cancel()
-		if err := c.ws.Write(tctx, websocket.MessageText, reqBody); err != nil {
-			return nil, fmt.Errorf("%s: %v", method, err)
-		}
-		_, message, err = c.ws.Read(tctx)
-		if err != nil {
-			return nil, fmt.Errorf("%s: %v", method, err)
-		}
+// signedRequest sends a request with the given ID to the gateway in use, counting it in the
+// method stats, and returns the response along with the signed message it was decoded from
+func (c *Client) signedRequest(ctx context.Context, id string, req APIrequest) (*APIresponse, *jsonrpcapi.ResponseMessage, error) {
+	start := time.Now()
+	msg, err := c.send(ctx, id, req)
+	var resp *APIresponse
+	if err == nil {
+		resp, err = decodeAPIresponse(req.Method, msg)
 	}
+	c.observe(req.Method, start, resp, err)
+	return resp, msg, err
+}
+
+// send sends a request with the given ID to the gateway in use
+func (c *Client) send(ctx context.Context, id string, req APIrequest) (*jsonrpcapi.ResponseMessage, error) {
 	if c.http != nil {
-		resp, err := c.http.Post(c.Address, "application/json", bytes.NewBuffer(reqBody))
+		return c.httpRequest(ctx, id, req)
+	}
+	for retried := false; ; retried = true {
+		conn, err := c.waitConn(ctx)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("unable to make request %s: %v", req.Method, err)
 		}
-		message, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
+		resp, err := c.wsRequest(ctx, conn, id, req)
+		if errors.Is(err, errConnLost) && !retried {
+			continue
+		}
+		return resp, err
+	}
+}
+
+// wsRequest sends a request over the given websocket and waits for the response with the same ID
+func (c *Client) wsRequest(ctx context.Context, conn *wsConn, id string, req APIrequest) (*jsonrpcapi.ResponseMessage, error) {
+	reqBody, err := encodeRequest(id, req)
+	if err != nil {
+		return nil, err
+	}
+	p := &wsPending{ch: make(chan wsResponse, 1), done: make(chan struct{})}
+	for {
+		conn.lock.Lock()
+		if conn.err != nil {
+			conn.lock.Unlock()
+			return nil, fmt.Errorf("%s: %w", req.Method, conn.err)
+		}
+		prev, ok := conn.pending[id]
+		if !ok {
+			conn.pending[id] = p
+			conn.lock.Unlock()
+			break
+		}
+		conn.lock.Unlock()
+		select {
+		case <-prev.done:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s: %v", req.Method, ctx.Err())
 		}
-		resp.Body.Close()
 	}
+	defer func() {
+		conn.lock.Lock()
+		if conn.pending[id] == p {
+			delete(conn.pending, id)
+			close(p.done)
+		}
+		conn.lock.Unlock()
+	}()
+
+	wctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	if err := conn.ws.Write(wctx, websocket.MessageText, reqBody); err != nil {
+		return nil, fmt.Errorf("%s: %v", req.Method, err)
+	}
+	select {
+	case resp := <-p.ch:
+		if resp.err != nil {
+			return nil, fmt.Errorf("%s: %w", req.Method, resp.err)
+		}
+		return c.decodeResponse(conn.addr, req.Method, id, resp.message)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %v", req.Method, ctx.Err())
+	}
+}
+
+// httpRequest posts a request to the gateway in use, moving on to the next gateway
+// of the pool when one can't be reached
+func (c *Client) httpRequest(ctx context.Context, id string, req APIrequest) (*jsonrpcapi.ResponseMessage, error) {
+	reqBody, err := encodeRequest(id, req)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for i := 0; i < len(c.addrs); i++ {
+		addr := c.Address()
+		message, err := c.httpPost(ctx, addr, reqBody)
+		if err == nil {
+			return c.decodeResponse(addr, req.Method, id, message)
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+		logger.Warn(fmt.Sprintf("gateway %s unreachable, failing over: %v", addr, err))
+		c.failover()
+	}
+	return nil, fmt.Errorf("%s: %v", req.Method, lastErr)
+}
+
+func (c *Client) httpPost(ctx context.Context, addr string, reqBody []byte) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// encodeRequest stamps the request and wraps it into a jsonrpcapi message with the given ID
+func encodeRequest(id string, req APIrequest) ([]byte, error) {
+	req.Timestamp = int32(time.Now().Unix())
+	reqInner, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", req.Method, err)
+	}
+	reqOuter := jsonrpcapi.RequestMessage{
+		ID:         id,
+		MessageAPI: reqInner,
+	}
+	reqBody, err := json.Marshal(reqOuter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", req.Method, err)
+	}
+	return reqBody, nil
+}
+
+// decodeResponse decodes a jsonrpcapi response message of the gateway at addr, checking it's
+// signed by a trusted key and answers the request with the given ID. The ID outside the signed message
+// only routes the response: the one within is checked too, so a response signed for
+// another request can't be replayed.
+func (c *Client) decodeResponse(addr, method, id string, message []byte) (*jsonrpcapi.ResponseMessage, error) {
 	var respOuter jsonrpcapi.ResponseMessage
 	if err := json.Unmarshal(message, &respOuter); err != nil {
 		return nil, fmt.Errorf("%s: %v", method, err)
 	}
-	if respOuter.ID != reqOuter.ID {
+	if respOuter.ID != id {
 		return nil, fmt.Errorf("%s: %v", method, "request ID doesn't match")
 	}
 	if len(respOuter.Signature) == 0 {
 		return nil, fmt.Errorf("%s: empty signature in response: %s", method, message)
 	}
+	if err := c.verifySignature(addr, respOuter.MessageAPI, respOuter.Signature); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	var signed struct {
+		Request string `json:"request"`
+	}
+	if err := json.Unmarshal(respOuter.MessageAPI, &signed); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if signed.Request != id {
+		return nil, fmt.Errorf("%s: signed response answers request %q, not %q", method, signed.Request, id)
+	}
+	return &respOuter, nil
+}
+
+// decodeAPIresponse unwraps the response of a jsonrpcapi response message
+func decodeAPIresponse(method string, respOuter *jsonrpcapi.ResponseMessage) (*APIresponse, error) {
 	var respInner APIresponse
 	if err := json.Unmarshal(respOuter.MessageAPI, &respInner); err != nil {
 		return nil, fmt.Errorf("%s: %v", method, err)
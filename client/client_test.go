@@ -0,0 +1,232 @@
+package client_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/mockgateway"
+)
+
+// newTestClient starts a gateway serving the default fixtures and a websocket client for it
+func newTestClient(t *testing.T) (*mockgateway.Gateway, *client.Client) {
+	t.Helper()
+	return mockgateway.Start(t, nil)
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	gw, cli := newTestClient(t)
+	// Blocks are answered late, so their responses come after the ones of later requests
+	gw.SetFault("getBlock", mockgateway.Fault{Latency: 20 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		height, id := uint32(i%10+1), uint32(i%3+1)
+		go func() {
+			defer wg.Done()
+			block, err := cli.GetBlock(height)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if block.Height != height {
+				t.Errorf("got block %d, want %d", block.Height, height)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			tx, err := cli.GetTxByID(id)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if tx.ID != id {
+				t.Errorf("got tx %d, want %d", tx.ID, id)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGatewayDropMidRequest(t *testing.T) {
+	gw, cli := newTestClient(t)
+
+	// A request interrupted by the gateway dropping is retried once reconnected
+	gw.SetFault("getStats", mockgateway.Fault{Latency: 200 * time.Millisecond})
+	done := make(chan error, 1)
+	go func() {
+		_, err := cli.GetStats()
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	gw.DropConnections()
+	if err := <-done; err != nil {
+		t.Fatalf("request not retried after the gateway dropped: %v", err)
+	}
+	if n := gw.Requests("getStats"); n != 2 {
+		t.Fatalf("got %d getStats requests, want 2", n)
+	}
+
+	// A gateway dropping every time fails the request, and the client recovers once it stops
+	gw.SetFault("getStats", mockgateway.Fault{Drop: true})
+	if _, err := cli.GetStats(); err == nil {
+		t.Fatal("got no error from a gateway dropping the request")
+	}
+	gw.ClearFaults()
+	if _, err := cli.GetStats(); err != nil {
+		t.Fatalf("client not recovered from the drop: %v", err)
+	}
+}
+
+func TestUntrustedSigner(t *testing.T) {
+	gw, cli := newTestClient(t)
+	if err := cli.SetTrustedSigners([]string{gw.SignerAddress()}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.GetStats(); err != nil {
+		t.Fatalf("response of the trusted signer rejected: %v", err)
+	}
+	if signer := cli.UntrustedSigner(); signer != "" {
+		t.Fatalf("trusted signer reported as untrusted: %s", signer)
+	}
+
+	gw.SetFault("", mockgateway.Fault{BadSignature: true})
+	_, err := cli.GetStats()
+	if err == nil || !strings.Contains(err.Error(), "untrusted") {
+		t.Fatalf("got %v, want the response of an untrusted signer rejected", err)
+	}
+	if cli.UntrustedSigner() == "" {
+		t.Fatal("untrusted signer not reported")
+	}
+
+	// Without strict, the response is accepted but the signer still reported
+	if err := cli.SetTrustedSigners([]string{gw.SignerAddress()}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.GetStats(); err != nil {
+		t.Fatalf("response of an untrusted signer rejected without strict: %v", err)
+	}
+	if cli.UntrustedSigner() == "" {
+		t.Fatal("untrusted signer not reported without strict")
+	}
+
+	// The report sticks to the gateway, whatever it signs later
+	gw.ClearFaults()
+	if _, err := cli.GetStats(); err != nil {
+		t.Fatal(err)
+	}
+	if cli.UntrustedSigner() == "" {
+		t.Fatal("untrusted signer report cleared by a later response")
+	}
+}
+
+func TestTrustedFromFirstResponse(t *testing.T) {
+	gw, err := mockgateway.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Close()
+	gw.SetFault("", mockgateway.Fault{BadSignature: true})
+	if _, err := client.NewTrusted([]string{"zz"}, false, gw.WsURL()); err == nil {
+		t.Fatal("invalid trusted key accepted")
+	}
+	cli, err := client.NewTrusted([]string{gw.SignerAddress()}, false, gw.WsURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	// The health check made while connecting is the first response checked
+	if cli.UntrustedSigner() == "" {
+		t.Fatal("untrusted signer of the first response not reported")
+	}
+}
+
+func TestReplayedResponse(t *testing.T) {
+	gw, cli := newTestClient(t)
+	gw.SetFault("getStats", mockgateway.Fault{Replay: true})
+	_, err := cli.GetStats()
+	if err == nil || !strings.Contains(err.Error(), "answers request") {
+		t.Fatalf("got %v, want the response signed for another request rejected", err)
+	}
+	gw.ClearFaults()
+	if _, err := cli.GetStats(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	gw, cli := newTestClient(t)
+	cli.SetCache(client.NewLRUCache(client.DefaultCacheSize))
+
+	for i := 0; i < 2; i++ {
+		if _, err := cli.GetBlock(3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := gw.Requests("getBlock"); n != 1 {
+		t.Fatalf("got %d getBlock requests, want 1", n)
+	}
+	if stats := cli.CacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("got %+v, want 1 hit and 1 miss", stats)
+	}
+
+	// Failures aren't cached
+	for i := 0; i < 2; i++ {
+		if _, err := cli.GetBlock(99); err == nil {
+			t.Fatal("got no error for an unknown block")
+		}
+	}
+	if n := gw.Requests("getBlock"); n != 3 {
+		t.Fatalf("got %d getBlock requests, want 3", n)
+	}
+
+	// Responses which change with every block expire
+	ttl, ok := client.CacheTTL("getBlockStatus")
+	if !ok || ttl == 0 {
+		t.Fatal("getBlockStatus not cached with an expiry")
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := cli.GetBlockStatus(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := gw.Requests("getBlockStatus"); n != 1 {
+		t.Fatalf("got %d getBlockStatus requests, want 1", n)
+	}
+	time.Sleep(ttl + 100*time.Millisecond)
+	if _, _, _, err := cli.GetBlockStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if n := gw.Requests("getBlockStatus"); n != 2 {
+		t.Fatalf("got %d getBlockStatus requests after %s, want 2", n, ttl)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	cache := client.NewLRUCache(2)
+	cache.Set("a", []byte("a"), 0)
+	cache.Set("b", []byte("b"), 0)
+	// Using a makes b the least recently used
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("a missing")
+	}
+	cache.Set("c", []byte("c"), 0)
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("b not evicted")
+	}
+	if v, ok := cache.Get("a"); !ok || string(v) != "a" {
+		t.Fatalf("got %q, %v for a", v, ok)
+	}
+
+	cache.Set("d", []byte("d"), 50*time.Millisecond)
+	if _, ok := cache.Get("d"); !ok {
+		t.Fatal("d missing before expiring")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := cache.Get("d"); ok {
+		t.Fatal("d not expired")
+	}
+}
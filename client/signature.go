@@ -0,0 +1,129 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"strings"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"gitlab.com/vocdoni/vocexplorer/util"
+)
+
+// signingPrefix is prepended by the gateways to every message before hashing and signing it
+const signingPrefix = "\u0019Ethereum Signed Message:\n"
+
+// SetTrustedSigners sets the gateway keys trusted to sign responses, given as hex encoded
+// addresses or public keys (compressed or not). Once set, the signer of every response is
+// recovered and checked: with strict, responses signed by any other key are rejected,
+// otherwise they are accepted but reported by GetGatewayInfo. An empty list disables the check.
+// Setting the keys clears the gateways reported as untrusted.
+// The keys should rather be given to NewTrusted, since the responses received before they
+// are set aren't checked.
+func (c *Client) SetTrustedSigners(signers []string, strict bool) error {
+	trusted, err := parseSigners(signers)
+	if err != nil {
+		return err
+	}
+	c.trustLock.Lock()
+	defer c.trustLock.Unlock()
+	c.trusted = trusted
+	c.strict = strict
+	c.untrusted = make(map[string]string)
+	return nil
+}
+
+// UntrustedSigner returns the address of an untrusted key which signed a response of the
+// gateway in use, or an empty string if all its responses were signed by trusted keys.
+// A gateway stays reported once it signed with an untrusted key, whatever the responses
+// to other requests, until the trusted keys are set again.
+func (c *Client) UntrustedSigner() string {
+	addr := c.Address()
+	c.trustLock.RLock()
+	defer c.trustLock.RUnlock()
+	return c.untrusted[addr]
+}
+
+// verifySignature checks the signer of a response message of the gateway at addr against
+// the trusted keys, reporting the gateway if the signer isn't trusted
+func (c *Client) verifySignature(addr string, message, signature []byte) error {
+	c.trustLock.RLock()
+	trusted, strict := c.trusted, c.strict
+	c.trustLock.RUnlock()
+	if len(trusted) == 0 {
+		return nil
+	}
+	signer, err := recoverSigner(message, signature)
+	if err != nil {
+		return fmt.Errorf("cannot verify response signature: %v", err)
+	}
+	if trusted[signer] {
+		return nil
+	}
+	c.trustLock.Lock()
+	if c.untrusted != nil {
+		c.untrusted[addr] = signer.Hex()
+	}
+	c.trustLock.Unlock()
+	if strict {
+		return fmt.Errorf("response signed by untrusted key %s", signer.Hex())
+	}
+	return nil
+}
+
+// recoverSigner returns the address of the key which signed message
+func recoverSigner(message, signature []byte) (ethcommon.Address, error) {
+	if len(signature) != ethcrypto.SignatureLength {
+		return ethcommon.Address{}, fmt.Errorf("signature length is %d, expected %d", len(signature), ethcrypto.SignatureLength)
+	}
+	sig := make([]byte, len(signature))
+	copy(sig, signature)
+	// Accept both the raw and the 27/28 recovery id encodings
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	hash := ethcrypto.Keccak256([]byte(fmt.Sprintf("%s%d%s", signingPrefix, len(message), message)))
+	pubKey, err := ethcrypto.SigToPub(hash, sig)
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+	return ethcrypto.PubkeyToAddress(*pubKey), nil
+}
+
+// parseSigners turns hex encoded addresses or public keys into the set of their addresses
+func parseSigners(signers []string) (map[ethcommon.Address]bool, error) {
+	trusted := make(map[ethcommon.Address]bool, len(signers))
+	for _, signer := range signers {
+		addr, err := parseSigner(signer)
+		if err != nil {
+			return nil, err
+		}
+		trusted[addr] = true
+	}
+	return trusted, nil
+}
+
+// parseSigner turns a hex encoded address or public key into an address
+func parseSigner(signer string) (ethcommon.Address, error) {
+	bz, err := util.DecodeHex(strings.TrimSpace(signer))
+	if err != nil {
+		return ethcommon.Address{}, fmt.Errorf("invalid trusted key %s: %v", signer, err)
+	}
+	var pubKey *ecdsa.PublicKey
+	switch len(bz) {
+	case ethcommon.AddressLength:
+		return ethcommon.BytesToAddress(bz), nil
+	case 33:
+		pubKey, err = ethcrypto.DecompressPubkey(bz)
+	case 64:
+		pubKey, err = ethcrypto.UnmarshalPubkey(append([]byte{4}, bz...))
+	case 65:
+		pubKey, err = ethcrypto.UnmarshalPubkey(bz)
+	default:
+		return ethcommon.Address{}, fmt.Errorf("invalid trusted key %s: not an address nor a public key", signer)
+	}
+	if err != nil {
+		return ethcommon.Address{}, fmt.Errorf("invalid trusted key %s: %v", signer, err)
+	}
+	return ethcrypto.PubkeyToAddress(*pubKey), nil
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"time"
+)
+
+// MethodStats counts the gateway requests of a method. Cached responses aren't counted.
+type MethodStats struct {
+	Requests uint64 `json:"requests"`
+	// Errors counts the requests which failed or got an error response
+	Errors uint64 `json:"errors"`
+	// Latency is the total time spent waiting for responses
+	Latency time.Duration `json:"latency"`
+}
+
+// MethodStats returns the requests made to the gateways since the client was created, by method
+func (c *Client) MethodStats() map[string]MethodStats {
+	stats := make(map[string]MethodStats)
+	if c == nil {
+		return stats
+	}
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	for method, s := range c.methodStats {
+		stats[method] = *s
+	}
+	return stats
+}
+
+// observe counts a request to method which took since start to complete
+func (c *Client) observe(method string, start time.Time, resp *APIresponse, err error) {
+	latency := time.Since(start)
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	s, ok := c.methodStats[method]
+	if !ok {
+		s = new(MethodStats)
+		c.methodStats[method] = s
+	}
+	s.Requests++
+	s.Latency += latency
+	if err != nil || resp == nil || !resp.Ok {
+		s.Errors++
+	}
+}
@@ -127,6 +127,23 @@ type VochainStats struct {
 	Syncing          bool      `json:"syncing"`
 }
 
+// GatewayStatus is the health of a gateway and the APIs it enables
+type GatewayStatus struct {
+	Address string   `json:"address"`
+	Health  int32    `json:"health"`
+	APIs    []string `json:"apis"`
+}
+
+// Enables returns true if the gateway enables api
+func (s *GatewayStatus) Enables(api string) bool {
+	for _, a := range s.APIs {
+		if a == api {
+			return true
+		}
+	}
+	return false
+}
+
 type ProcessSummary struct {
 	BlockCount      uint32               `json:"blockCount,omitempty"`
 	EntityID        string               `json:"entityId,omitempty"`
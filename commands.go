@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/config"
+	"gitlab.com/vocdoni/vocexplorer/logger"
+	"gitlab.com/vocdoni/vocexplorer/tally"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"gitlab.com/vocdoni/vocexplorer/vote"
+	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+)
+
+// command is a subcommand run instead of the web server, taking the positional arguments
+// left after the subcommand name. It returns the process exit code.
+type command func(cfg *config.MainCfg, args []string) int
+
+// commands are the subcommands of the explorer binary
+var commands = map[string]command{
+	"verify":  verifyCommand,
+	"decrypt": decryptCommand,
+}
+
+// runCommand runs the subcommand named by the first positional argument
+func runCommand(cfg *config.MainCfg, args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		return 2
+	}
+	// Keep stdout for the command output
+	logger.InfoLogger.SetOutput(os.Stderr)
+	logger.WarningLogger.SetOutput(os.Stderr)
+	return cmd(cfg, args[1:])
+}
+
+// newCommandClient connects to the configured gateways, checking their signatures as the server does
+func newCommandClient(cfg *config.MainCfg) (*client.Client, error) {
+	return client.NewTrusted(cfg.Global.TrustedGateways, cfg.Global.RejectUntrusted, cfg.Global.Gateways()...)
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// verifyCommand recomputes the results of an ended process from its envelopes and prints the
+// report as JSON. It exits with 1 if the results can't be verified and 3 if they don't match.
+func verifyCommand(cfg *config.MainCfg, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: vocexplorer verify <processId>")
+		return 2
+	}
+	pid, err := util.DecodeHex(args[0])
+	if err != nil || len(pid) == 0 {
+		fmt.Fprintf(os.Stderr, "invalid process id %q\n", args[0])
+		return 2
+	}
+	cli, err := newCommandClient(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cli.Close()
+
+	report, err := tally.Verify(context.Background(), cli, pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot verify process: %v\n", err)
+		return 1
+	}
+	if err := printJSON(report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch report.Status {
+	case tally.StatusMatch:
+		return 0
+	case tally.StatusMismatch:
+		return 3
+	default:
+		return 1
+	}
+}
+
+const decryptUsage = `usage:
+  vocexplorer decrypt envelope <nullifier>
+  vocexplorer decrypt package <votePackage> [<keyIndexes> <privateKeys>]
+
+votePackage is base64 encoded, as returned by the gateway, or hex encoded with a 0x prefix.
+keyIndexes are the comma separated encryption key indexes of the envelope, and privateKeys
+the comma separated revealed keys of the process, as <index>:<key>.`
+
+// decryptCommand decodes a vote package, either given with its keys or fetched from the
+// gateway by the envelope nullifier, and prints it as JSON
+func decryptCommand(cfg *config.MainCfg, args []string) int {
+	var (
+		pkg *indexertypes.VotePackage
+		err error
+	)
+	switch {
+	case len(args) == 2 && args[0] == "envelope":
+		nullifier, perr := util.DecodeHex(args[1])
+		if perr != nil || len(nullifier) == 0 {
+			fmt.Fprintf(os.Stderr, "invalid nullifier %q\n", args[1])
+			return 2
+		}
+		cli, cerr := newCommandClient(cfg)
+		if cerr != nil {
+			fmt.Fprintln(os.Stderr, cerr)
+			return 1
+		}
+		defer cli.Close()
+		pkg, err = vote.Fetch(cli, nullifier)
+	case (len(args) == 2 || len(args) == 4) && args[0] == "package":
+		votePackage, perr := parseVotePackage(args[1])
+		if perr != nil {
+			fmt.Fprintln(os.Stderr, perr)
+			return 2
+		}
+		var keys []string
+		if len(args) == 4 {
+			if keys, perr = parseKeys(args[2], args[3]); perr != nil {
+				fmt.Fprintln(os.Stderr, perr)
+				return 2
+			}
+		}
+		pkg, err = vote.Decode(votePackage, keys)
+	default:
+		fmt.Fprintln(os.Stderr, decryptUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot decode vote: %v\n", err)
+		return 1
+	}
+	if err := printJSON(pkg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func parseVotePackage(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") {
+		bz, err := util.DecodeHex(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex vote package: %v", err)
+		}
+		return bz, nil
+	}
+	bz, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 vote package: %v", err)
+	}
+	return bz, nil
+}
+
+// parseKeys returns the private keys listed in privKeys for the comma separated indexes
+func parseKeys(indexes, privKeys string) ([]string, error) {
+	var idxs []uint32
+	for _, s := range strings.Split(indexes, ",") {
+		idx, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key index %q", s)
+		}
+		idxs = append(idxs, uint32(idx))
+	}
+	var keys []client.Key
+	for _, s := range strings.Split(privKeys, ",") {
+		parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid private key %q, expected <index>:<key>", s)
+		}
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key index %q", parts[0])
+		}
+		keys = append(keys, client.Key{Idx: idx, Key: parts[1]})
+	}
+	return vote.KeysFor(idxs, keys)
+}
@@ -1,20 +1,256 @@
 package config
 
-//Cfg is the global config to be served to pages
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Cfg is the global config to be served to pages
 type Cfg struct {
 	// RefreshTime is the number of seconds between page data refresh
 	RefreshTime int    `json:"refreshTime"`
 	GatewayUrl  string `json:"gatewayUrl"`
-	Network     string `json:"network"`
+	// GatewayUrls are the fallback gateways, used when GatewayUrl is unavailable
+	GatewayUrls []string `json:"gatewayUrls"`
+	Network     string   `json:"network"`
+	// TrustedGateways are the addresses or public keys of the gateways trusted to sign responses.
+	// If empty, response signatures are not verified.
+	TrustedGateways []string `json:"trustedGateways"`
+	// RejectUntrusted makes the client reject responses not signed by a trusted gateway,
+	// instead of only flagging the gateway as untrusted
+	RejectUntrusted bool `json:"rejectUntrusted"`
+	// LinkDomain is the domain of the app the entity and process profiles link to, no links if empty
+	LinkDomain string `json:"linkDomain"`
+	// Prefix is the route prefix of the network pages, empty for the default network
+	Prefix string `json:"prefix"`
+	// Networks are the names of every network served, the default one first
+	Networks []string `json:"networks"`
+	// Proxy makes pages send their gateway requests to the server, at ProxyPath, instead
+	// of the gateways, which aren't served to pages then
+	Proxy bool `json:"proxy"`
+	// HostURL is the URL the explorer is served at, which the absolute links of the feeds
+	// and rendered pages start with, followed by Prefix
+	HostURL string `json:"-"`
+}
+
+// LinkURL returns the profile URL template with the link domain, or an empty string if
+// the network has no link domain
+func (c *Cfg) LinkURL(template string) string {
+	if c.LinkDomain == "" {
+		return ""
+	}
+	return strings.ReplaceAll(template, DomainKey, c.LinkDomain)
 }
 
-//MainCfg includes backend and frontend config
+// NetworkPrefix returns the route prefix of the network name, given the default one
+func NetworkPrefix(name, defaultNetwork string) string {
+	if name == defaultNetwork {
+		return ""
+	}
+	return "/" + name
+}
+
+// Gateways returns the main gateway followed by the fallback ones, without duplicates
+func (c *Cfg) Gateways() []string {
+	gateways := []string{}
+	for _, url := range append([]string{c.GatewayUrl}, c.GatewayUrls...) {
+		if url == "" {
+			continue
+		}
+		duplicate := false
+		for _, g := range gateways {
+			duplicate = duplicate || g == url
+		}
+		if !duplicate {
+			gateways = append(gateways, url)
+		}
+	}
+	return gateways
+}
+
+// MainCfg includes backend and frontend config
 type MainCfg struct {
 	DataDir     string
 	DisableGzip bool
-	Global      Cfg
-	HostURL     string
-	LogLevel    string
+	// DisableMetrics disables the Prometheus metrics endpoint
+	DisableMetrics bool
+	// Global is the config of the default network, served at the root of the explorer
+	Global Cfg
+	// Networks are the networks served along the default one, under /<name>, by name
+	Networks map[string]Network
+	// NetworkGateways adds gateways to Networks, as <name>=<gatewayUrl>
+	NetworkGateways []string
+	HostURL         string
+	// Indexer enables the local indexer, which serves the REST API from DataDir
+	Indexer bool
+	// CacheSize is the number of gateway responses cached by the server, 0 to disable the cache
+	CacheSize int
+	// StatsInterval is the number of seconds between two samples of the stats history, 0 to disable it
+	StatsInterval int
+	// AlertWebhooks are the webhooks notified of chain and gateway problems, as <format>=<url>
+	AlertWebhooks []string
+	// AlertHaltFactor is the number of average block times without a new block after which
+	// the chain is considered halted
+	AlertHaltFactor int
+	// AlertDebounce is the number of seconds a problem must last, or be over, before notifying it
+	AlertDebounce int
+	// Subscriptions enables the process subscriptions, stored in DataDir
+	Subscriptions bool
+	// SMTP is the server sending the subscription emails, disabled if its host is empty
+	SMTP SMTPCfg
+	// Proxy relays the gateway requests of the pages through the server, see Cfg.Proxy
+	Proxy bool
+	// ProxyCacheSize is the number of gateway responses cached by the proxy, 0 to disable the cache
+	ProxyCacheSize int
+	// ProxyRate is the number of proxy requests per second allowed to every client IP, with
+	// bursts of up to ProxyBurst requests, 0 to disable the limits
+	ProxyRate  float64
+	ProxyBurst int
+	// RateLimit limits the requests of every client IP to the server
+	RateLimit RateLimitCfg
+	// TLS serves the explorer over HTTPS, on the host of HostURL
+	TLS TLSCfg
+	// ShutdownTimeout is the number of seconds given to the requests in progress and the
+	// background workers to finish on shutdown
+	ShutdownTimeout int
+	LogLevel        string
+}
+
+// Network is a Vochain network served along the default one
+type Network struct {
+	// GatewayUrls are the gateways of the network, the first one used unless unavailable
+	GatewayUrls     []string
+	TrustedGateways []string
+	RejectUntrusted bool
+	// LinkDomain defaults to the one of the well known networks
+	LinkDomain string
+}
+
+// networkName matches the valid network names, used as route prefixes
+var networkName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// reservedRoutes are the first path segments of the explorer routes, which networks can't be named as
+var reservedRoutes = map[string]bool{
+	"api": true, "block": true, "dvote": true, "blocks": true, "config": true, "entities": true, "entity": true,
+	"envelope": true, "envelopes": true, "feeds": true, "healthz": true, "metrics": true, "ping": true,
+	"process": true, "processes": true, "readyz": true, "search": true, "static": true, "stats": true,
+	"transaction": true, "transactions": true, "validator": true, "validators": true,
+}
+
+// NetworkCfgs returns the page config of every network served, the default one first
+// and the others sorted by name
+func (c *MainCfg) NetworkCfgs() ([]*Cfg, error) {
+	networks := make(map[string]Network)
+	for name, n := range c.Networks {
+		networks[strings.ToLower(name)] = n
+	}
+	for _, s := range c.NetworkGateways {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid network gateway %q, expected <name>=<gatewayUrl>", s)
+		}
+		name := strings.ToLower(kv[0])
+		n := networks[name]
+		n.GatewayUrls = append(n.GatewayUrls, kv[1])
+		networks[name] = n
+	}
+	names := []string{}
+	for name, n := range networks {
+		switch {
+		case name == c.Global.Network:
+			return nil, fmt.Errorf("network %s is already the default network", name)
+		case !networkName.MatchString(name) || reservedRoutes[name]:
+			return nil, fmt.Errorf("invalid network name %q", name)
+		case len(n.GatewayUrls) == 0:
+			return nil, fmt.Errorf("network %s has no gateway", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = append([]string{c.Global.Network}, names...)
+
+	global := c.Global
+	if global.LinkDomain == "" {
+		global.LinkDomain = LinkDomains[global.Network]
+	}
+	global.Prefix = ""
+	global.Proxy = c.Proxy
+	global.HostURL = c.HostURL
+	global.Networks = names
+	cfgs := []*Cfg{&global}
+	for _, name := range names[1:] {
+		n := networks[name]
+		cfg := &Cfg{
+			RefreshTime:     c.Global.RefreshTime,
+			GatewayUrl:      n.GatewayUrls[0],
+			GatewayUrls:     n.GatewayUrls[1:],
+			Network:         name,
+			TrustedGateways: n.TrustedGateways,
+			RejectUntrusted: n.RejectUntrusted,
+			LinkDomain:      n.LinkDomain,
+			Prefix:          NetworkPrefix(name, c.Global.Network),
+			Networks:        names,
+			Proxy:           c.Proxy,
+			HostURL:         c.HostURL,
+		}
+		if cfg.LinkDomain == "" {
+			cfg.LinkDomain = LinkDomains[name]
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs, nil
+}
+
+// RateLimitCfg are the limits of the requests every client IP may send to the server
+type RateLimitCfg struct {
+	// Rate is the number of requests per second allowed across all routes, with bursts of
+	// up to Burst requests, 0 to disable the limit
+	Rate  float64
+	Burst int
+	// Routes limit the routes under a path prefix on top of Rate, as <path prefix>=<rate>:<burst>
+	Routes []string
+	// TrustedProxies are the IPs or CIDRs of the reverse proxies whose X-Forwarded-For is
+	// trusted to hold the client IP
+	TrustedProxies []string
+	// MaxStreams is the number of long-lived streams, live events and exports, open at once, 0 for no limit
+	MaxStreams int
+}
+
+// TLSCfg serves the explorer over TLS, with a static certificate or with certificates from an ACME server
+type TLSCfg struct {
+	// CertFile and KeyFile are the PEM files of a static certificate
+	CertFile string
+	KeyFile  string
+	// ACMEDomains are the domains certificates are obtained for from the ACME server
+	ACMEDomains []string
+	// ACMEEmail is the contact address of the ACME account, optional
+	ACMEEmail string
+	// ACMEDirectory is the directory URL of the ACME server
+	ACMEDirectory string
+	// ACMECA is a PEM file with the CA certificate of the ACME server, for test servers
+	// using their own CA
+	ACMECA string
+	// HTTPAddr is the address of the plain HTTP listener, which redirects to HTTPS and
+	// answers ACME challenges, empty to disable it
+	HTTPAddr string
+	// HSTSMaxAge is the number of seconds browsers remember to use HTTPS only, 0 to disable HSTS
+	HSTSMaxAge int
+}
+
+// Enabled returns true if a certificate or ACME domains are set
+func (c *TLSCfg) Enabled() bool {
+	return c.CertFile != "" || len(c.ACMEDomains) > 0
+}
+
+// SMTPCfg is the SMTP server sending emails
+type SMTPCfg struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
 }
 
 const (
@@ -29,7 +265,13 @@ const (
 	DomainKey        = "{DOMAIN}"
 	ProcessURL       = "https://" + DomainKey + "/pub/votes/#/0x"
 	EntityURL        = "https://" + DomainKey + "/entity/#/0x"
-	MainDomain       = "vocdoni.app"
-	StgDomain        = "stg.vocdoni.app"
-	DevDomain        = "plaza.dev.vocdoni.net"
+	//ProxyPath is the route of the gateway proxy, under the prefix of every network
+	ProxyPath = "/dvote"
 )
+
+// LinkDomains are the app domains of the well known networks
+var LinkDomains = map[string]string{
+	"main": "vocdoni.app",
+	"stg":  "stg.vocdoni.app",
+	"dev":  "plaza.dev.vocdoni.net",
+}
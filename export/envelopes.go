@@ -0,0 +1,218 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"gitlab.com/vocdoni/vocexplorer/vote"
+	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+)
+
+// envelopePageSize is the number of envelopes requested per getEnvelopeList call,
+// the largest page served by the gateway
+const envelopePageSize = 64
+
+// EnvelopeSource is the subset of the gateway client needed to export the envelopes of a process
+type EnvelopeSource interface {
+	GetProcessKeys(pid []byte) ([]client.Key, []client.Key, error)
+	GetEnvelopeList(pid []byte, from, listSize int, searchTerm string) ([]*indexertypes.EnvelopeMetadata, error)
+	GetEnvelope(nullifier []byte) (*indexertypes.EnvelopePackage, error)
+}
+
+// Envelope is a single vote envelope of an export. VotePackage holds the decoded vote
+// when it's not encrypted or the process keys are already revealed, otherwise
+// DecodeError tells why it couldn't be decoded.
+type Envelope struct {
+	Nullifier            string                    `json:"nullifier"`
+	ProcessID            string                    `json:"processId"`
+	VoterID              string                    `json:"voterId"`
+	Height               uint32                    `json:"height"`
+	TxIndex              int32                     `json:"txIndex"`
+	TxHash               string                    `json:"txHash"`
+	Weight               string                    `json:"weight"`
+	EncryptionKeyIndexes []uint32                  `json:"encryptionKeyIndexes,omitempty"`
+	VotePackage          *indexertypes.VotePackage `json:"votePackage,omitempty"`
+	DecodeError          string                    `json:"decodeError,omitempty"`
+}
+
+// Envelopes walks the whole envelope list of process pid, oldest first, calling fn for
+// every envelope. It stops at the first error returned by the gateway or by fn, or once
+// ctx is done.
+func Envelopes(ctx context.Context, src EnvelopeSource, pid []byte, fn func(*Envelope) error) error {
+	// Keys are only revealed once the process ends, until then the gateway returns none
+	// and encrypted votes are exported with a decode error
+	_, privKeys, err := src.GetProcessKeys(pid)
+	if err != nil {
+		return fmt.Errorf("cannot get process keys: %v", err)
+	}
+	for from := 0; ; from += envelopePageSize {
+		list, err := src.GetEnvelopeList(pid, from, envelopePageSize, "")
+		if err != nil {
+			return fmt.Errorf("cannot get envelope list: %v", err)
+		}
+		for _, meta := range list {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			pkg, err := src.GetEnvelope(meta.Nullifier)
+			if err != nil {
+				return fmt.Errorf("cannot get envelope %x: %v", meta.Nullifier, err)
+			}
+			if err := fn(newEnvelope(meta, pkg, privKeys)); err != nil {
+				return err
+			}
+		}
+		if len(list) < envelopePageSize {
+			return nil
+		}
+	}
+}
+
+func newEnvelope(meta *indexertypes.EnvelopeMetadata, pkg *indexertypes.EnvelopePackage, privKeys []client.Key) *Envelope {
+	e := &Envelope{
+		Nullifier:            util.HexToString(meta.Nullifier),
+		ProcessID:            util.HexToString(meta.ProcessId),
+		VoterID:              util.HexToString(meta.VoterID),
+		Height:               meta.Height,
+		TxIndex:              meta.TxIndex,
+		TxHash:               util.HexToString(meta.TxHash),
+		Weight:               pkg.Weight,
+		EncryptionKeyIndexes: pkg.EncryptionKeyIndexes,
+	}
+	var err error
+	if e.VotePackage, err = vote.DecodeEnvelope(pkg, privKeys); err != nil {
+		e.DecodeError = err.Error()
+	}
+	return e
+}
+
+// EnvelopeWriter encodes a stream of envelopes
+type EnvelopeWriter interface {
+	// Write encodes e, possibly buffering it until the next Flush
+	Write(e *Envelope) error
+	// End encodes the trailer closing the stream after written envelopes: the error which
+	// interrupted it, or the end marker of a complete stream if err is nil
+	End(written int, err error) error
+	// Flush writes any buffered envelope to the underlying writer
+	Flush() error
+}
+
+// Trailer is the last line of an NDJSON envelopes stream. A stream without it was cut.
+type Trailer struct {
+	Complete  bool   `json:"complete"`
+	Envelopes int    `json:"envelopes"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Markers of the first field of the last row of a CSV envelopes stream, followed by the
+// number of envelopes written and, for an interrupted stream, the error. A stream without
+// either was cut.
+const (
+	CSVEndMarker   = "#end"
+	CSVErrorMarker = "#error"
+)
+
+// NewNDJSONWriter returns an EnvelopeWriter encoding each envelope as a JSON object per line
+func NewNDJSONWriter(w io.Writer) EnvelopeWriter {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(e *Envelope) error { return n.enc.Encode(e) }
+
+func (n *ndjsonWriter) End(written int, err error) error {
+	trailer := Trailer{Complete: err == nil, Envelopes: written}
+	if err != nil {
+		trailer.Error = err.Error()
+	}
+	return n.enc.Encode(&trailer)
+}
+
+func (n *ndjsonWriter) Flush() error { return nil }
+
+// envelopesHeader is the header row of the envelopes CSV
+var envelopesHeader = []string{
+	"nullifier", "processId", "voterId", "height", "txIndex", "txHash", "weight",
+	"encryptionKeyIndexes", "votes", "nonce", "decodeError",
+}
+
+// NewCSVWriter returns an EnvelopeWriter encoding each envelope as a CSV row. Key indexes
+// are separated by spaces, and votes are written as a JSON array.
+func NewCSVWriter(w io.Writer) EnvelopeWriter {
+	return &csvWriter{cw: csv.NewWriter(w)}
+}
+
+type csvWriter struct {
+	cw            *csv.Writer
+	headerWritten bool
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+	return c.cw.Write(envelopesHeader)
+}
+
+func (c *csvWriter) Write(e *Envelope) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	indexes := make([]string, len(e.EncryptionKeyIndexes))
+	for i, idx := range e.EncryptionKeyIndexes {
+		indexes[i] = strconv.FormatUint(uint64(idx), 10)
+	}
+	var votes, nonce string
+	if e.VotePackage != nil {
+		bz, err := json.Marshal(e.VotePackage.Votes)
+		if err != nil {
+			return err
+		}
+		votes, nonce = string(bz), e.VotePackage.Nonce
+	}
+	return c.cw.Write([]string{
+		e.Nullifier,
+		e.ProcessID,
+		e.VoterID,
+		strconv.FormatUint(uint64(e.Height), 10),
+		strconv.FormatInt(int64(e.TxIndex), 10),
+		e.TxHash,
+		e.Weight,
+		strings.Join(indexes, " "),
+		votes,
+		nonce,
+		e.DecodeError,
+	})
+}
+
+func (c *csvWriter) End(written int, err error) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	// The row has as many fields as the header, for readers expecting a fixed field count
+	row := make([]string, len(envelopesHeader))
+	row[0], row[1] = CSVEndMarker, strconv.Itoa(written)
+	if err != nil {
+		row[0], row[2] = CSVErrorMarker, err.Error()
+	}
+	return c.cw.Write(row)
+}
+
+func (c *csvWriter) Flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.cw.Flush()
+	return c.cw.Error()
+}
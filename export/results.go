@@ -0,0 +1,103 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/util"
+	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+)
+
+// ResultsSource is the subset of the gateway client needed to export process results
+type ResultsSource interface {
+	GetProcess(pid []byte) (*indexertypes.Process, error)
+	GetResults(pid []byte) ([][]string, string, string, bool, error)
+	GetEnvelopeHeight(pid []byte) (uint32, error)
+	GetBlockStatus() (*[5]int32, *uint32, int32, error)
+}
+
+// Results is a snapshot of the results of a process, along with the chain height it was taken at
+type Results struct {
+	ProcessID     string     `json:"processId"`
+	EntityID      string     `json:"entityId"`
+	State         string     `json:"state"`
+	Type          string     `json:"type"`
+	Final         bool       `json:"final"`
+	EnvelopeCount uint32     `json:"envelopeCount"`
+	Height        uint32     `json:"height"`
+	ExportedAt    time.Time  `json:"exportedAt"`
+	Results       [][]string `json:"results"`
+}
+
+// ProcessResults fetches the current results of process pid
+func ProcessResults(src ResultsSource, pid []byte) (*Results, error) {
+	process, err := src.GetProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get process: %w", err)
+	}
+	results, state, tp, final, err := src.GetResults(pid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get results: %w", err)
+	}
+	envelopes, err := src.GetEnvelopeHeight(pid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get envelope count: %v", err)
+	}
+	_, height, _, err := src.GetBlockStatus()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get block status: %v", err)
+	}
+	r := &Results{
+		ProcessID:     util.HexToString(process.ID),
+		EntityID:      util.HexToString(process.EntityID),
+		State:         state,
+		Type:          tp,
+		Final:         final,
+		EnvelopeCount: envelopes,
+		ExportedAt:    time.Now().UTC(),
+		Results:       results,
+	}
+	// The status height is the block being built, report the last committed one
+	if height != nil && *height > 0 {
+		r.Height = *height - 1
+	}
+	return r, nil
+}
+
+// resultsHeader is the header row of the results CSV
+var resultsHeader = []string{
+	"processId", "entityId", "state", "type", "final", "envelopeCount", "height",
+	"question", "option", "votes",
+}
+
+// WriteCSV writes the results as CSV, one row per question and option. Questions and
+// options are numbered from 1, as shown on the process page.
+func (r *Results) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(resultsHeader); err != nil {
+		return err
+	}
+	for q, options := range r.Results {
+		for o, votes := range options {
+			if err := cw.Write([]string{
+				r.ProcessID,
+				r.EntityID,
+				r.State,
+				r.Type,
+				strconv.FormatBool(r.Final),
+				strconv.FormatUint(uint64(r.EnvelopeCount), 10),
+				strconv.FormatUint(uint64(r.Height), 10),
+				strconv.Itoa(q + 1),
+				strconv.Itoa(o + 1),
+				votes,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
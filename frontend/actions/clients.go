@@ -1,6 +1,6 @@
 package actions
 
-//GatewayConnected is the action to change the connection status of the gateway
+// GatewayConnected is the action to change the connection status of the gateway
 type GatewayConnected struct {
 	GatewayErr error
 }
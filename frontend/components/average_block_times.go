@@ -8,12 +8,12 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/util"
 )
 
-//AverageBlockTimes is the component to display avg block times
+// AverageBlockTimes is the component to display avg block times
 type AverageBlockTimes struct {
 	vecty.Core
 }
 
-//Render renders the AverageBlockTimes component
+// Render renders the AverageBlockTimes component
 func (a *AverageBlockTimes) Render() vecty.ComponentOrHTML {
 
 	if store.Stats == nil {
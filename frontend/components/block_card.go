@@ -12,7 +12,7 @@ import (
 	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
 )
 
-//BlockCard renders a single block card
+// BlockCard renders a single block card
 func BlockCard(block *indexertypes.BlockMetadata) vecty.ComponentOrHTML {
 	if block == nil {
 		return nil
@@ -83,7 +83,7 @@ func UpdateBlockContents(d *BlockContents) {
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
 	// Fetch block contents
 	d.fetchBlock()
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
 	if !update.CheckCurrentPage("block", ticker) {
 		return
 	}
@@ -155,7 +155,7 @@ func updateBlockTransactions(index int) {
 	}
 }
 
-//BlockView renders a single block card
+// BlockView renders a single block card
 func BlockView() vecty.List {
 	return vecty.List{
 		elem.Heading1(
@@ -221,7 +221,7 @@ func BlockView() vecty.List {
 	}
 }
 
-//BlockTab component displays a tab for the block page
+// BlockTab component displays a tab for the block page
 type BlockTab struct {
 	*Tab
 }
@@ -235,7 +235,7 @@ func (b *BlockTab) dispatch() interface{} {
 	}
 }
 
-//BlockDetails displays the details for a single block
+// BlockDetails displays the details for a single block
 func (c *BlockContents) BlockDetails() vecty.List {
 	transactions := &BlockTab{&Tab{
 		Text:  "Transactions",
@@ -12,13 +12,13 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/util"
 )
 
-//BlockchainInfo is the component to display blockchain information
+// BlockchainInfo is the component to display blockchain information
 type BlockchainInfo struct {
 	vecty.Core
 	header bool
 }
 
-//Render renders the BlockchainInfo component
+// Render renders the BlockchainInfo component
 func (b *BlockchainInfo) Render() vecty.ComponentOrHTML {
 	if store.Stats == nil {
 		return LoadingBar()
@@ -13,7 +13,7 @@ type BlockchainVersion struct {
 	vecty.Core
 }
 
-//Render renders the BlockchainVersion component
+// Render renders the BlockchainVersion component
 func (b *BlockchainVersion) Render() vecty.ComponentOrHTML {
 	return &bootstrap.Alert{
 		Contents: fmt.Sprintf(
@@ -45,7 +45,7 @@ func (dash *BlocksDashboardView) Render() vecty.ComponentOrHTML {
 func UpdateBlocksDashboard(d *BlocksDashboardView) {
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
 
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
 	if !update.CheckCurrentPage("blocks", ticker) {
 		return
 	}
@@ -83,7 +83,7 @@ func UpdateBlocksDashboard(d *BlocksDashboardView) {
 
 func updateBlocksDashboard(d *BlocksDashboardView) {
 	if !store.Blocks.Pagination.DisableUpdate {
-		stats, err := store.Client.GetStats()
+		stats, err := update.Stats()
 		if err != nil {
 			logger.Error(err)
 			return
@@ -91,7 +91,7 @@ func updateBlocksDashboard(d *BlocksDashboardView) {
 		actions.UpdateCounts(stats)
 		updateBlocks(d, store.Blocks.Count-store.Blocks.Pagination.Index-config.ListSize+1)
 	}
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 }
 
 func updateBlocks(d *BlocksDashboardView, index int) {
@@ -101,7 +101,7 @@ func updateBlocks(d *BlocksDashboardView, index int) {
 		index = 0
 	}
 	logger.Info(fmt.Sprintf("Getting %d blocks from index %d\n", listSize, index))
-	list, err := store.Client.GetBlockList(index, listSize)
+	list, err := update.BlockList(index, listSize)
 	if err != nil {
 		logger.Error(err)
 		return
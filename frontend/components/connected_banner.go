@@ -10,26 +10,26 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/frontend/store"
 )
 
-//ConnectedBanner is the component to display a banner if server is disconnected
+// ConnectedBanner is the component to display a banner if server is disconnected
 type ConnectedBanner struct {
 	vecty.Core
 	connection string
 }
 
-//Render renders the ConnectedBanner component
+// Render renders the ConnectedBanner component
 func (b *ConnectedBanner) Render() vecty.ComponentOrHTML {
-	if len(store.GatewayError) > 0 && (strings.Contains(store.GatewayError, "vote") || strings.Contains(store.GatewayError, "indexer") || strings.Contains(store.GatewayError, "client not connected")) {
+	if len(store.GatewayError) > 0 && (strings.Contains(store.GatewayError, "vote") || strings.Contains(store.GatewayError, "indexer") || strings.Contains(store.GatewayError, "client not connected") || strings.Contains(store.GatewayError, "untrusted")) {
 		return elem.Div(
 			&bootstrap.Alert{
 				Type:     "warning",
-				Contents: fmt.Sprintf("Cannot use %s %s: %s", b.connection, store.Config.GatewayUrl, store.GatewayError),
+				Contents: fmt.Sprintf("Cannot use %s %s: %s", b.connection, store.Client.Address(), store.GatewayError),
 			},
 		)
 	} else {
 		return elem.Div(
 			&bootstrap.Alert{
 				Type:     "warning",
-				Contents: fmt.Sprintf("Connecting to %s %s", b.connection, store.Client.Address),
+				Contents: fmt.Sprintf("Connecting to %s %s", b.connection, store.Client.Address()),
 			},
 		)
 	}
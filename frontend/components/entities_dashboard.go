@@ -54,7 +54,7 @@ func (dash *EntitiesDashboardView) Render() vecty.ComponentOrHTML {
 func UpdateEntitiesDashboard(d *EntitiesDashboardView) {
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
 
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
 	if !update.CheckCurrentPage("entities", ticker) {
 		return
 	}
@@ -115,7 +115,7 @@ func UpdateEntitiesDashboard(d *EntitiesDashboardView) {
 
 func updateEntities(d *EntitiesDashboardView) {
 	if !store.Entities.Pagination.DisableUpdate {
-		stats, err := store.Client.GetStats()
+		stats, err := update.Stats()
 		if err != nil {
 			logger.Error(err)
 			return
@@ -123,7 +123,7 @@ func updateEntities(d *EntitiesDashboardView) {
 		actions.UpdateCounts(stats)
 		getEntities(d, store.Entities.Count-store.Entities.Pagination.Index-config.ListSize)
 	}
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 }
 
 func getEntities(d *EntitiesDashboardView, index int) {
@@ -133,7 +133,7 @@ func getEntities(d *EntitiesDashboardView, index int) {
 		index = 0
 	}
 	logger.Info(fmt.Sprintf("Getting %d entities from index %d\n", listSize, index))
-	list, err := store.Client.GetEntityList("", listSize, index)
+	list, err := update.EntityList(index, listSize)
 	if err != nil {
 		dispatcher.Dispatch(&actions.SetEntityIDs{EntityIDs: []string{}})
 		logger.Error(err)
@@ -142,7 +142,7 @@ func getEntities(d *EntitiesDashboardView, index int) {
 	reverseIDList(list)
 	dispatcher.Dispatch(&actions.SetEntityIDs{EntityIDs: list})
 	for _, eid := range list {
-		count, err := store.Client.GetProcessCount(util.StringToHex(eid))
+		count, err := update.ProcessCount(util.StringToHex(eid))
 		if err != nil {
 			logger.Error(err)
 			continue
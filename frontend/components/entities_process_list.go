@@ -12,7 +12,7 @@ type EntityProcessListView struct {
 	vecty.Core
 }
 
-//Render renders the EntityProcessListView component
+// Render renders the EntityProcessListView component
 func (b *EntityProcessListView) Render() vecty.ComponentOrHTML {
 	numProcesses := len(store.Entities.CurrentEntity.ProcessIds)
 	if numProcesses > 0 {
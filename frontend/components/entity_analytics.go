@@ -0,0 +1,208 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"gitlab.com/vocdoni/vocexplorer/analytics"
+	"gitlab.com/vocdoni/vocexplorer/logger"
+	"gitlab.com/vocdoni/vocexplorer/util"
+)
+
+// EntityAnalyticsView renders the activity of an entity across all its processes
+type EntityAnalyticsView struct {
+	vecty.Core
+	EntityID string `vecty:"prop"`
+
+	loading bool
+	loaded  string
+	stats   *analytics.EntityStats
+	err     error
+	// cancel stops waiting for the stats once the component is unmounted
+	cancel context.CancelFunc
+}
+
+// Unmount stops waiting for the stats
+func (v *EntityAnalyticsView) Unmount() {
+	if v.cancel != nil {
+		v.cancel()
+	}
+}
+
+// Render renders the EntityAnalyticsView component
+func (v *EntityAnalyticsView) Render() vecty.ComponentOrHTML {
+	if v.loaded != v.EntityID && !v.loading {
+		v.load()
+	}
+	switch {
+	case v.loading || v.loaded != v.EntityID:
+		return elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Loading every process of the entity..."),
+		)
+	case v.err != nil:
+		return elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Analytics unavailable: "+v.err.Error()),
+		)
+	case v.stats.Processes == 0:
+		return elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("This entity has no processes"),
+		)
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Class("entity-analytics")),
+		renderEntitySummary(v.stats),
+		renderEntityParticipation(v.stats.Participation),
+		renderEntityTimeline(v.stats.Timeline),
+	)
+}
+
+func (v *EntityAnalyticsView) load() {
+	v.loading = true
+	eid := v.EntityID
+	ctx, cancel := context.WithCancel(context.Background())
+	v.cancel = cancel
+	go func() {
+		defer cancel()
+		stats := new(analytics.EntityStats)
+		err := fetchReport(ctx, "/api/v1/entities/"+util.TrimHex(eid)+"/analytics", stats)
+		if ctx.Err() != nil {
+			// The component is gone
+			return
+		}
+		if err != nil {
+			logger.Error(err)
+			stats = nil
+		}
+		v.loading = false
+		v.loaded, v.stats, v.err = eid, stats, err
+		vecty.Rerender(v)
+	}()
+}
+
+func renderEntitySummary(stats *analytics.EntityStats) vecty.ComponentOrHTML {
+	states := make([]string, 0, len(stats.ByState))
+	for state := range stats.ByState {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	badges := vecty.List{}
+	for _, state := range states {
+		badges = append(badges, elem.Span(
+			vecty.Markup(vecty.Class("badge", strings.ToLower(state))),
+			vecty.Text(fmt.Sprintf("%s: %d", strings.Title(util.GetProcessStatus(state)), stats.ByState[state])),
+		))
+	}
+	return vecty.List{
+		elem.DescriptionList(
+			elem.DefinitionTerm(vecty.Text("Processes")),
+			elem.Description(vecty.Text(util.IntToString(stats.Processes))),
+			elem.DefinitionTerm(vecty.Text("Envelopes received")),
+			elem.Description(vecty.Text(fmt.Sprintf("%d", stats.Envelopes))),
+			elem.DefinitionTerm(vecty.Text("Average envelopes per process")),
+			elem.Description(vecty.Text(fmt.Sprintf("%.1f", float64(stats.Envelopes)/float64(stats.Processes)))),
+			elem.DefinitionTerm(vecty.Text("First activity")),
+			elem.Description(Link(
+				"/block/"+util.IntToString(stats.FirstActivityBlock),
+				"Block "+util.IntToString(stats.FirstActivityBlock),
+				"",
+			)),
+			elem.DefinitionTerm(vecty.Text("Last activity")),
+			elem.Description(Link(
+				"/block/"+util.IntToString(stats.LastActivityBlock),
+				"Block "+util.IntToString(stats.LastActivityBlock),
+				"",
+			)),
+		),
+		elem.Div(
+			vecty.Markup(vecty.Class("badges")),
+			badges,
+		),
+	}
+}
+
+func renderEntityParticipation(buckets []analytics.Bucket) vecty.ComponentOrHTML {
+	var max uint64
+	for _, b := range buckets {
+		if b.Envelopes > max {
+			max = b.Envelopes
+		}
+	}
+	rows := vecty.List{}
+	for _, b := range buckets {
+		width := 0.0
+		if max > 0 {
+			width = float64(b.Envelopes) * 100 / float64(max)
+		}
+		rows = append(rows, elem.TableRow(
+			elem.TableData(vecty.Text(fmt.Sprintf("%d - %d", b.FromBlock, b.ToBlock))),
+			elem.TableData(vecty.Text(util.IntToString(b.Processes))),
+			elem.TableData(
+				elem.Div(
+					vecty.Markup(
+						vecty.Class("bar"),
+						vecty.Style("width", fmt.Sprintf("%.1f%%", width)),
+					),
+				),
+				vecty.Text(fmt.Sprintf("%d", b.Envelopes)),
+			),
+		))
+	}
+	return vecty.List{
+		elem.Heading4(vecty.Text("Participation over time")),
+		elem.Table(
+			vecty.Markup(
+				vecty.Class("table"),
+				vecty.Attribute("aria-label", "Table of processes started and envelopes received per block range."),
+			),
+			elem.TableHead(
+				elem.TableRow(
+					elem.TableHeader(vecty.Text("Blocks")),
+					elem.TableHeader(vecty.Text("Processes started")),
+					elem.TableHeader(vecty.Text("Envelopes")),
+				),
+			),
+			elem.TableBody(rows),
+		),
+	}
+}
+
+func renderEntityTimeline(timeline []analytics.ProcessActivity) vecty.ComponentOrHTML {
+	rows := vecty.List{}
+	// Newest processes first
+	for i := len(timeline) - 1; i >= 0; i-- {
+		p := timeline[i]
+		rows = append(rows, elem.TableRow(
+			elem.TableData(Link("/block/"+util.IntToString(p.StartBlock), util.IntToString(p.StartBlock), "")),
+			elem.TableData(vecty.Text(util.IntToString(p.EndBlock))),
+			elem.TableData(Link("/process/"+p.ProcessID, p.ProcessID, "")),
+			elem.TableData(vecty.Text(strings.Title(util.GetProcessStatus(p.State)))),
+			elem.TableData(vecty.Text(util.IntToString(p.Envelopes))),
+		))
+	}
+	return vecty.List{
+		elem.Heading4(vecty.Text("Process timeline")),
+		elem.Table(
+			vecty.Markup(
+				vecty.Class("table"),
+				vecty.Attribute("aria-label", "Table of the processes created by the entity, newest first."),
+			),
+			elem.TableHead(
+				elem.TableRow(
+					elem.TableHeader(vecty.Text("Start block")),
+					elem.TableHeader(vecty.Text("End block")),
+					elem.TableHeader(vecty.Text("Process")),
+					elem.TableHeader(vecty.Text("State")),
+					elem.TableHeader(vecty.Text("Envelopes")),
+				),
+			),
+			elem.TableBody(rows),
+		),
+	}
+}
@@ -9,7 +9,6 @@ import (
 
 	"gitlab.com/vocdoni/vocexplorer/config"
 	"gitlab.com/vocdoni/vocexplorer/frontend/actions"
-	"gitlab.com/vocdoni/vocexplorer/frontend/bootstrap"
 	"gitlab.com/vocdoni/vocexplorer/frontend/dispatcher"
 	"gitlab.com/vocdoni/vocexplorer/frontend/store"
 	"gitlab.com/vocdoni/vocexplorer/frontend/store/storeutil"
@@ -25,7 +24,7 @@ type EntityContentsView struct {
 	Rendered bool
 }
 
-//EntityTab is the tab component for entity
+// EntityTab is the tab component for entity
 type EntityTab struct {
 	*Tab
 }
@@ -57,33 +56,51 @@ func (dash *EntityContentsView) Render() vecty.ComponentOrHTML {
 	return Container(
 		vecty.Markup(vecty.Attribute("id", "main")),
 		renderServerConnectionBanner(),
-		elem.Section(
-			vecty.Markup(vecty.Class("details-view", "no-column")),
-			elem.Div(
-				vecty.Markup(vecty.Class("row")),
-				elem.Div(
-					vecty.Markup(vecty.Class("main-column")),
-					bootstrap.Card(bootstrap.CardParams{
-						Body: dash.EntityDetails(),
-					}),
-				),
-			),
+		DetailsView(
+			dash.EntityDetails(),
+			dash.EntityTabs(),
 		),
-		elem.Section(
-			vecty.Markup(vecty.Class("row")),
-			elem.Div(
-				vecty.Markup(vecty.Class("col-12")),
-				vecty.If(store.Entities.CurrentEntity.ProcessCount > 0,
-					bootstrap.Card(bootstrap.CardParams{
-						Body: &EntityProcessListView{}})),
-				vecty.If(store.Entities.CurrentEntity.ProcessCount == 0, bootstrap.Card(bootstrap.CardParams{
-					Body: vecty.Text("This entity has no processes")})),
+	)
+}
+
+// EntityTabs renders the tabs of an entity
+func (dash *EntityContentsView) EntityTabs() vecty.List {
+	processes := &EntityTab{&Tab{
+		Text:  "Processes",
+		Alias: "processes",
+	}}
+	analytics := &EntityTab{&Tab{
+		Text:  "Analytics",
+		Alias: "analytics",
+	}}
+	return vecty.List{
+		elem.Navigation(
+			vecty.Markup(vecty.Attribute("aria-label", "Tab navigation: processes and analytics")),
+			vecty.Markup(vecty.Class("tabs")),
+			elem.UnorderedList(
+				TabLink(dash, processes),
+				TabLink(dash, analytics),
 			),
 		),
-	)
+		elem.Div(
+			vecty.Markup(vecty.Class("tabs-content")),
+			TabContents(processes, renderEntityProcesses()),
+			TabContents(analytics, &EntityAnalyticsView{EntityID: store.Entities.CurrentEntityID}),
+		),
+	}
 }
 
-//EntityDetails renders the details of a single entity
+func renderEntityProcesses() vecty.ComponentOrHTML {
+	if store.Entities.CurrentEntity.ProcessCount == 0 {
+		return elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("This entity has no processes"),
+		)
+	}
+	return &EntityProcessListView{}
+}
+
+// EntityDetails renders the details of a single entity
 func (dash *EntityContentsView) EntityDetails() vecty.List {
 	return vecty.List{
 		elem.Heading1(
@@ -91,7 +108,8 @@ func (dash *EntityContentsView) EntityDetails() vecty.List {
 		),
 		elem.Heading2(vecty.Text(store.Entities.CurrentEntityID)),
 		elem.Div(
-			elem.Span(
+			// Networks without a link domain have no profile pages
+			vecty.If(store.EntityURL != "", elem.Span(
 				vecty.Markup(vecty.Class("title")),
 				elem.Anchor(
 					vecty.Markup(
@@ -101,6 +119,17 @@ func (dash *EntityContentsView) EntityDetails() vecty.List {
 					vecty.Markup(vecty.Attribute("aria-label", "Link to entity "+store.EntityURL+store.Entities.CurrentEntityID+"'s public profile")),
 					vecty.Text("Entity Profile"),
 				),
+			)),
+			elem.Span(
+				vecty.Markup(vecty.Class("title")),
+				elem.Anchor(
+					vecty.Markup(
+						vecty.Attribute("href", store.Route("/feeds/entity/")+store.Entities.CurrentEntityID+".atom"),
+						vecty.Attribute("type", "application/atom+xml"),
+					),
+					vecty.Markup(vecty.Attribute("aria-label", "Atom feed of the processes of entity "+store.Entities.CurrentEntityID)),
+					vecty.Text("Process Feed"),
+				),
 			),
 		),
 	}
@@ -111,10 +140,10 @@ func UpdateEntityContents(d *EntityContentsView) {
 	// Set entity process list to nil so previous list is not displayed
 	dispatcher.Dispatch(&actions.SetEntityProcessIds{ProcessList: []string{}})
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 
-	newCount, err := store.Client.GetProcessCount(util.StringToHex(store.Entities.CurrentEntityID))
+	newCount, err := update.ProcessCount(util.StringToHex(store.Entities.CurrentEntityID))
 	if err != nil {
 		logger.Error(err)
 	} else {
@@ -163,7 +192,7 @@ func UpdateEntityContents(d *EntityContentsView) {
 }
 
 func updateEntityProcesses(d *EntityContentsView, index int) {
-	newCount, err := store.Client.GetProcessCount(util.StringToHex(store.Entities.CurrentEntityID))
+	newCount, err := update.ProcessCount(util.StringToHex(store.Entities.CurrentEntityID))
 	if err != nil {
 		logger.Error(err)
 	} else {
@@ -177,7 +206,7 @@ func updateEntityProcesses(d *EntityContentsView, index int) {
 			index = 0
 		}
 		logger.Info(fmt.Sprintf("Getting %d processes from index %d\n", listSize, index))
-		list, err := store.Client.GetProcessList(util.StringToHex(store.Entities.CurrentEntityID), "", 0, "", false, "", index, listSize)
+		list, err := update.ProcessList(util.StringToHex(store.Entities.CurrentEntityID), index, listSize)
 		if err != nil {
 			logger.Error(err)
 			return
@@ -185,7 +214,7 @@ func updateEntityProcesses(d *EntityContentsView, index int) {
 		reverseIDList(list)
 		dispatcher.Dispatch(&actions.SetEntityProcessIds{ProcessList: list})
 		for _, processId := range store.Entities.CurrentEntity.ProcessIds {
-			summary, err := store.Client.GetProcessSummary(util.StringToHex(processId))
+			summary, err := update.ProcessSummary(util.StringToHex(processId))
 			if err != nil {
 				logger.Error(err)
 			}
@@ -202,5 +231,5 @@ func updateEntityProcesses(d *EntityContentsView, index int) {
 			})
 		}
 	}
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 }
@@ -37,7 +37,7 @@ func (b *EntityListView) Render() vecty.ComponentOrHTML {
 	return elem.Div(vecty.Text("No entities available"))
 }
 
-//EntityBlock renders a single entity card
+// EntityBlock renders a single entity card
 func EntityBlock(ID string, height int64) vecty.ComponentOrHTML {
 	return elem.Div(
 		vecty.Markup(vecty.Class("tile")),
@@ -16,7 +16,7 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/frontend/update"
 	"gitlab.com/vocdoni/vocexplorer/logger"
 	"gitlab.com/vocdoni/vocexplorer/util"
-	"go.vocdoni.io/dvote/crypto/nacl"
+	"gitlab.com/vocdoni/vocexplorer/vote"
 	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
 	"go.vocdoni.io/proto/build/go/models"
 )
@@ -94,7 +94,7 @@ func (c *EnvelopeContents) Render() vecty.ComponentOrHTML {
 	}
 	if len(keys) == len(store.Envelopes.CurrentEnvelope.EncryptionKeyIndexes) {
 		var err error
-		votePackage, err = unmarshalVote(store.Envelopes.CurrentEnvelope.VotePackage, keys)
+		votePackage, err = vote.Decode(store.Envelopes.CurrentEnvelope.VotePackage, keys)
 		if err != nil {
 			logger.Error(err)
 			decryptionStatus = "Unable to decode vote"
@@ -134,7 +134,7 @@ func UpdateEnvelopeContents(d *EnvelopeContents) {
 	dispatcher.Dispatch(&actions.SetCurrentEnvelope{Envelope: nil})
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
 	d.fetchEnvelope()
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
 	if !update.CheckCurrentPage("envelope", ticker) {
 		return
 	}
@@ -322,30 +322,6 @@ func (c *EnvelopeContents) renderVotePackage() vecty.ComponentOrHTML {
 	return nil
 }
 
-// From go-dvote keykeepercli.go
-func unmarshalVote(votePackage []byte, keys []string) (*indexertypes.VotePackage, error) {
-	var vote indexertypes.VotePackage
-	rawVote := make([]byte, len(votePackage))
-	copy(rawVote, votePackage)
-	// if encryption keys, decrypt the vote
-	if len(keys) > 0 {
-		for i := len(keys) - 1; i >= 0; i-- {
-			priv, err := nacl.DecodePrivate(keys[i])
-			if err != nil {
-				logger.Warn("cannot create private key cipher: " + err.Error())
-				continue
-			}
-			if rawVote, err = priv.Decrypt(rawVote); err != nil {
-				logger.Warn("cannot decrypt vote with key " + util.IntToString(i))
-			}
-		}
-	}
-	if err := json.Unmarshal(rawVote, &vote); err != nil {
-		return nil, fmt.Errorf("cannot unmarshal vote: %w", err)
-	}
-	return &vote, nil
-}
-
 func renderEnvelopeType(envelopeType *models.EnvelopeType) vecty.ComponentOrHTML {
 	if envelopeType == nil {
 		return vecty.Text("Envelope Type unavailable")
@@ -44,7 +44,7 @@ func (dash *DashboardView) Render() vecty.ComponentOrHTML {
 // UpdateHomeDashboard keeps the home dashboard data up to date
 func UpdateHomeDashboard(d *DashboardView) {
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
-	ticker := time.NewTicker(time.Duration(util.Max(store.Config.RefreshTime, 1)) * time.Second)
+	ticker := update.NewTicker(time.Duration(util.Max(store.Config.RefreshTime, 1)) * time.Second)
 	if !update.CheckCurrentPage("home", ticker) {
 		return
 	}
@@ -65,8 +65,8 @@ func UpdateHomeDashboard(d *DashboardView) {
 }
 
 func updateHomeDashboardInfo(d *DashboardView) {
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
-	stats, err := store.Client.GetStats()
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
+	stats, err := update.Stats()
 	if err != nil {
 		logger.Error(err)
 		return
@@ -77,7 +77,7 @@ func updateHomeDashboardInfo(d *DashboardView) {
 
 func updateHomeBlocks(d *DashboardView, index int) {
 	logger.Info("Getting blocks from index " + util.IntToString(index+1-config.ListSize))
-	list, err := store.Client.GetBlockList(index+1-config.ListSize, config.ListSize)
+	list, err := update.BlockList(index+1-config.ListSize, config.ListSize)
 	if err != nil {
 		logger.Error(err)
 		return
@@ -9,12 +9,12 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/util"
 )
 
-//Jumbotron is a component for an info banner of statistics
+// Jumbotron is a component for an info banner of statistics
 type Jumbotron struct {
 	vecty.Core
 }
 
-//JumboStatTitle renders the jumbotron statistic title
+// JumboStatTitle renders the jumbotron statistic title
 func JumboStatTitle(t string) vecty.ComponentOrHTML {
 	return elem.Div(
 		vecty.Markup(vecty.Class("stat-title")),
@@ -22,7 +22,7 @@ func JumboStatTitle(t string) vecty.ComponentOrHTML {
 	)
 }
 
-//JumboStatValue renders a jumbotron statistic contents
+// JumboStatValue renders a jumbotron statistic contents
 func JumboStatValue(v string) vecty.MarkupOrChild {
 	return elem.Div(
 		vecty.Markup(vecty.Class("stat-value")),
@@ -30,7 +30,7 @@ func JumboStatValue(v string) vecty.MarkupOrChild {
 	)
 }
 
-//Render renders the jumbotron component
+// Render renders the jumbotron component
 func (b *Jumbotron) Render() vecty.ComponentOrHTML {
 	colMarkup := vecty.Markup(vecty.Class("col-xs-12", "col-sm-4", "mb-2", "mb-sm-0"))
 	var items vecty.List
@@ -8,12 +8,12 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/frontend/store"
 )
 
-//LatestBlocksWidget is a component for a widget of recent blocks
+// LatestBlocksWidget is a component for a widget of recent blocks
 type LatestBlocksWidget struct {
 	vecty.Core
 }
 
-//Render renders the LatestBlocksWidget component
+// Render renders the LatestBlocksWidget component
 func (b *LatestBlocksWidget) Render() vecty.ComponentOrHTML {
 
 	var blockList []vecty.MarkupOrChild
@@ -8,8 +8,10 @@ import (
 	"github.com/hexops/vecty/elem"
 	"github.com/hexops/vecty/event"
 	"github.com/hexops/vecty/prop"
+	"gitlab.com/vocdoni/vocexplorer/config"
 	"gitlab.com/vocdoni/vocexplorer/frontend/actions"
 	"gitlab.com/vocdoni/vocexplorer/frontend/dispatcher"
+	"gitlab.com/vocdoni/vocexplorer/frontend/store"
 	router "marwan.io/vecty-router"
 )
 
@@ -126,26 +128,58 @@ func (n *NavBar) Render() vecty.ComponentOrHTML {
 						NavLink("/stats", "Stats"),
 					),
 				),
+				renderNetworkSwitcher(),
 				&SearchBar{},
 			),
 		),
 	)
 }
 
+// renderNetworkSwitcher renders the networks served, if more than one. Every network has
+// its own gateways and config, so switching reloads the explorer.
+func renderNetworkSwitcher() vecty.ComponentOrHTML {
+	networks := store.Config.Networks
+	if len(networks) < 2 {
+		return nil
+	}
+	options := vecty.List{}
+	for _, network := range networks {
+		options = append(options, elem.Option(
+			vecty.Markup(
+				prop.Value(network),
+				vecty.Property("selected", network == store.Config.Network),
+			),
+			vecty.Text(network),
+		))
+	}
+	return elem.Select(
+		vecty.Markup(
+			vecty.Class("custom-select", "network-switcher"),
+			vecty.Attribute("aria-label", "Vochain network"),
+			event.Change(func(e *vecty.Event) {
+				network := e.Target.Get("value").String()
+				js.Global().Get("location").Set("href", config.NetworkPrefix(network, networks[0])+"/")
+			}),
+		),
+		options,
+	)
+}
+
 // NavLink generates a Link with nav-link styling
 func NavLink(route, text string) *vecty.HTML {
 	return Link(route, text, "nav-link")
 }
 
-// Link renders a link which, when clicks, signals a redirect
+// Link renders a link which, when clicks, signals a redirect. The route is within the
+// routes of the network served.
 func Link(route, text, class string) *vecty.HTML {
 	attrs := []vecty.Applyer{
-		prop.Href(route),
+		prop.Href(store.Route(route)),
 		event.Click(
 			func(e *vecty.Event) {
 				dispatcher.Dispatch(&actions.SetCurrentPage{Page: ""})
 				dispatcher.Dispatch(&actions.SignalRedirect{})
-				router.Redirect(route)
+				router.Redirect(store.Route(route))
 			},
 		).PreventDefault(),
 	}
@@ -163,7 +197,7 @@ func Link(route, text, class string) *vecty.HTML {
 }
 
 func getActivePage() string {
-	path := js.Global().Get("location").Get("pathname").String()
+	path := strings.TrimPrefix(js.Global().Get("location").Get("pathname").String(), store.Config.Prefix)
 	active := ""
 	switch {
 	case strings.Contains(path, "block"):
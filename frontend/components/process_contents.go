@@ -17,8 +17,12 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/logger"
 	"gitlab.com/vocdoni/vocexplorer/util"
 	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
 )
 
+// resultsExportPath is the server endpoint prefix serving process results downloads
+const resultsExportPath = "/api/v1/processes/"
+
 // ProcessContentsView renders the processes dashboard page
 type ProcessContentsView struct {
 	vecty.Core
@@ -64,7 +68,7 @@ func (dash *ProcessContentsView) Render() vecty.ComponentOrHTML {
 	)
 }
 
-//ProcessDetails renders the details of a process
+// ProcessDetails renders the details of a process
 func (dash *ProcessContentsView) ProcessDetails() vecty.List {
 	results := store.Processes.ProcessResults[util.HexToString(store.Processes.CurrentProcess.Process.ID)]
 	if results.State == "" {
@@ -79,7 +83,8 @@ func (dash *ProcessContentsView) ProcessDetails() vecty.List {
 		),
 		elem.Heading2(vecty.Text(util.HexToString(store.Processes.CurrentProcess.Process.ID))),
 		elem.Div(
-			elem.Span(
+			// Networks without a link domain have no profile pages
+			vecty.If(store.ProcessURL != "", elem.Span(
 				vecty.Markup(vecty.Class("title")),
 				elem.Anchor(
 					vecty.Markup(
@@ -89,7 +94,7 @@ func (dash *ProcessContentsView) ProcessDetails() vecty.List {
 					vecty.Markup(vecty.Attribute("aria-label", "Link to process "+util.HexToString(store.Processes.CurrentProcess.Process.ID)+"'s profile page")),
 					vecty.Text("Process Profile"),
 				),
-			),
+			)),
 		),
 		elem.Div(
 			vecty.Markup(vecty.Class("badges")),
@@ -118,7 +123,7 @@ func (dash *ProcessContentsView) ProcessDetails() vecty.List {
 	}
 }
 
-//ProcessTab is a single tab of a process page
+// ProcessTab is a single tab of a process page
 type ProcessTab struct {
 	*Tab
 }
@@ -133,7 +138,7 @@ func (p *ProcessTab) store() string {
 	return store.Processes.Pagination.Tab
 }
 
-//ProcessTabs renders the tabs for a process
+// ProcessTabs renders the tabs for a process
 func (dash *ProcessContentsView) ProcessTabs() vecty.List {
 	results := &ProcessTab{&Tab{
 		Text:  "Results",
@@ -147,22 +152,31 @@ func (dash *ProcessContentsView) ProcessTabs() vecty.List {
 		Text:  "Details",
 		Alias: "details",
 	}}
+	verify := &ProcessTab{&Tab{
+		Text:  "Verify",
+		Alias: "verify",
+	}}
+	// Only ended processes have their final results and keys revealed
+	status := models.ProcessStatus(store.Processes.CurrentProcess.Process.Status)
+	ended := status == models.ProcessStatus_ENDED || status == models.ProcessStatus_RESULTS
 
 	return vecty.List{
 		elem.Navigation(
-			vecty.Markup(vecty.Attribute("aria-label", "Tab navigation: results, envelopes and details")),
+			vecty.Markup(vecty.Attribute("aria-label", "Tab navigation: results, envelopes, details and verify")),
 			vecty.Markup(vecty.Class("tabs")),
 			elem.UnorderedList(
 				TabLink(dash, results),
 				TabLink(dash, envelopes),
 				TabLink(dash, processDetails),
+				vecty.If(ended, TabLink(dash, verify)),
 			),
 		),
 		elem.Div(
 			vecty.Markup(vecty.Class("tabs-content")),
-			TabContents(results, renderResults(store.Processes.ProcessResults[util.HexToString(store.Processes.CurrentProcess.Process.ID)].Results)),
+			TabContents(results, renderResults(store.Processes.CurrentProcess.Process.ID, store.Processes.ProcessResults[util.HexToString(store.Processes.CurrentProcess.Process.ID)].Results)),
 			TabContents(envelopes, renderEnvelopes()),
 			TabContents(processDetails, renderProcessDetails(store.Processes.CurrentProcess.Process)),
+			TabContents(verify, &ProcessTallyView{PID: store.Processes.CurrentProcess.Process.ID}),
 		),
 	}
 }
@@ -194,7 +208,7 @@ func renderEnvelopes() vecty.ComponentOrHTML {
 	return &ProcessesEnvelopeListView{}
 }
 
-func renderResults(results [][]string) vecty.ComponentOrHTML {
+func renderResults(pid []byte, results [][]string) vecty.ComponentOrHTML {
 	if len(results) <= 0 {
 		return elem.Preformatted(
 			vecty.Markup(vecty.Class("empty")),
@@ -217,9 +231,36 @@ func renderResults(results [][]string) vecty.ComponentOrHTML {
 		))
 	}
 
+	return vecty.List{
+		elem.Div(
+			vecty.Markup(vecty.Class("poll-results")),
+			content,
+		),
+		renderResultsExport(pid),
+	}
+}
+
+// renderResultsExport renders the links to download the results of process pid
+func renderResultsExport(pid []byte) vecty.ComponentOrHTML {
+	url := store.Route(resultsExportPath) + util.HexToString(pid) + "/results/export?format="
 	return elem.Div(
-		vecty.Markup(vecty.Class("poll-results")),
-		content,
+		vecty.Markup(vecty.Class("results-export")),
+		elem.Anchor(
+			vecty.Markup(
+				vecty.Attribute("href", url+"csv"),
+				vecty.Attribute("download", ""),
+				vecty.Attribute("aria-label", "Download results as CSV"),
+			),
+			vecty.Text("Download CSV"),
+		),
+		elem.Anchor(
+			vecty.Markup(
+				vecty.Attribute("href", url+"json"),
+				vecty.Attribute("download", ""),
+				vecty.Attribute("aria-label", "Download results as JSON"),
+			),
+			vecty.Text("Download JSON"),
+		),
 	)
 }
 
@@ -238,7 +279,7 @@ func renderProcessDetails(process *indexertypes.Process) vecty.ComponentOrHTML {
 func UpdateProcessContents(d *ProcessContentsView, pid []byte) {
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
 	d.fetchProcess(pid)
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime)*5*time.Second, pid)
 	if !update.CheckCurrentPage("process", ticker) {
 		return
 	}
@@ -254,8 +295,8 @@ func UpdateProcessContents(d *ProcessContentsView, pid []byte) {
 			if !update.CheckCurrentPage("process", ticker) {
 				return
 			}
-			// If process never loaded, load it
-			if d.Unavailable {
+			// If process never loaded or it just changed, load it
+			if d.Unavailable || ticker.ProcessChanged() {
 				d.fetchProcess(pid)
 			}
 			updateProcessContents(d)
@@ -319,7 +360,7 @@ func updateProcessContents(d *ProcessContentsView) {
 	if !store.Envelopes.Pagination.DisableUpdate && store.Processes.CurrentProcess.EnvelopeCount > 0 {
 		updateProcessEnvelopes(d, store.Processes.CurrentProcess.EnvelopeCount-store.Processes.EnvelopePagination.Index-config.ListSize)
 	}
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 }
 
 func updateProcessEnvelopes(d *ProcessContentsView, index int) {
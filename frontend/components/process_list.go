@@ -60,7 +60,7 @@ func renderProcessItems() []vecty.MarkupOrChild {
 	return elemList
 }
 
-//ProcessBlock renders a single process card
+// ProcessBlock renders a single process card
 func ProcessBlock(process *storeutil.Process) vecty.ComponentOrHTML {
 	// Assume we only have access to process metadata: state, type, envelope height, enitity id
 	if process == nil {
@@ -0,0 +1,182 @@
+package components
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+	"gitlab.com/vocdoni/vocexplorer/logger"
+	"gitlab.com/vocdoni/vocexplorer/tally"
+	"gitlab.com/vocdoni/vocexplorer/util"
+)
+
+// maxTallyErrors is the number of uncounted envelopes listed in the verification report
+const maxTallyErrors = 20
+
+// ProcessTallyView shows the results of an ended process recomputed by the server from its
+// envelopes, compared with the results reported by the gateway
+type ProcessTallyView struct {
+	vecty.Core
+	PID []byte `vecty:"prop"`
+
+	verifying bool
+	verified  []byte
+	report    *tally.Report
+	err       error
+	// cancel stops waiting for the report once the component is unmounted
+	cancel context.CancelFunc
+}
+
+// Unmount stops waiting for the report
+func (v *ProcessTallyView) Unmount() {
+	if v.cancel != nil {
+		v.cancel()
+	}
+}
+
+// Render renders the ProcessTallyView component
+func (v *ProcessTallyView) Render() vecty.ComponentOrHTML {
+	// Forget the report of a previously open process
+	if v.report != nil && util.HexToString(v.verified) != util.HexToString(v.PID) {
+		v.report, v.err = nil, nil
+	}
+	button := elem.Button(
+		vecty.Markup(
+			vecty.Class("verify-button"),
+			vecty.Property("disabled", v.verifying),
+			event.Click(func(e *vecty.Event) {
+				v.verify()
+			}),
+		),
+		vecty.Text("Verify results"),
+	)
+	var contents vecty.ComponentOrHTML
+	switch {
+	case v.verifying:
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Fetching and tallying every envelope..."),
+		)
+	case v.err != nil:
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Unable to verify results: "+v.err.Error()),
+		)
+	case v.report != nil:
+		contents = renderTallyReport(v.report)
+	default:
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Decrypts every envelope with the revealed keys and recounts the votes"),
+		)
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Class("process-tally")),
+		button,
+		contents,
+	)
+}
+
+func (v *ProcessTallyView) verify() {
+	if v.verifying {
+		return
+	}
+	v.verifying = true
+	v.report, v.err = nil, nil
+	pid := v.PID
+	ctx, cancel := context.WithCancel(context.Background())
+	v.cancel = cancel
+	vecty.Rerender(v)
+	go func() {
+		defer cancel()
+		report := new(tally.Report)
+		err := fetchReport(ctx, "/api/v1/processes/"+util.HexToString(pid)+"/verify", report)
+		if ctx.Err() != nil {
+			// The component is gone
+			return
+		}
+		if err != nil {
+			logger.Error(err)
+			report = nil
+		}
+		v.verifying = false
+		v.verified, v.report, v.err = pid, report, err
+		vecty.Rerender(v)
+	}()
+}
+
+func renderTallyReport(report *tally.Report) vecty.ComponentOrHTML {
+	var status string
+	switch report.Status {
+	case tally.StatusMatch:
+		status = "Results verified: the recomputed tally matches the reported results"
+	case tally.StatusMismatch:
+		status = fmt.Sprintf("Results mismatch: %d options differ from the reported results", len(report.Mismatches))
+	default:
+		status = fmt.Sprintf("Verification incomplete: %d envelopes could not be decoded", report.Undecoded)
+	}
+
+	mismatches := vecty.List{}
+	for _, m := range report.Mismatches {
+		mismatches = append(mismatches, elem.TableRow(
+			elem.TableData(vecty.Text(util.IntToString(m.Question))),
+			elem.TableData(vecty.Text(util.IntToString(m.Option))),
+			elem.TableData(vecty.Text(m.Reported)),
+			elem.TableData(vecty.Text(m.Computed)),
+		))
+	}
+	errors := vecty.List{}
+	for i, e := range report.Errors {
+		if i == maxTallyErrors {
+			errors = append(errors, elem.ListItem(
+				vecty.Text(fmt.Sprintf("and %d more", len(report.Errors)-maxTallyErrors)),
+			))
+			break
+		}
+		errors = append(errors, elem.ListItem(
+			Link("/envelope/"+e.Nullifier, e.Nullifier, ""),
+			vecty.Text(": "+e.Error),
+		))
+	}
+
+	return vecty.List{
+		elem.Span(
+			vecty.Markup(vecty.Class("badge", report.Status)),
+			vecty.Text(status),
+		),
+		elem.DescriptionList(
+			elem.DefinitionTerm(vecty.Text("Envelopes")),
+			elem.Description(vecty.Text(util.IntToString(report.Envelopes))),
+			elem.DefinitionTerm(vecty.Text("Counted")),
+			elem.Description(vecty.Text(util.IntToString(report.Counted))),
+			elem.DefinitionTerm(vecty.Text("Invalid")),
+			elem.Description(vecty.Text(util.IntToString(report.Invalid))),
+			elem.DefinitionTerm(vecty.Text("Undecoded")),
+			elem.Description(vecty.Text(util.IntToString(report.Undecoded))),
+		),
+		vecty.If(len(mismatches) > 0, elem.Table(
+			vecty.Markup(
+				vecty.Class("table"),
+				vecty.Attribute("aria-label", "Table of options whose recomputed votes differ from the reported results."),
+			),
+			elem.TableHead(
+				elem.TableRow(
+					elem.TableHeader(vecty.Text("Field")),
+					elem.TableHeader(vecty.Text("Option")),
+					elem.TableHeader(vecty.Text("Reported")),
+					elem.TableHeader(vecty.Text("Recomputed")),
+				),
+			),
+			elem.TableBody(mismatches),
+		)),
+		vecty.If(len(errors) > 0, elem.Div(
+			elem.Span(
+				vecty.Markup(vecty.Class("detail")),
+				vecty.Text("Envelopes not counted"),
+			),
+			elem.UnorderedList(errors),
+		)),
+	}
+}
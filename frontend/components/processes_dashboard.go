@@ -63,7 +63,7 @@ func UpdateProcessesDashboard(d *ProcessesDashboardView) {
 	dispatcher.Dispatch(&actions.SetProcessResultsFilter{})
 	dispatcher.Dispatch(&actions.SetProcessNamespaceFilter{})
 
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
 	updateProcesses(d)
 	for {
 
@@ -123,7 +123,7 @@ func UpdateProcessesDashboard(d *ProcessesDashboardView) {
 
 func updateProcesses(d *ProcessesDashboardView) {
 	if !store.Processes.Pagination.DisableUpdate {
-		stats, err := store.Client.GetStats()
+		stats, err := update.Stats()
 		if err != nil {
 			logger.Error(err)
 			return
@@ -131,7 +131,7 @@ func updateProcesses(d *ProcessesDashboardView) {
 		actions.UpdateCounts(stats)
 		getProcesses(d, store.Processes.Count-store.Processes.Pagination.Index-config.ListSize)
 	}
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 }
 
 func getProcesses(d *ProcessesDashboardView, index int) {
@@ -141,7 +141,7 @@ func getProcesses(d *ProcessesDashboardView, index int) {
 		index = 0
 	}
 	logger.Info(fmt.Sprintf("Getting %d processes from index %d\n", listSize, index))
-	list, err := store.Client.GetProcessList([]byte{}, "", 0, "", false, "", index, listSize)
+	list, err := update.ProcessList(nil, index, listSize)
 	if err != nil {
 		logger.Error(err)
 		return
@@ -156,7 +156,7 @@ func fetchProcessMetas(list []string) {
 		if processId == "" {
 			break
 		}
-		summary, err := store.Client.GetProcessSummary(util.StringToHex(processId))
+		summary, err := update.ProcessSummary(util.StringToHex(processId))
 		if err != nil {
 			logger.Error(err)
 		}
@@ -8,15 +8,16 @@ import (
 	"github.com/hexops/vecty/event"
 	"gitlab.com/vocdoni/vocexplorer/frontend/actions"
 	"gitlab.com/vocdoni/vocexplorer/frontend/dispatcher"
+	"gitlab.com/vocdoni/vocexplorer/frontend/store"
 	router "marwan.io/vecty-router"
 )
 
-//SearchBar is a component for a search bar
+// SearchBar is a component for a search bar
 type SearchBar struct {
 	vecty.Core
 }
 
-//Render renders the SearchBar component
+// Render renders the SearchBar component
 func (s *SearchBar) Render() vecty.ComponentOrHTML {
 	return elem.Div(
 		elem.Input(
@@ -36,7 +37,7 @@ func (s *SearchBar) Render() vecty.ComponentOrHTML {
 				}
 				dispatcher.Dispatch(&actions.SetCurrentPage{Page: ""})
 				dispatcher.Dispatch(&actions.SignalRedirect{})
-				router.Redirect("/search/" + search)
+				router.Redirect(store.Route("/search/" + search))
 			}),
 			),
 		),
@@ -0,0 +1,59 @@
+package components
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/frontend/store"
+)
+
+// reportRetryAfter is the time waited before asking again for a report still being
+// computed, when the server doesn't tell
+const reportRetryAfter = 5 * time.Second
+
+// fetchReport gets the report computed by the server at path into v. While the server
+// answers it's still computing the report, it asks again once told to, until ctx is done.
+func fetchReport(ctx context.Context, path string, v interface{}) error {
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, store.Route(path), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			err := json.NewDecoder(resp.Body).Decode(v)
+			resp.Body.Close()
+			return err
+		case http.StatusAccepted:
+			resp.Body.Close()
+			wait := reportRetryAfter
+			if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+				wait = time.Duration(s) * time.Second
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		default:
+			var apiErr struct {
+				Error string `json:"error"`
+			}
+			json.NewDecoder(resp.Body).Decode(&apiErr)
+			resp.Body.Close()
+			if apiErr.Error != "" {
+				return errors.New(apiErr.Error)
+			}
+			return fmt.Errorf("server returned %s", resp.Status)
+		}
+	}
+}
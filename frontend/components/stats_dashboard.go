@@ -35,13 +35,14 @@ func (dash *StatsDashboardView) Render() vecty.ComponentOrHTML {
 		vecty.Markup(vecty.Attribute("id", "main")),
 		renderServerConnectionBanner(),
 		&BlockchainInfo{header: true},
+		&StatsHistoryView{},
 	)
 }
 
 // UpdateStatsDashboard keeps the stats dashboard updated
 func UpdateStatsDashboard(d *StatsDashboardView) {
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
 	if !update.CheckCurrentPage("stats", ticker) {
 		return
 	}
@@ -62,9 +63,9 @@ func UpdateStatsDashboard(d *StatsDashboardView) {
 }
 
 func updateStatsDashboard(d *StatsDashboardView) {
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 
-	stats, err := store.Client.GetStats()
+	stats, err := update.Stats()
 	if err != nil {
 		logger.Error(err)
 		return
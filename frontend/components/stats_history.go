@@ -0,0 +1,222 @@
+package components
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+	"gitlab.com/vocdoni/vocexplorer/frontend/bootstrap"
+	"gitlab.com/vocdoni/vocexplorer/frontend/store"
+	"gitlab.com/vocdoni/vocexplorer/history/historytypes"
+	"gitlab.com/vocdoni/vocexplorer/logger"
+	"gitlab.com/vocdoni/vocexplorer/util"
+)
+
+// statsHistoryPath is the server endpoint returning the sampled chain stats
+const statsHistoryPath = "/api/v1/stats/history"
+
+// historyChart is a stat charted from the samples. Counters chart their increase between
+// two samples, every other stat its value.
+type historyChart struct {
+	title   string
+	counter bool
+	value   func(s historytypes.Sample) int64
+	format  func(v int64) string
+}
+
+var historyCharts = []historyChart{
+	{"Blocks", true, func(s historytypes.Sample) int64 { return int64(s.Height) }, humanize.Comma},
+	{"Transactions", true, func(s historytypes.Sample) int64 { return int64(s.Transactions) }, humanize.Comma},
+	{"Vote envelopes", true, func(s historytypes.Sample) int64 { return int64(s.Envelopes) }, humanize.Comma},
+	{"Processes", true, func(s historytypes.Sample) int64 { return s.Processes }, humanize.Comma},
+	{"Entities", true, func(s historytypes.Sample) int64 { return s.Entities }, humanize.Comma},
+	{"Validators", false, func(s historytypes.Sample) int64 { return int64(s.Validators) }, humanize.Comma},
+	{"Block time", false, func(s historytypes.Sample) int64 { return int64(s.BlockTime) }, func(v int64) string { return util.MsToString(int32(v)) }},
+}
+
+// StatsHistoryView charts the chain stats sampled by the server over a selectable range
+type StatsHistoryView struct {
+	vecty.Core
+
+	rng      string
+	loading  bool
+	loaded   string
+	series   *historytypes.Series
+	disabled bool
+	err      error
+}
+
+// Render renders the StatsHistoryView component
+func (v *StatsHistoryView) Render() vecty.ComponentOrHTML {
+	if v.rng == "" {
+		v.rng = historytypes.RangeDay
+	}
+	if v.loaded != v.rng && !v.loading {
+		v.load()
+	}
+	if v.disabled {
+		return elem.Div()
+	}
+
+	ranges := vecty.List{}
+	for _, rng := range historytypes.Ranges {
+		rng := rng
+		ranges = append(ranges, elem.Button(
+			vecty.Markup(
+				vecty.Class("range-button"),
+				vecty.MarkupIf(rng == v.rng, vecty.Class("active")),
+				event.Click(func(e *vecty.Event) {
+					v.rng = rng
+					vecty.Rerender(v)
+				}),
+			),
+			vecty.Text(strings.Title(rng)),
+		))
+	}
+
+	var contents vecty.ComponentOrHTML
+	switch {
+	case v.loading || v.loaded != v.rng:
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Loading stats historytypes..."),
+		)
+	case v.err != nil:
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Stats history unavailable: "+v.err.Error()),
+		)
+	case len(v.series.Samples) < 2:
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Not enough stats sampled in this range yet"),
+		)
+	default:
+		charts := vecty.List{}
+		for _, c := range historyCharts {
+			charts = append(charts, renderHistoryChart(c, v.series.Samples))
+		}
+		contents = elem.Div(
+			vecty.Markup(vecty.Class("row")),
+			charts,
+		)
+	}
+
+	return elem.Section(
+		vecty.Markup(vecty.Class("stats-history")),
+		bootstrap.Card(bootstrap.CardParams{
+			Body: vecty.List{
+				elem.Heading2(vecty.Text("Stats history")),
+				elem.Div(
+					vecty.Markup(vecty.Class("ranges")),
+					ranges,
+				),
+				contents,
+			},
+		}),
+	)
+}
+
+func (v *StatsHistoryView) load() {
+	v.loading = true
+	rng := v.rng
+	go func() {
+		series, disabled, err := fetchStatsHistory(rng)
+		if err != nil {
+			logger.Error(err)
+		}
+		v.loading = false
+		v.loaded, v.series, v.disabled, v.err = rng, series, disabled, err
+		vecty.Rerender(v)
+	}()
+}
+
+// fetchStatsHistory gets the series of rng from the server, returning disabled if the
+// server doesn't record the stats history
+func fetchStatsHistory(rng string) (series *historytypes.Series, disabled bool, err error) {
+	resp, err := http.Get(store.Route(statsHistoryPath) + "?range=" + rng)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("server returned %s", resp.Status)
+	}
+	series = new(historytypes.Series)
+	if err := json.NewDecoder(resp.Body).Decode(series); err != nil {
+		return nil, false, err
+	}
+	return series, false, nil
+}
+
+func renderHistoryChart(c historyChart, samples []historytypes.Sample) vecty.ComponentOrHTML {
+	first, last := samples[0], samples[len(samples)-1]
+	type point struct {
+		time  time.Time
+		value int64
+	}
+	points := make([]point, 0, len(samples))
+	for i, s := range samples {
+		if !c.counter {
+			points = append(points, point{s.Time, c.value(s)})
+		} else if i > 0 {
+			points = append(points, point{s.Time, c.value(s) - c.value(samples[i-1])})
+		}
+	}
+	var max int64
+	for _, p := range points {
+		if p.value > max {
+			max = p.value
+		}
+	}
+
+	var summary string
+	if c.counter {
+		summary = fmt.Sprintf("%s, +%s in range", c.format(c.value(last)), c.format(c.value(last)-c.value(first)))
+	} else {
+		summary = c.format(c.value(last))
+	}
+	columns := vecty.List{}
+	for _, p := range points {
+		height := 0.0
+		if max > 0 && p.value > 0 {
+			height = float64(p.value) * 100 / float64(max)
+		}
+		columns = append(columns, elem.Div(
+			vecty.Markup(
+				vecty.Class("column"),
+				vecty.Style("height", fmt.Sprintf("%.1f%%", height)),
+				vecty.Attribute("title", fmt.Sprintf("%s: %s", p.time.Local().Format("Jan _2 15:04"), c.format(p.value))),
+			),
+		))
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Class("col-12", "col-md-6", "history-chart")),
+		elem.Heading4(vecty.Text(c.title)),
+		elem.Span(
+			vecty.Markup(vecty.Class("detail")),
+			vecty.Text(summary),
+		),
+		elem.Div(
+			vecty.Markup(
+				vecty.Class("chart"),
+				vecty.Attribute("aria-label", "Chart of "+strings.ToLower(c.title)+" over time."),
+			),
+			columns,
+		),
+		elem.Div(
+			vecty.Markup(vecty.Class("axis")),
+			elem.Span(vecty.Text(first.Time.Local().Format("Jan _2 15:04"))),
+			elem.Span(vecty.Text(last.Time.Local().Format("Jan _2 15:04"))),
+		),
+	)
+}
@@ -53,7 +53,7 @@ func (dash *TransactionsDashboardView) Render() vecty.ComponentOrHTML {
 func UpdateTransactionsDashboard(d *TransactionsDashboardView) {
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
 
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
 	if !update.CheckCurrentPage("transactions", ticker) {
 		return
 	}
@@ -91,7 +91,7 @@ func UpdateTransactionsDashboard(d *TransactionsDashboardView) {
 
 func updateTransactionsDashboard(d *TransactionsDashboardView) {
 	if !store.Transactions.Pagination.DisableUpdate {
-		stats, err := store.Client.GetStats()
+		stats, err := update.Stats()
 		if err != nil {
 			logger.Error(err)
 			return
@@ -99,7 +99,7 @@ func updateTransactionsDashboard(d *TransactionsDashboardView) {
 		actions.UpdateCounts(stats)
 		updateTransactions(d, int(store.Transactions.Count)-store.Transactions.Pagination.Index-config.ListSize+1)
 	}
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 }
 
 func updateTransactions(d *TransactionsDashboardView, index int) {
@@ -111,7 +111,7 @@ func updateTransactions(d *TransactionsDashboardView, index int) {
 	logger.Info(fmt.Sprintf("Getting %d Transactions from index %d\n", listSize, index))
 	list := []*storeutil.FullTransaction{}
 	for i := 0; i < listSize; i++ {
-		tx, err := store.Client.GetTxByID(uint32(index + i))
+		tx, err := update.TxByID(uint32(index + i))
 		if err != nil {
 			logger.Error(err)
 		}
@@ -81,7 +81,7 @@ func (t *TxContents) Render() vecty.ComponentOrHTML {
 		contents)
 }
 
-//TransactionView renders a single transaction card with (most of) the tx information
+// TransactionView renders a single transaction card with (most of) the tx information
 func TransactionView() vecty.List {
 	contents := vecty.List{
 		elem.Heading1(
@@ -227,7 +227,7 @@ func UpdateTxContents(d *TxContents, blockHeight uint32, index int32) {
 	dispatcher.Dispatch(&actions.SetCurrentTransaction{Transaction: nil})
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
 	d.fetchTransaction(blockHeight, index)
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * time.Second)
 	if !update.CheckCurrentPage("tx", ticker) {
 		return
 	}
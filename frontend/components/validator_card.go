@@ -11,7 +11,7 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/util"
 )
 
-//ValidatorCard renders a single validator card
+// ValidatorCard renders a single validator card
 func ValidatorCard(validator *models.Validator) vecty.ComponentOrHTML {
 	vLink := func(text string) vecty.ComponentOrHTML {
 		return Link(
@@ -12,6 +12,7 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/frontend/bootstrap"
 	"gitlab.com/vocdoni/vocexplorer/frontend/dispatcher"
 	"gitlab.com/vocdoni/vocexplorer/frontend/store"
+	"gitlab.com/vocdoni/vocexplorer/frontend/update"
 	"gitlab.com/vocdoni/vocexplorer/logger"
 	"gitlab.com/vocdoni/vocexplorer/util"
 )
@@ -57,6 +58,7 @@ func (contents *ValidatorContents) Render() vecty.ComponentOrHTML {
 					bootstrap.Card(bootstrap.CardParams{
 						Body: ValidatorView(),
 					}),
+					&ValidatorProposalsView{Address: util.HexToString(store.Validators.CurrentValidator.Address)},
 				),
 			),
 		),
@@ -67,7 +69,7 @@ func (contents *ValidatorContents) Render() vecty.ComponentOrHTML {
 func (contents *ValidatorContents) UpdateValidatorContents() {
 	dispatcher.Dispatch(&actions.SetCurrentValidator{Validator: nil})
 
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
 	validators, err := store.Client.GetValidatorList()
 	var currentValidator *models.Validator
 	if err != nil {
@@ -0,0 +1,383 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+	"gitlab.com/vocdoni/vocexplorer/analytics"
+	"gitlab.com/vocdoni/vocexplorer/frontend/bootstrap"
+	"gitlab.com/vocdoni/vocexplorer/logger"
+	"gitlab.com/vocdoni/vocexplorer/util"
+)
+
+// leaderboardColumn is a sortable column of the validator leaderboard
+type leaderboardColumn struct {
+	title string
+	less  func(a, b *analytics.ValidatorStats) bool
+	value func(v *analytics.ValidatorStats) vecty.ComponentOrHTML
+}
+
+var leaderboardColumns = []leaderboardColumn{
+	{
+		"Validator",
+		func(a, b *analytics.ValidatorStats) bool { return validatorName(a) < validatorName(b) },
+		func(v *analytics.ValidatorStats) vecty.ComponentOrHTML {
+			return Link("/validator/"+v.Address, validatorName(v), "")
+		},
+	},
+	{
+		"Voting power",
+		func(a, b *analytics.ValidatorStats) bool { return a.Power < b.Power },
+		func(v *analytics.ValidatorStats) vecty.ComponentOrHTML {
+			return vecty.Text(humanize.Comma(int64(v.Power)))
+		},
+	},
+	{
+		"Proposed",
+		func(a, b *analytics.ValidatorStats) bool { return a.Proposed < b.Proposed },
+		func(v *analytics.ValidatorStats) vecty.ComponentOrHTML {
+			return vecty.Text(humanize.Comma(int64(v.Proposed)))
+		},
+	},
+	{
+		"Share",
+		func(a, b *analytics.ValidatorStats) bool { return a.Share < b.Share },
+		func(v *analytics.ValidatorStats) vecty.ComponentOrHTML { return vecty.Text(percent(v.Share)) },
+	},
+	{
+		"Expected share",
+		func(a, b *analytics.ValidatorStats) bool { return a.ExpectedShare < b.ExpectedShare },
+		func(v *analytics.ValidatorStats) vecty.ComponentOrHTML { return vecty.Text(percent(v.ExpectedShare)) },
+	},
+	{
+		"Last proposed",
+		func(a, b *analytics.ValidatorStats) bool { return a.LastProposed < b.LastProposed },
+		func(v *analytics.ValidatorStats) vecty.ComponentOrHTML { return renderLastProposed(v) },
+	},
+	{
+		"Missed streak (est.)",
+		func(a, b *analytics.ValidatorStats) bool { return a.EstimatedMissedStreak < b.EstimatedMissedStreak },
+		func(v *analytics.ValidatorStats) vecty.ComponentOrHTML {
+			return vecty.Text("~" + util.IntToString(v.EstimatedMissedStreak))
+		},
+	},
+	{
+		"Longest missed streak (est.)",
+		func(a, b *analytics.ValidatorStats) bool {
+			return a.EstimatedLongestMissedStreak < b.EstimatedLongestMissedStreak
+		},
+		func(v *analytics.ValidatorStats) vecty.ComponentOrHTML {
+			return vecty.Text("~" + util.IntToString(v.EstimatedLongestMissedStreak))
+		},
+	},
+}
+
+// validatorStatsLoader fetches the validator stats over a selectable window of blocks
+type validatorStatsLoader struct {
+	// address is the validator whose proposal history is fetched along, if any
+	address string
+	window  int
+	loading bool
+	loaded  int
+	report  *analytics.ValidatorReport
+	err     error
+	// cancel stops waiting for the stats once the component is unmounted
+	cancel context.CancelFunc
+}
+
+// load fetches the stats if the window changed, rerendering c once they're ready.
+// It returns true while they're being fetched.
+func (l *validatorStatsLoader) load(c vecty.Component) bool {
+	if l.window == 0 {
+		l.window = analytics.DefaultValidatorWindow
+	}
+	if l.loaded != l.window && !l.loading {
+		l.loading = true
+		window := l.window
+		ctx, cancel := context.WithCancel(context.Background())
+		l.cancel = cancel
+		go func() {
+			defer cancel()
+			report, err := l.fetch(ctx, window)
+			if ctx.Err() != nil {
+				// The component is gone
+				return
+			}
+			if err != nil {
+				logger.Error(err)
+				report = nil
+			}
+			l.loading = false
+			l.loaded, l.report, l.err = window, report, err
+			vecty.Rerender(c)
+		}()
+	}
+	return l.loading || l.loaded != l.window
+}
+
+// fetch gets the stats over window blocks computed by the server, and the proposal history
+// of address, which the stats of every validator leave out
+func (l *validatorStatsLoader) fetch(ctx context.Context, window int) (*analytics.ValidatorReport, error) {
+	query := "?window=" + util.IntToString(window)
+	report := new(analytics.ValidatorReport)
+	if err := fetchReport(ctx, "/api/v1/validators/stats"+query, report); err != nil {
+		return nil, err
+	}
+	if l.address == "" {
+		return report, nil
+	}
+	stats := report.Find(util.StringToHex(l.address))
+	if stats == nil {
+		return report, nil
+	}
+	return report, fetchReport(ctx, "/api/v1/validators/"+util.TrimHex(l.address)+"/stats"+query, stats)
+}
+
+// stop stops waiting for the stats
+func (l *validatorStatsLoader) stop() {
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
+
+// renderWindows renders the buttons selecting the window, rerendering c on clicks
+func (l *validatorStatsLoader) renderWindows(c vecty.Component) vecty.ComponentOrHTML {
+	buttons := vecty.List{}
+	for _, window := range analytics.ValidatorWindows {
+		window := window
+		buttons = append(buttons, elem.Button(
+			vecty.Markup(
+				vecty.Class("range-button"),
+				vecty.MarkupIf(window == l.window, vecty.Class("active")),
+				event.Click(func(e *vecty.Event) {
+					l.window = window
+					vecty.Rerender(c)
+				}),
+			),
+			vecty.Text(humanize.Comma(int64(window))+" blocks"),
+		))
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Class("ranges")),
+		buttons,
+	)
+}
+
+// ValidatorLeaderboardView ranks the validators by their block proposals over a selectable
+// window of blocks, sortable by any column
+type ValidatorLeaderboardView struct {
+	vecty.Core
+
+	stats validatorStatsLoader
+	// sortColumn is the index of the column sorting the rows, descending unless ascending
+	// is set, and sorted is set once it's been defaulted
+	sorted     bool
+	sortColumn int
+	ascending  bool
+}
+
+// Unmount stops waiting for the stats
+func (v *ValidatorLeaderboardView) Unmount() {
+	v.stats.stop()
+}
+
+// Render renders the ValidatorLeaderboardView component
+func (v *ValidatorLeaderboardView) Render() vecty.ComponentOrHTML {
+	if !v.sorted {
+		// Default to the most proposed blocks first
+		v.sorted, v.sortColumn = true, 2
+	}
+	var contents vecty.ComponentOrHTML
+	switch {
+	case v.stats.load(v):
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Walking the latest blocks..."),
+		)
+	case v.stats.err != nil:
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Validator stats unavailable: "+v.stats.err.Error()),
+		)
+	default:
+		contents = v.renderTable()
+	}
+	return elem.Section(
+		vecty.Markup(vecty.Class("validator-stats")),
+		bootstrap.Card(bootstrap.CardParams{
+			Body: vecty.List{
+				elem.Heading2(vecty.Text("Block proposals")),
+				v.stats.renderWindows(v),
+				contents,
+			},
+		}),
+	)
+}
+
+func (v *ValidatorLeaderboardView) renderTable() vecty.ComponentOrHTML {
+	report := v.stats.report
+	validators := make([]*analytics.ValidatorStats, len(report.Validators))
+	copy(validators, report.Validators)
+	less := leaderboardColumns[v.sortColumn].less
+	sort.SliceStable(validators, func(i, j int) bool {
+		if v.ascending {
+			return less(validators[i], validators[j])
+		}
+		return less(validators[j], validators[i])
+	})
+
+	headers := vecty.List{}
+	for i, column := range leaderboardColumns {
+		i, title := i, column.title
+		if i == v.sortColumn {
+			if v.ascending {
+				title += " ▲"
+			} else {
+				title += " ▼"
+			}
+		}
+		headers = append(headers, elem.TableHeader(
+			vecty.Markup(
+				vecty.Class("sortable"),
+				event.Click(func(e *vecty.Event) {
+					if i == v.sortColumn {
+						v.ascending = !v.ascending
+					} else {
+						v.sortColumn, v.ascending = i, false
+					}
+					vecty.Rerender(v)
+				}),
+			),
+			vecty.Text(title),
+		))
+	}
+	rows := vecty.List{}
+	for _, validator := range validators {
+		cells := vecty.List{}
+		for _, column := range leaderboardColumns {
+			cells = append(cells, elem.TableData(column.value(validator)))
+		}
+		rows = append(rows, elem.TableRow(
+			vecty.Markup(vecty.MarkupIf(!validator.Active, vecty.Class("inactive"))),
+			cells,
+		))
+	}
+	return vecty.List{
+		elem.Paragraph(vecty.Text(fmt.Sprintf("Blocks %d to %d. Missed streaks are estimates: the blocks proposed by others since the last block of the validator, times its share of the voting power, since blocks don't record the proposal turns missed.",
+			report.FromBlock, report.ToBlock))),
+		elem.Div(
+			vecty.Markup(vecty.Class("table-responsive")),
+			elem.Table(
+				vecty.Markup(
+					vecty.Class("table"),
+					vecty.Attribute("aria-label", "Table of the blocks proposed by every validator, click a header to sort it."),
+				),
+				elem.TableHead(elem.TableRow(headers)),
+				elem.TableBody(rows),
+			),
+		),
+	}
+}
+
+// ValidatorProposalsView renders the block proposals of a validator over a selectable window
+// of blocks, and the latest blocks it proposed
+type ValidatorProposalsView struct {
+	vecty.Core
+	Address string `vecty:"prop"`
+
+	stats validatorStatsLoader
+}
+
+// Unmount stops waiting for the stats
+func (v *ValidatorProposalsView) Unmount() {
+	v.stats.stop()
+}
+
+// Render renders the ValidatorProposalsView component
+func (v *ValidatorProposalsView) Render() vecty.ComponentOrHTML {
+	v.stats.address = v.Address
+	var contents vecty.ComponentOrHTML
+	switch {
+	case v.stats.load(v):
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Walking the latest blocks..."),
+		)
+	case v.stats.err != nil:
+		contents = elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text("Validator stats unavailable: "+v.stats.err.Error()),
+		)
+	default:
+		contents = renderValidatorProposals(v.stats.report, v.stats.report.Find(util.StringToHex(v.Address)))
+	}
+	return elem.Section(
+		vecty.Markup(vecty.Class("validator-stats")),
+		bootstrap.Card(bootstrap.CardParams{
+			Body: vecty.List{
+				elem.Heading2(vecty.Text("Block proposals")),
+				v.stats.renderWindows(v),
+				contents,
+			},
+		}),
+	)
+}
+
+func renderValidatorProposals(report *analytics.ValidatorReport, stats *analytics.ValidatorStats) vecty.ComponentOrHTML {
+	if stats == nil || stats.Proposed == 0 {
+		return elem.Preformatted(
+			vecty.Markup(vecty.Class("empty")),
+			vecty.Text(fmt.Sprintf("No blocks proposed from block %d to %d", report.FromBlock, report.ToBlock)),
+		)
+	}
+	history := vecty.List{}
+	for _, height := range stats.History {
+		history = append(history, elem.ListItem(
+			Link("/block/"+util.IntToString(height), "Block "+humanize.Comma(int64(height)), ""),
+		))
+	}
+	return vecty.List{
+		elem.DescriptionList(
+			elem.DefinitionTerm(vecty.Text("Blocks proposed")),
+			elem.Description(vecty.Text(fmt.Sprintf("%s of %s, from block %d to %d",
+				humanize.Comma(int64(stats.Proposed)), humanize.Comma(int64(report.Blocks)), report.FromBlock, report.ToBlock))),
+			elem.DefinitionTerm(vecty.Text("Share of proposals")),
+			elem.Description(vecty.Text(fmt.Sprintf("%s, %s expected from its voting power",
+				percent(stats.Share), percent(stats.ExpectedShare)))),
+			elem.DefinitionTerm(vecty.Text("Last proposed")),
+			elem.Description(renderLastProposed(stats)),
+			elem.DefinitionTerm(vecty.Text("Missed proposal streak (estimate)")),
+			elem.Description(vecty.Text(fmt.Sprintf("About %d turns now, %d at most, given its share of the voting power",
+				stats.EstimatedMissedStreak, stats.EstimatedLongestMissedStreak))),
+		),
+		elem.Heading4(vecty.Text("Latest blocks proposed")),
+		elem.UnorderedList(
+			vecty.Markup(vecty.Class("proposal-history")),
+			history,
+		),
+	}
+}
+
+func renderLastProposed(v *analytics.ValidatorStats) vecty.ComponentOrHTML {
+	if v.LastProposed == 0 {
+		return vecty.Text("None")
+	}
+	return Link("/block/"+util.IntToString(v.LastProposed), humanize.Comma(int64(v.LastProposed)), "")
+}
+
+// validatorName returns the name of a validator, or its address if it has none
+func validatorName(v *analytics.ValidatorStats) string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return v.Address
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.1f%%", f*100)
+}
@@ -37,6 +37,7 @@ func (dash *ValidatorsDashboardView) Render() vecty.ComponentOrHTML {
 		vecty.Markup(vecty.Attribute("id", "main")),
 		renderServerConnectionBanner(),
 		&ValidatorListView{},
+		&ValidatorLeaderboardView{},
 	)
 }
 
@@ -44,7 +45,7 @@ func (dash *ValidatorsDashboardView) Render() vecty.ComponentOrHTML {
 func UpdateValidatorsDashboard(d *ValidatorsDashboardView) {
 	dispatcher.Dispatch(&actions.EnableAllUpdates{})
 
-	ticker := time.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
+	ticker := update.NewTicker(time.Duration(store.Config.RefreshTime) * 5 * time.Second)
 	if !update.CheckCurrentPage("validators", ticker) {
 		return
 	}
@@ -65,8 +66,8 @@ func UpdateValidatorsDashboard(d *ValidatorsDashboardView) {
 }
 
 func updateValidatorsDashboard(d *ValidatorsDashboardView) {
-	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: store.Client.GetGatewayInfo()})
-	stats, err := store.Client.GetStats()
+	dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: update.GatewayError()})
+	stats, err := update.Stats()
 	if err != nil {
 		logger.Error(err)
 		return
@@ -76,7 +77,7 @@ func updateValidatorsDashboard(d *ValidatorsDashboardView) {
 }
 
 func updateValidators(d *ValidatorsDashboardView) {
-	list, err := store.Client.GetValidatorList()
+	list, err := update.ValidatorList()
 	if err != nil {
 		logger.Error(err)
 	} else {
@@ -12,6 +12,7 @@ import (
 	"gitlab.com/vocdoni/vocexplorer/frontend/actions"
 	"gitlab.com/vocdoni/vocexplorer/frontend/dispatcher"
 	"gitlab.com/vocdoni/vocexplorer/frontend/store"
+	"gitlab.com/vocdoni/vocexplorer/frontend/update"
 	"gitlab.com/vocdoni/vocexplorer/logger"
 )
 
@@ -23,20 +24,21 @@ func main() {
 }
 
 func initFrontend() {
-	var cfg *config.Cfg
-	// dispatcher.Dispatch(&actions.ServerConnected{Connected: true})
-	resp, err := http.Get("/config")
-	if err != nil {
-		logger.Warn(err.Error())
-	}
-	err = json.NewDecoder(resp.Body).Decode(&cfg)
-	if err != nil {
-		logger.Error(err)
+	cfg := fetchConfig("/config")
+	// Networks other than the default one are served under their prefix, with their own config
+	prefix := strings.SplitN(strings.TrimPrefix(js.Global().Get("location").Get("pathname").String(), "/"), "/", 2)[0]
+	if cfg != nil && prefix != "" && len(cfg.Networks) > 1 {
+		for _, network := range cfg.Networks[1:] {
+			if network == prefix {
+				cfg = fetchConfig("/" + network + "/config")
+				break
+			}
+		}
 	}
-	dispatcher.Dispatch(&actions.StoreConfig{Config: *cfg})
 	if cfg == nil {
 		logger.Fatal("Unable to get application configuraion")
 	}
+	dispatcher.Dispatch(&actions.StoreConfig{Config: *cfg})
 	// Wait for store.Config to populate
 	i := 0
 	for ; store.Config.RefreshTime == 0; i++ {
@@ -44,31 +46,41 @@ func initFrontend() {
 			logger.Fatal("Config could not be stored")
 		}
 	}
-	if cfg.Network == "dev" {
-		dispatcher.Dispatch(&actions.SetLinkURLs{ProcessURL: strings.ReplaceAll(config.ProcessURL, config.DomainKey, config.DevDomain), EntityURL: strings.ReplaceAll(config.EntityURL, config.DomainKey, config.DevDomain)})
-	} else if cfg.Network == "stg" {
-		dispatcher.Dispatch(&actions.SetLinkURLs{ProcessURL: strings.ReplaceAll(config.ProcessURL, config.DomainKey, config.StgDomain), EntityURL: strings.ReplaceAll(config.EntityURL, config.DomainKey, config.StgDomain)})
-	} else {
-		dispatcher.Dispatch(&actions.SetLinkURLs{ProcessURL: strings.ReplaceAll(config.ProcessURL, config.DomainKey, config.MainDomain), EntityURL: strings.ReplaceAll(config.EntityURL, config.DomainKey, config.MainDomain)})
+	dispatcher.Dispatch(&actions.SetLinkURLs{ProcessURL: cfg.LinkURL(config.ProcessURL), EntityURL: cfg.LinkURL(config.EntityURL)})
+	var err error
+	// The client reconnects and fails over between gateways by itself,
+	// so an error here means the gateway configuration is invalid.
+	gateways := store.Config.Gateways()
+	if store.Config.Proxy {
+		// The server relays the gateway requests
+		gateways = []string{js.Global().Get("location").Get("origin").String() + store.Route(config.ProxyPath)}
 	}
-	store.Client, err = client.New(store.Config.GatewayUrl)
+	// The signers are checked from the first response on
+	store.Client, err = client.NewTrusted(store.Config.TrustedGateways, store.Config.RejectUntrusted, gateways...)
 	if err != nil {
-		// If first connection fails, record the error and return so the UI is not frozen.
-		// Then attempt to connect 5 more times before giving up.
 		logger.Error(err)
 		dispatcher.Dispatch(&actions.GatewayConnected{GatewayErr: err})
-		go func() {
-			for i := 0; i < 5; i++ {
-				store.Client, err = client.New(store.Config.GatewayUrl)
-				if err != nil {
-					logger.Error(err)
-				} else {
-					return
-				}
+		return
+	}
+	// Pages refetch their data every time they mount, so keep immutable objects in memory
+	store.Client.SetCache(client.NewLRUCache(client.DefaultCacheSize))
+	update.Live()
+}
 
-			}
-		}()
+// fetchConfig gets the config served at path, or nil if it can't
+func fetchConfig(path string) *config.Cfg {
+	var cfg *config.Cfg
+	resp, err := http.Get(path)
+	if err != nil {
+		logger.Warn(err.Error())
+		return nil
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		logger.Error(err)
+		return nil
 	}
+	return cfg
 }
 
 // Beforeunload cleans up before page unload
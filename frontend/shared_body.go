@@ -6,6 +6,7 @@ import (
 	"github.com/hexops/vecty/prop"
 	"gitlab.com/vocdoni/vocexplorer/frontend/components"
 	"gitlab.com/vocdoni/vocexplorer/frontend/pages"
+	"gitlab.com/vocdoni/vocexplorer/frontend/store"
 	router "marwan.io/vecty-router"
 )
 
@@ -14,23 +15,24 @@ type Body struct {
 	vecty.Core
 }
 
-// Render body simply renders routes for application
+// Render body simply renders routes for application, under the prefix of the network served
 func (b *Body) Render() vecty.ComponentOrHTML {
+	r := store.Route
 	return components.SectionMain(
-		router.NewRoute("/", &pages.HomeView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/processes", &pages.ProcessesView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/process/{id}", &pages.ProcessView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/entities", &pages.EntitiesView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/entity/{id}", &pages.EntityView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/envelope/{id}", &pages.EnvelopeView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/blocks", &pages.BlocksView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/block/{id}", &pages.BlockView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/transaction/{block}/{index}", &pages.TxView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/transactions", &pages.TransactionsView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/stats", &pages.Stats{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/validators", &pages.ValidatorsView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/validator/{id}", &pages.ValidatorView{}, router.NewRouteOpts{ExactMatch: true}),
-		router.NewRoute("/search/{searchTerm}", &pages.SearchView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/"), &pages.HomeView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/processes"), &pages.ProcessesView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/process/{id}"), &pages.ProcessView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/entities"), &pages.EntitiesView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/entity/{id}"), &pages.EntityView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/envelope/{id}"), &pages.EnvelopeView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/blocks"), &pages.BlocksView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/block/{id}"), &pages.BlockView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/transaction/{block}/{index}"), &pages.TxView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/transactions"), &pages.TransactionsView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/stats"), &pages.Stats{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/validators"), &pages.ValidatorsView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/validator/{id}"), &pages.ValidatorView{}, router.NewRouteOpts{ExactMatch: true}),
+		router.NewRoute(r("/search/{searchTerm}"), &pages.SearchView{}, router.NewRouteOpts{ExactMatch: true}),
 		// Note that this handler only works for router.Link and router.Redirect accesses.
 		// Directly accessing a non-existant route won't be handled by this.
 		router.NotFoundHandler(&notFound{}),
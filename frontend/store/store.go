@@ -50,6 +50,11 @@ var (
 	EntityURL string
 )
 
+// Route returns the path of a page, or server endpoint, within the routes of the network served
+func Route(path string) string {
+	return Config.Prefix + path
+}
+
 func init() {
 	Blocks.Pagination.Tab = "transactions"
 	Processes.Pagination.Tab = "results"
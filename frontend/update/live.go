@@ -0,0 +1,235 @@
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"syscall/js"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/config"
+	"gitlab.com/vocdoni/vocexplorer/frontend/store"
+	"gitlab.com/vocdoni/vocexplorer/live/livetypes"
+	"gitlab.com/vocdoni/vocexplorer/logger"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+)
+
+// liveEventsPath is the server endpoint streaming the live feed as Server-Sent Events
+const liveEventsPath = "/api/v1/live/events"
+
+// liveBlocksKept is the number of latest blocks pushed kept, the ones of a page of blocks
+const liveBlocksKept = config.ListSize
+
+var (
+	// liveLock guards every variable below
+	liveLock      sync.RWMutex
+	liveConnected bool
+	liveStats     *client.VochainStats
+	// liveBlocks holds the latest blocks pushed, by height
+	liveBlocks = make(map[uint32]*indexertypes.BlockMetadata)
+	// liveGatewayErr is the error of the gateway used by the server, if it's failing
+	liveGatewayErr string
+	liveListeners  = make(map[chan *livetypes.Event]bool)
+)
+
+// Live subscribes to the live feed of the server. Block and process changes are pushed
+// to the tickers of the open page, and the chain stats, latest blocks and gateway status
+// pushed replace the ones fetched from the gateway. The browser reconnects the stream by
+// itself, resuming from the last event received; meanwhile tickers fall back to polling.
+func Live() {
+	events := make(chan *livetypes.Event, 64)
+	source := js.Global().Get("EventSource").New(store.Route(liveEventsPath))
+	source.Set("onopen", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		setLiveConnected(true)
+		return nil
+	}))
+	source.Set("onerror", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		setLiveConnected(false)
+		return nil
+	}))
+	onEvent := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ev := new(livetypes.Event)
+		if err := json.Unmarshal([]byte(args[0].Get("data").String()), ev); err != nil {
+			logger.Error(err)
+			return nil
+		}
+		// JS callbacks must not block
+		select {
+		case events <- ev:
+		default:
+		}
+		return nil
+	})
+	source.Call("addEventListener", livetypes.EventBlock, onEvent)
+	source.Call("addEventListener", livetypes.EventProcess, onEvent)
+	source.Call("addEventListener", livetypes.EventStatus, onEvent)
+
+	go func() {
+		for ev := range events {
+			liveLock.Lock()
+			if ev.Stats != nil {
+				liveStats = ev.Stats
+			}
+			if ev.Block != nil {
+				keepLiveBlock(ev.Block)
+			}
+			if ev.Type == livetypes.EventStatus {
+				liveGatewayErr = ev.Error
+			}
+			for ch := range liveListeners {
+				select {
+				case ch <- ev:
+				default:
+				}
+			}
+			liveLock.Unlock()
+		}
+	}()
+}
+
+// keepLiveBlock adds a pushed block to liveBlocks, dropping the ones below the latest
+// liveBlocksKept. liveLock must be held.
+func keepLiveBlock(block *indexertypes.BlockMetadata) {
+	liveBlocks[block.Height] = block
+	for height := range liveBlocks {
+		if height+liveBlocksKept <= block.Height {
+			delete(liveBlocks, height)
+		}
+	}
+}
+
+func setLiveConnected(connected bool) {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+	liveConnected = connected
+	if !connected {
+		liveStats = nil
+		liveGatewayErr = ""
+	}
+}
+
+// LiveConnected returns true while the live feed is connected
+func LiveConnected() bool {
+	liveLock.RLock()
+	defer liveLock.RUnlock()
+	return liveConnected
+}
+
+// Stats returns the chain stats pushed by the live feed, or fetches them from the gateway
+// while the feed is down
+func Stats() (*client.VochainStats, error) {
+	liveLock.RLock()
+	stats := liveStats
+	liveLock.RUnlock()
+	if stats != nil {
+		return stats, nil
+	}
+	return store.Client.GetStats()
+}
+
+// Ticker delivers a tick on C when the open page should be updated: on the first new block
+// pushed once about interval has passed since the last tick, right away when one of the
+// watched processes changes, and every interval while the live feed is down
+type Ticker struct {
+	C <-chan time.Time
+
+	c        chan time.Time
+	interval time.Duration
+	watched  [][]byte
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// changedLock guards changed
+	changedLock sync.Mutex
+	changed     bool
+}
+
+// NewTicker returns a ticker for a page updated every interval, watching the given process ids
+func NewTicker(interval time.Duration, pids ...[]byte) *Ticker {
+	c := make(chan time.Time, 1)
+	t := &Ticker{
+		C:        c,
+		c:        c,
+		interval: interval,
+		watched:  pids,
+		stop:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Stop stops the ticker
+func (t *Ticker) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+}
+
+// ProcessChanged returns true if a watched process changed since the last call
+func (t *Ticker) ProcessChanged() bool {
+	t.changedLock.Lock()
+	defer t.changedLock.Unlock()
+	changed := t.changed
+	t.changed = false
+	return changed
+}
+
+func (t *Ticker) run() {
+	events := make(chan *livetypes.Event, 16)
+	liveLock.Lock()
+	liveListeners[events] = true
+	liveLock.Unlock()
+	defer func() {
+		liveLock.Lock()
+		delete(liveListeners, events)
+		liveLock.Unlock()
+	}()
+	poll := time.NewTicker(t.interval)
+	defer poll.Stop()
+	// Blocks don't arrive exactly every interval, so accept them a bit earlier
+	minWait := t.interval * 3 / 4
+	last := time.Now()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-poll.C:
+			if !LiveConnected() {
+				last = t.tick(now)
+			}
+		case ev := <-events:
+			switch ev.Type {
+			case livetypes.EventBlock:
+				if time.Since(last) >= minWait {
+					last = t.tick(time.Now())
+				}
+			case livetypes.EventProcess:
+				if t.watches(ev) {
+					t.changedLock.Lock()
+					t.changed = true
+					t.changedLock.Unlock()
+					last = t.tick(time.Now())
+				}
+			}
+		}
+	}
+}
+
+func (t *Ticker) tick(now time.Time) time.Time {
+	select {
+	case t.c <- now:
+	default:
+	}
+	return now
+}
+
+func (t *Ticker) watches(ev *livetypes.Event) bool {
+	if ev.Process == nil {
+		return false
+	}
+	for _, pid := range t.watched {
+		if bytes.Equal(pid, ev.Process.ID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/frontend/store"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+// apiPath is the path of the REST API of the server
+const apiPath = "/api/v1"
+
+// The getters below serve the data refreshed by the pages on every block. While the live
+// feed is connected they ask the REST API of the server, which caches the gateway responses
+// for every browser, instead of the gateway itself. Otherwise they fall back to the gateway.
+
+// serverGet gets the REST API response of the server at path into v
+func serverGet(path string, v interface{}) error {
+	resp, err := http.Get(store.Route(apiPath + path))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// GatewayError returns the error of the gateway used by the server as pushed by the live
+// feed, or checks the gateway while the feed is down
+func GatewayError() error {
+	liveLock.RLock()
+	connected, gatewayErr := liveConnected, liveGatewayErr
+	liveLock.RUnlock()
+	if !connected {
+		return store.Client.GetGatewayInfo()
+	}
+	if gatewayErr != "" {
+		return errors.New(gatewayErr)
+	}
+	return nil
+}
+
+// BlockList returns listSize blocks starting at height from, taken from the blocks pushed
+// by the live feed if it pushed all of them
+func BlockList(from, listSize int) ([]*indexertypes.BlockMetadata, error) {
+	liveLock.RLock()
+	connected := liveConnected
+	list := make([]*indexertypes.BlockMetadata, 0, listSize)
+	for height := from; connected && height < from+listSize; height++ {
+		block, ok := liveBlocks[uint32(height)]
+		if !ok {
+			list = nil
+			break
+		}
+		list = append(list, block)
+	}
+	liveLock.RUnlock()
+	if !connected {
+		return store.Client.GetBlockList(from, listSize)
+	}
+	if list != nil {
+		return list, nil
+	}
+	err := serverGet(fmt.Sprintf("/blocks?from=%d&listSize=%d", from, listSize), &list)
+	return list, err
+}
+
+// TxByID returns the transaction with the given id
+func TxByID(id uint32) (*indexertypes.TxPackage, error) {
+	if !LiveConnected() {
+		return store.Client.GetTxByID(id)
+	}
+	var tx *indexertypes.TxPackage
+	err := serverGet("/tx/id/"+strconv.FormatUint(uint64(id), 10), &tx)
+	return tx, err
+}
+
+// ProcessList returns the ids of listSize processes of every namespace starting at from,
+// of the given entity or of all of them if it's empty
+func ProcessList(entityID []byte, from, listSize int) ([]string, error) {
+	if !LiveConnected() {
+		return store.Client.GetProcessList(entityID, "", 0, "", false, "", from, listSize)
+	}
+	var list []string
+	err := serverGet(fmt.Sprintf("/processes?entityId=%s&namespace=0&from=%d&listSize=%d",
+		util.HexToString(entityID), from, listSize), &list)
+	return list, err
+}
+
+// ProcessSummary returns the summary of a process
+func ProcessSummary(pid []byte) (*client.ProcessSummary, error) {
+	if !LiveConnected() {
+		return store.Client.GetProcessSummary(pid)
+	}
+	var summary *client.ProcessSummary
+	if err := serverGet("/processes/"+util.HexToString(pid)+"/summary", &summary); err != nil {
+		return nil, err
+	}
+	if summary != nil && summary.EnvelopeHeight == nil {
+		summary.EnvelopeHeight = new(uint32)
+	}
+	return summary, nil
+}
+
+// ProcessCount returns the number of processes of an entity
+func ProcessCount(entityID []byte) (int64, error) {
+	if !LiveConnected() {
+		return store.Client.GetProcessCount(entityID)
+	}
+	var count struct {
+		Count int64 `json:"count"`
+	}
+	err := serverGet("/processes/count?entityId="+util.HexToString(entityID), &count)
+	return count.Count, err
+}
+
+// EntityList returns the ids of listSize entities starting at from
+func EntityList(from, listSize int) ([]string, error) {
+	if !LiveConnected() {
+		return store.Client.GetEntityList("", listSize, from)
+	}
+	var list []string
+	err := serverGet(fmt.Sprintf("/entities?from=%d&listSize=%d", from, listSize), &list)
+	return list, err
+}
+
+// ValidatorList returns the current validators
+func ValidatorList() ([]*models.Validator, error) {
+	if !LiveConnected() {
+		return store.Client.GetValidatorList()
+	}
+	var list []*models.Validator
+	err := serverGet("/validators", &list)
+	return list, err
+}
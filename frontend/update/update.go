@@ -2,7 +2,6 @@ package update
 
 import (
 	"strings"
-	"time"
 
 	"gitlab.com/vocdoni/vocexplorer/frontend/actions"
 	"gitlab.com/vocdoni/vocexplorer/frontend/dispatcher"
@@ -63,7 +62,7 @@ func CurrentProcessResults() {
 }
 
 // CheckCurrentPage returns true and stops ticker if the current page is title
-func CheckCurrentPage(title string, ticker *time.Ticker) bool {
+func CheckCurrentPage(title string, ticker *Ticker) bool {
 	if store.CurrentPage != title {
 		logger.Info("redirecting")
 		ticker.Stop()
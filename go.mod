@@ -1,15 +1,19 @@
 module gitlab.com/vocdoni/vocexplorer
 
-go 1.14
+go 1.20
 
 require (
 	github.com/NYTimes/gziphandler v1.1.1
+	github.com/dgraph-io/badger/v3 v3.2103.2
 	github.com/ethereum/go-ethereum v1.10.16
 	github.com/gorilla/mux v1.8.0
+	github.com/prometheus/client_golang v1.12.1
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.10.1
 	go.vocdoni.io/dvote v1.0.4-0.20220321130928-65cfa3e0ac55
 	go.vocdoni.io/proto v1.13.3-0.20220203130255-cbdb9679ec7c
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+	google.golang.org/protobuf v1.27.1
 	nhooyr.io/websocket v1.8.7
 )
 
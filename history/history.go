@@ -0,0 +1,243 @@
+// Package history samples the chain stats at a fixed interval into a time series persisted
+// under the data directory, so the explorer can chart how the Vochain grows over time
+// instead of only showing its current state.
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/history/historytypes"
+	"gitlab.com/vocdoni/vocexplorer/logger"
+)
+
+const (
+	// fileName is the file under the data directory holding the samples, one JSON object per line
+	fileName = "stats_history.jsonl"
+	// compactAfter is the age after which samples are thinned to one per compactResolution
+	compactAfter = 31 * 24 * time.Hour
+	// compactResolution is the time between two kept samples once compacted
+	compactResolution = time.Hour
+	// compactInterval is the time between two compactions of the series
+	compactInterval = 24 * time.Hour
+	// maxPoints is the largest number of samples returned for a range
+	maxPoints = 300
+)
+
+// Source is the gateway data the recorder samples
+type Source interface {
+	GetStats() (*client.VochainStats, error)
+}
+
+// Recorder samples the chain stats and keeps the series. It's safe for concurrent use.
+type Recorder struct {
+	src      Source
+	path     string
+	interval time.Duration
+
+	// lock guards samples and the series file
+	lock    sync.RWMutex
+	samples []historytypes.Sample
+}
+
+// New returns a recorder sampling src every interval, loading the series stored under dataDir.
+// Call Run to start sampling.
+func New(dataDir string, src Source, interval time.Duration) (*Recorder, error) {
+	r := &Recorder{
+		src:      src,
+		path:     filepath.Join(dataDir, fileName),
+		interval: interval,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Run samples the chain stats until ctx is done
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	lastCompact := time.Time{}
+	for {
+		if time.Since(lastCompact) >= compactInterval {
+			if err := r.compact(time.Now()); err != nil {
+				logger.Warn(fmt.Sprintf("stats history: %v", err))
+			}
+			lastCompact = time.Now()
+		}
+		if err := r.sample(); err != nil {
+			logger.Warn(fmt.Sprintf("stats history: %v", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Series returns the samples taken within rng, spread over at most maxPoints samples
+func (r *Recorder) Series(rng string) (*historytypes.Series, error) {
+	now := time.Now()
+	var from time.Time
+	switch rng {
+	case historytypes.RangeDay:
+		from = now.Add(-24 * time.Hour)
+	case historytypes.RangeWeek:
+		from = now.Add(-7 * 24 * time.Hour)
+	case historytypes.RangeMonth:
+		from = now.Add(-30 * 24 * time.Hour)
+	case historytypes.RangeAll:
+	default:
+		return nil, fmt.Errorf("unknown range %q", rng)
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var samples []historytypes.Sample
+	for i, s := range r.samples {
+		if !s.Time.Before(from) {
+			samples = r.samples[i:]
+			break
+		}
+	}
+	series := &historytypes.Series{
+		Range:   rng,
+		From:    from,
+		To:      now,
+		Samples: downsample(samples, maxPoints),
+	}
+	if rng == historytypes.RangeAll && len(samples) > 0 {
+		series.From = samples[0].Time
+	}
+	return series, nil
+}
+
+// sample stores the current chain stats
+func (r *Recorder) sample() error {
+	stats, err := r.src.GetStats()
+	if err != nil {
+		return fmt.Errorf("cannot get stats: %v", err)
+	}
+	s := historytypes.Sample{
+		Time:         time.Now().UTC().Truncate(time.Second),
+		Height:       stats.BlockHeight,
+		Transactions: stats.TransactionCount,
+		Envelopes:    stats.EnvelopeCount,
+		Processes:    stats.ProcessCount,
+		Entities:     stats.EntityCount,
+		Validators:   stats.ValidatorCount,
+	}
+	for _, bt := range stats.BlockTime {
+		if bt > 0 {
+			s.BlockTime = bt
+			break
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open series file: %v", err)
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(s); err != nil {
+		return fmt.Errorf("cannot store sample: %v", err)
+	}
+	r.samples = append(r.samples, s)
+	return nil
+}
+
+// load reads the stored series. Unreadable lines, as one left half written by a crash, are skipped.
+func (r *Recorder) load() error {
+	f, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot open series file: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s historytypes.Sample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			continue
+		}
+		r.samples = append(r.samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read series file: %v", err)
+	}
+	return nil
+}
+
+// compact thins the samples older than compactAfter to one per compactResolution and
+// rewrites the series file if any was dropped
+func (r *Recorder) compact(now time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	cutoff := now.Add(-compactAfter)
+	kept := make([]historytypes.Sample, 0, len(r.samples))
+	var last time.Time
+	for _, s := range r.samples {
+		if s.Time.Before(cutoff) && !last.IsZero() && s.Time.Sub(last) < compactResolution {
+			continue
+		}
+		kept = append(kept, s)
+		last = s.Time
+	}
+	if len(kept) == len(r.samples) {
+		return nil
+	}
+
+	// Write the new file aside and swap it, so a crash doesn't lose the series
+	tmp := r.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("cannot create series file: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, s := range kept {
+		if err := enc.Encode(s); err != nil {
+			f.Close()
+			return fmt.Errorf("cannot store sample: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write series file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot write series file: %v", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("cannot replace series file: %v", err)
+	}
+	r.samples = kept
+	return nil
+}
+
+// downsample picks at most n samples evenly spread over samples, always keeping the latest.
+// Every stat but the block time is a counter, so the picked samples keep the totals exact.
+func downsample(samples []historytypes.Sample, n int) []historytypes.Sample {
+	if len(samples) <= n {
+		return append([]historytypes.Sample{}, samples...)
+	}
+	picked := make([]historytypes.Sample, 0, n)
+	step := float64(len(samples)-1) / float64(n-1)
+	for i := 0; i < n; i++ {
+		picked = append(picked, samples[int(float64(i)*step+0.5)])
+	}
+	return picked
+}
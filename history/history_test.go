@@ -0,0 +1,104 @@
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/history/historytypes"
+)
+
+func TestCompact(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	// Samples are taken at offsets from base, those after 2 hours are recent
+	base := now.Add(-compactAfter - 2*time.Hour)
+	minutes := func(offsets ...int) []time.Duration {
+		d := make([]time.Duration, len(offsets))
+		for i, o := range offsets {
+			d[i] = time.Duration(o) * time.Minute
+		}
+		return d
+	}
+	for _, tc := range []struct {
+		name    string
+		samples []time.Duration
+		kept    []time.Duration
+	}{
+		{"empty", nil, nil},
+		{"recent only", minutes(125, 130, 135, 140), minutes(125, 130, 135, 140)},
+		{"old thinned", minutes(0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110, 120), minutes(0, 60, 120)},
+		{"irregular", minutes(0, 50, 70, 100, 130), minutes(0, 70, 130)},
+		{"old and recent", minutes(0, 30, 90, 110, 125, 126, 127), minutes(0, 90, 125, 126, 127)},
+	} {
+		dir, err := ioutil.TempDir("", "vocexplorer-history")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		f, err := os.Create(filepath.Join(dir, fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc := json.NewEncoder(f)
+		for i, offset := range tc.samples {
+			enc.Encode(historytypes.Sample{Time: base.Add(offset), Height: uint32(i + 1)})
+		}
+		// A line left half written by a crash is skipped
+		f.WriteString(`{"time":"2021-`)
+		f.Close()
+
+		r, err := New(dir, nil, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.samples) != len(tc.samples) {
+			t.Errorf("%s: loaded %d samples, want %d", tc.name, len(r.samples), len(tc.samples))
+		}
+		if err := r.compact(now); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		// The compacted series is stored
+		if r, err = New(dir, nil, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		var kept []time.Duration
+		for _, s := range r.samples {
+			kept = append(kept, s.Time.Sub(base))
+		}
+		if !reflect.DeepEqual(kept, tc.kept) {
+			t.Errorf("%s: kept %v, want %v", tc.name, kept, tc.kept)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	samples := make([]historytypes.Sample, 1000)
+	for i := range samples {
+		samples[i].Height = uint32(i)
+	}
+	for _, tc := range []struct {
+		len     int
+		n       int
+		heights []uint32
+	}{
+		{0, 3, nil},
+		{3, 5, []uint32{0, 1, 2}},
+		{5, 5, []uint32{0, 1, 2, 3, 4}},
+		{9, 3, []uint32{0, 4, 8}},
+		{10, 4, []uint32{0, 3, 6, 9}},
+		{1000, 2, []uint32{0, 999}},
+	} {
+		picked := downsample(samples[:tc.len], tc.n)
+		var heights []uint32
+		for _, s := range picked {
+			heights = append(heights, s.Height)
+		}
+		if !reflect.DeepEqual(heights, tc.heights) {
+			t.Errorf("%d samples into %d: got heights %v, want %v", tc.len, tc.n, heights, tc.heights)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package historytypes holds the samples of the stats history, shared by the server
+// recording them and the pages charting them, without pulling the recorder and its file
+// storage into the WebAssembly bundle
+package historytypes
+
+import "time"
+
+// Ranges of the series
+const (
+	RangeDay   = "day"
+	RangeWeek  = "week"
+	RangeMonth = "month"
+	RangeAll   = "all"
+)
+
+// Ranges lists the ranges a series can be requested for, shortest first
+var Ranges = []string{RangeDay, RangeWeek, RangeMonth, RangeAll}
+
+// Sample is the state of the chain at a point in time
+type Sample struct {
+	Time         time.Time `json:"time"`
+	Height       uint32    `json:"height"`
+	Transactions uint64    `json:"transactions"`
+	Envelopes    uint64    `json:"envelopes"`
+	Processes    int64     `json:"processes"`
+	Entities     int64     `json:"entities"`
+	Validators   int       `json:"validators"`
+	// BlockTime is the average block time in milliseconds over the shortest window
+	// reported by the gateway, 0 if unknown
+	BlockTime int32 `json:"blockTime"`
+}
+
+// Series are the samples taken within a range, oldest first
+type Series struct {
+	Range   string    `json:"range"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Samples []Sample  `json:"samples"`
+}
@@ -0,0 +1,167 @@
+// Package https serves the explorer over TLS, with a static certificate or with
+// certificates obtained and renewed from an ACME server such as Let's Encrypt, and
+// redirects plain HTTP requests to HTTPS.
+package https
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certsDir is the directory under the data directory where ACME certificates are stored
+const certsDir = "certs"
+
+// Manager provides the TLS config of the server and the handler of its plain HTTP listener
+type Manager struct {
+	tls *tls.Config
+	// acme obtains the certificates, nil for a static certificate
+	acme *autocert.Manager
+	// port is the HTTPS port requests are redirected to
+	port string
+	// hosts are the configured hosts requests may be redirected to, keeping the one
+	// requested, and host the one other requests are redirected to
+	hosts   map[string]bool
+	host    string
+	hstsAge int
+}
+
+// New returns a Manager for the TLS config cfg of a server listening on addr, or nil if
+// cfg doesn't enable TLS. ACME certificates are stored under dataDir.
+func New(cfg config.TLSCfg, dataDir, addr string) (*Manager, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %s: %v", addr, err)
+	}
+	m := &Manager{port: port, hosts: make(map[string]bool), hstsAge: cfg.HSTSMaxAge}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		m.addHost(host)
+	}
+	for _, domain := range cfg.ACMEDomains {
+		m.addHost(domain)
+	}
+
+	switch {
+	case cfg.CertFile != "" && len(cfg.ACMEDomains) > 0:
+		return nil, fmt.Errorf("a static certificate and ACME cannot be used at once")
+	case cfg.CertFile != "":
+		if cfg.KeyFile == "" {
+			return nil, fmt.Errorf("no key file for certificate %s", cfg.CertFile)
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load certificate: %v", err)
+		}
+		m.tls = &tls.Config{Certificates: []tls.Certificate{cert}}
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			for _, name := range leaf.DNSNames {
+				if !strings.Contains(name, "*") {
+					m.addHost(name)
+				}
+			}
+		}
+	default:
+		client := &acme.Client{DirectoryURL: cfg.ACMEDirectory}
+		if cfg.ACMECA != "" {
+			// Test ACME servers, such as Pebble, serve their directory with their own CA
+			if client.HTTPClient, err = caClient(cfg.ACMECA); err != nil {
+				return nil, err
+			}
+		}
+		m.acme = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(filepath.Join(dataDir, certsDir)),
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Email:      cfg.ACMEEmail,
+			Client:     client,
+		}
+		// Serves the tls-alpn-01 challenges, the http-01 ones are served on the HTTP listener
+		m.tls = m.acme.TLSConfig()
+	}
+	m.tls.MinVersion = tls.VersionTLS12
+	return m, nil
+}
+
+// addHost adds a host requests may be redirected to, the first one added being the default
+func (m *Manager) addHost(host string) {
+	host = strings.ToLower(host)
+	if m.host == "" {
+		m.host = host
+	}
+	m.hosts[host] = true
+}
+
+// caClient returns an HTTP client trusting the CA certificates in the PEM file caFile
+func caClient(caFile string) (*http.Client, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ACME CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in ACME CA %s", caFile)
+	}
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		Timeout:   30 * time.Second,
+	}, nil
+}
+
+// TLSConfig returns the TLS config of the HTTPS server
+func (m *Manager) TLSConfig() *tls.Config {
+	return m.tls
+}
+
+// HTTPHandler returns the handler of the plain HTTP listener, which answers the ACME
+// http-01 challenges and redirects every other request to HTTPS. Requests are only
+// redirected to the configured hosts, whatever their Host header, so the listener
+// can't be used to redirect to other sites.
+func (m *Manager) HTTPHandler() http.Handler {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if host = strings.ToLower(host); !m.hosts[host] {
+			host = m.host
+		}
+		if host == "" {
+			http.Error(w, "no HTTPS host configured", http.StatusMisdirectedRequest)
+			return
+		}
+		if m.port != "443" {
+			host = net.JoinHostPort(host, m.port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	if m.acme != nil {
+		return m.acme.HTTPHandler(redirect)
+	}
+	return redirect
+}
+
+// HSTS wraps next, telling browsers to only use HTTPS for the explorer from then on
+func (m *Manager) HSTS(next http.Handler) http.Handler {
+	if m.hstsAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.Itoa(m.hstsAge)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
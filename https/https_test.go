@@ -0,0 +1,158 @@
+package https
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/config"
+)
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cfg     config.TLSCfg
+		addr    string
+		enabled bool
+		err     bool
+	}{
+		{"disabled", config.TLSCfg{}, ":443", false, false},
+		{"acme", config.TLSCfg{ACMEDomains: []string{"localhost"}}, ":443", true, false},
+		{"cert and acme", config.TLSCfg{CertFile: "cert.pem", KeyFile: "key.pem", ACMEDomains: []string{"localhost"}}, ":443", false, true},
+		{"cert without key", config.TLSCfg{CertFile: "cert.pem"}, ":443", false, true},
+		{"missing cert", config.TLSCfg{CertFile: "missing.pem", KeyFile: "missing.pem"}, ":443", false, true},
+		{"missing acme ca", config.TLSCfg{ACMEDomains: []string{"localhost"}, ACMECA: "missing.pem"}, ":443", false, true},
+		{"address without port", config.TLSCfg{ACMEDomains: []string{"localhost"}}, "localhost", false, true},
+	} {
+		m, err := New(tc.cfg, os.TempDir(), tc.addr)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: got error %v, want error %v", tc.name, err, tc.err)
+		}
+		if (m != nil) != tc.enabled {
+			t.Errorf("%s: got manager %v, want enabled %v", tc.name, m, tc.enabled)
+		}
+	}
+}
+
+func TestHTTPHandlerRedirects(t *testing.T) {
+	for _, tc := range []struct {
+		cfg      config.TLSCfg
+		addr     string
+		host     string
+		location string
+	}{
+		{config.TLSCfg{ACMEDomains: []string{"explorer.example.org"}}, ":443", "explorer.example.org",
+			"https://explorer.example.org/process/0a?x=1"},
+		{config.TLSCfg{ACMEDomains: []string{"explorer.example.org"}}, ":443", "Explorer.example.org:80",
+			"https://explorer.example.org/process/0a?x=1"},
+		{config.TLSCfg{ACMEDomains: []string{"explorer.example.org", "vocdoni.example.org"}}, ":443", "vocdoni.example.org",
+			"https://vocdoni.example.org/process/0a?x=1"},
+		{config.TLSCfg{ACMEDomains: []string{"localhost"}}, "localhost:5001", "localhost:5002",
+			"https://localhost:5001/process/0a?x=1"},
+		// Other hosts are redirected to the configured one
+		{config.TLSCfg{ACMEDomains: []string{"explorer.example.org"}}, ":443", "evil.example.org",
+			"https://explorer.example.org/process/0a?x=1"},
+		{config.TLSCfg{ACMEDomains: []string{"explorer.example.org"}}, "vocdoni.example.org:443", "evil.example.org",
+			"https://vocdoni.example.org/process/0a?x=1"},
+		{config.TLSCfg{CertFile: "../test/certs/localhost/cert.pem", KeyFile: "../test/certs/localhost/key.pem"}, ":443", "evil.example.org",
+			"https://localhost/process/0a?x=1"},
+	} {
+		m, err := New(tc.cfg, os.TempDir(), tc.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodGet, "http://"+tc.host+"/process/0a?x=1", nil)
+		w := httptest.NewRecorder()
+		m.HTTPHandler().ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tc.location {
+			t.Errorf("%s to %s: got %d to %q, want 301 to %q", tc.host, tc.addr, w.Code, w.Header().Get("Location"), tc.location)
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		age  int
+		want string
+	}{
+		{0, ""},
+		{31536000, "max-age=31536000"},
+	} {
+		w := httptest.NewRecorder()
+		(&Manager{hstsAge: tc.age}).HSTS(ok).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := w.Header().Get("Strict-Transport-Security"); got != tc.want {
+			t.Errorf("max age %d: got %q, want %q", tc.age, got, tc.want)
+		}
+	}
+}
+
+// TestACME obtains a certificate from a Pebble server running with test/config/pebble-config.json,
+// whose directory URL is given by PEBBLE_DIRECTORY, such as https://localhost:14000/dir.
+// Pebble validates the challenges on the ports set in that config, 5001 and 5002.
+func TestACME(t *testing.T) {
+	directory := os.Getenv("PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("PEBBLE_DIRECTORY not set")
+	}
+	dataDir, err := ioutil.TempDir("", "vocexplorer-https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	m, err := New(config.TLSCfg{
+		ACMEDomains:   []string{"localhost"},
+		ACMEDirectory: directory,
+		ACMECA:        "../test/certs/pebble.minica.pem",
+	}, dataDir, ":5001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpLn, err := net.Listen("tcp", ":5002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpSrv := &http.Server{Handler: m.HTTPHandler()}
+	go httpSrv.Serve(httpLn)
+	defer httpSrv.Close()
+	tlsLn, err := net.Listen("tcp", ":5001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsSrv := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: m.TLSConfig(),
+	}
+	go tlsSrv.ServeTLS(tlsLn, "", "")
+	defer tlsSrv.Close()
+
+	// The certificate is obtained during the first handshake. Pebble issues it from a root
+	// generated on start, so only its domain and issuer are checked.
+	dialer := &net.Dialer{Timeout: time.Minute}
+	conn, err := tls.DialWithDialer(dialer, "tcp", "localhost:5001", &tls.Config{
+		ServerName:         "localhost",
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("cannot obtain certificate: %v", err)
+	}
+	defer conn.Close()
+	cert := conn.ConnectionState().PeerCertificates[0]
+	if err := cert.VerifyHostname("localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cert.Issuer.CommonName, "Pebble") {
+		t.Fatalf("certificate issued by %q, want a Pebble CA", cert.Issuer.CommonName)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, certsDir, "localhost")); err != nil {
+		t.Fatalf("certificate not stored: %v", err)
+	}
+}
@@ -0,0 +1,674 @@
+// Package indexer follows the Vochain through a gateway client and stores blocks, transactions,
+// processes, results, envelopes, entities, validators and the chain stats in an embedded
+// key-value store, so explorer queries can be served locally when the gateway is slow or
+// unavailable.
+package indexer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/log"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// SyncInterval is the time between two sync rounds once the index has caught up
+	SyncInterval = 5 * time.Second
+	// batchSize is the list size used when fetching lists from the gateway
+	batchSize = 20
+	// maxBlocksPerSync bounds the blocks fetched in a single round, so processes
+	// and envelopes keep being synced while catching up with a long chain
+	maxBlocksPerSync = 1000
+	// resultsWindow is the number of blocks past its end block a process without results
+	// keeps being refreshed for, unless a transaction touches it
+	resultsWindow = 60
+)
+
+// Key prefixes of the stored objects
+var (
+	prefixBlock         = []byte("b/")  // height -> BlockMetadata
+	prefixBlockHash     = []byte("bh/") // hash -> height
+	prefixProposer      = []byte("bp/") // proposer address + height -> nil
+	prefixTx            = []byte("t/")  // height + index -> TxPackage
+	prefixTxMeta        = []byte("tm/") // height + index -> TxMetadata
+	prefixProcess       = []byte("p/")  // process id -> Process
+	prefixProcessIndex  = []byte("pi/") // index in the gateway process list -> process id
+	prefixSummary       = []byte("ps/") // process id -> ProcessSummary
+	prefixResults       = []byte("r/")  // process id -> results
+	prefixEndBlock      = []byte("pb/") // end block + process id -> nil, for the processes awaiting results
+	prefixTouched       = []byte("pt/") // process id -> nil, for the processes touched by indexed transactions
+	prefixEntity        = []byte("en/") // entity index -> entity id
+	prefixEntityCount   = []byte("ec/") // entity id -> process count
+	prefixEntityProcess = []byte("ep/") // entity id + index in the entity processes -> process id
+	prefixEnvelope      = []byte("e/")  // nullifier -> EnvelopeMetadata
+	prefixEnvelopeFull  = []byte("ef/") // nullifier -> EnvelopePackage
+	prefixProcessEnv    = []byte("pe/") // process id + envelope index -> nullifier
+	prefixEnvCount      = []byte("pc/") // process id -> indexed envelope count
+	prefixRetry         = []byte("pr/") // process id -> nil, for the processes which failed to index
+	prefixValidator     = []byte("v/")  // address -> Validator
+
+	keyHeight       = []byte("m/height")
+	keyProcessCount = []byte("m/processes")
+	keyEntityCount  = []byte("m/entities")
+	keyStats        = []byte("m/stats")
+	keyBlockStatus  = []byte("m/status")
+)
+
+// blockStatus is the block status of the chain as of a sync
+type blockStatus struct {
+	BlockTime [5]int32 `json:"blockTime"`
+	Height    uint32   `json:"height"`
+	Timestamp int32    `json:"timestamp"`
+}
+
+// results are the results of a process as of a sync
+type results struct {
+	Results [][]string `json:"results"`
+	State   string     `json:"state"`
+	Type    string     `json:"type"`
+	Final   bool       `json:"final"`
+}
+
+// Indexer is a gateway client which answers the queries it has indexed from its local store,
+// falling back to the gateway for everything else
+type Indexer struct {
+	*client.Client
+	db *badger.DB
+
+	// statusLock guards height, chainTip and lastSync
+	statusLock sync.RWMutex
+	height     uint32
+	chainTip   uint32
+	lastSync   time.Time
+}
+
+// Status describes how far the index is synced
+type Status struct {
+	Height   uint32    `json:"height"`
+	ChainTip uint32    `json:"chainTip"`
+	Synced   bool      `json:"synced"`
+	LastSync time.Time `json:"lastSync"`
+}
+
+// New opens the index stored under dataDir, to be synced through cli
+func New(dataDir string, cli *client.Client) (*Indexer, error) {
+	opts := badger.DefaultOptions(filepath.Join(dataDir, "indexer")).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open indexer database: %v", err)
+	}
+	idx := &Indexer{Client: cli, db: db}
+	if err := idx.getUint32(keyHeight, &idx.height); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Close closes the index database
+func (idx *Indexer) Close() error {
+	return idx.db.Close()
+}
+
+// Status returns the current sync status
+func (idx *Indexer) Status() Status {
+	idx.statusLock.RLock()
+	defer idx.statusLock.RUnlock()
+	return Status{
+		Height:   idx.height,
+		ChainTip: idx.chainTip,
+		Synced:   idx.chainTip > 0 && idx.height >= idx.chainTip,
+		LastSync: idx.lastSync,
+	}
+}
+
+// Run keeps the index synced with the chain until ctx is done
+func (idx *Indexer) Run(ctx context.Context) {
+	log.Infof("starting indexer at height %d", idx.Status().Height)
+	ticker := time.NewTicker(SyncInterval)
+	defer ticker.Stop()
+	for {
+		if err := idx.sync(ctx); err != nil {
+			log.Warnf("indexer: %v", err)
+		}
+		// Don't wait if there's a backlog of blocks left
+		if st := idx.Status(); st.Synced || ctx.Err() != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// sync runs one sync round for every indexed object type
+func (idx *Indexer) sync(ctx context.Context) error {
+	blockTime, height, timestamp, err := idx.Client.GetBlockStatus()
+	if err != nil {
+		return err
+	}
+	if height == nil || *height == 0 {
+		return fmt.Errorf("gateway returned no block height")
+	}
+	status := blockStatus{Height: *height, Timestamp: timestamp}
+	if blockTime != nil {
+		status.BlockTime = *blockTime
+	}
+	idx.statusLock.Lock()
+	// The block at the current height is not committed yet
+	idx.chainTip = *height - 1
+	idx.statusLock.Unlock()
+
+	if err := idx.syncBlocks(ctx, *height-1); err != nil {
+		return fmt.Errorf("cannot sync blocks: %v", err)
+	}
+	if err := idx.syncValidators(); err != nil {
+		return fmt.Errorf("cannot sync validators: %v", err)
+	}
+	if err := idx.syncProcesses(ctx); err != nil {
+		return fmt.Errorf("cannot sync processes: %v", err)
+	}
+	if err := idx.syncStats(status); err != nil {
+		return fmt.Errorf("cannot sync stats: %v", err)
+	}
+	idx.statusLock.Lock()
+	idx.lastSync = time.Now()
+	idx.statusLock.Unlock()
+	return nil
+}
+
+// syncBlocks indexes the blocks, and their transactions, up to the given height
+func (idx *Indexer) syncBlocks(ctx context.Context, tip uint32) error {
+	from := idx.Status().Height + 1
+	if from > tip {
+		return nil
+	}
+	last := tip
+	if last-from > maxBlocksPerSync {
+		last = from + maxBlocksPerSync
+	}
+	for from <= last && ctx.Err() == nil {
+		size := batchSize
+		if int(last-from)+1 < size {
+			size = int(last-from) + 1
+		}
+		blocks, err := idx.Client.GetBlockList(int(from), size)
+		if err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		for _, block := range blocks {
+			if err := idx.indexBlock(block); err != nil {
+				return err
+			}
+			from = block.Height + 1
+		}
+	}
+	return nil
+}
+
+// indexBlock stores a block with all its transactions, then moves the indexed height forward
+func (idx *Indexer) indexBlock(block *indexertypes.BlockMetadata) error {
+	var txMetas []*indexertypes.TxMetadata
+	var txs []*indexertypes.TxPackage
+	for from := 0; uint64(from) < block.NumTxs; from += batchSize {
+		list, err := idx.Client.GetTxListForBlock(block.Height, from, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			break
+		}
+		txMetas = append(txMetas, list...)
+	}
+	for _, meta := range txMetas {
+		tx, err := idx.Client.GetTx(block.Height, meta.Index)
+		if err != nil {
+			return err
+		}
+		tx.Index = meta.Index
+		txs = append(txs, tx)
+	}
+	err := idx.db.Update(func(txn *badger.Txn) error {
+		if err := setJSON(txn, key(prefixBlock, uint32Key(block.Height)), block); err != nil {
+			return err
+		}
+		if err := txn.Set(key(prefixBlockHash, block.Hash), uint32Key(block.Height)); err != nil {
+			return err
+		}
+		if err := txn.Set(key(prefixProposer, block.ProposerAddress, uint32Key(block.Height)), nil); err != nil {
+			return err
+		}
+		for _, meta := range txMetas {
+			if err := setJSON(txn, key(prefixTxMeta, uint32Key(block.Height), uint32Key(uint32(meta.Index))), meta); err != nil {
+				return err
+			}
+		}
+		for _, tx := range txs {
+			if err := setJSON(txn, key(prefixTx, uint32Key(block.Height), uint32Key(uint32(tx.Index))), tx); err != nil {
+				return err
+			}
+			if pid := txProcessID(tx.Tx); pid != nil {
+				if err := txn.Set(key(prefixTouched, pid), nil); err != nil {
+					return err
+				}
+			}
+		}
+		return txn.Set(keyHeight, uint32Key(block.Height))
+	})
+	if err != nil {
+		return err
+	}
+	idx.statusLock.Lock()
+	idx.height = block.Height
+	idx.statusLock.Unlock()
+	return nil
+}
+
+// syncValidators replaces the stored validator set with the current one
+func (idx *Indexer) syncValidators() error {
+	validators, err := idx.Client.GetValidatorList()
+	if err != nil {
+		return err
+	}
+	return idx.db.Update(func(txn *badger.Txn) error {
+		if err := deletePrefix(txn, prefixValidator); err != nil {
+			return err
+		}
+		for _, validator := range validators {
+			if err := setJSON(txn, key(prefixValidator, validator.Address), validator); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// syncStats stores the chain stats and the block status the round started with, once
+// the other objects are synced
+func (idx *Indexer) syncStats(status blockStatus) error {
+	stats, err := idx.Client.GetStats()
+	if err != nil {
+		return err
+	}
+	return idx.db.Update(func(txn *badger.Txn) error {
+		if err := setJSON(txn, keyStats, stats); err != nil {
+			return err
+		}
+		return setJSON(txn, keyBlockStatus, status)
+	})
+}
+
+// syncProcesses indexes new processes and refreshes the ones which may have changed since
+// the last sync, along with their envelopes
+func (idx *Indexer) syncProcesses(ctx context.Context) error {
+	var indexed uint32
+	if err := idx.getUint32(keyProcessCount, &indexed); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		pids, err := idx.Client.GetProcessList(nil, "", 0, "", false, "", int(indexed), batchSize)
+		if err != nil {
+			return err
+		}
+		for _, pid := range pids {
+			if err := idx.indexProcessOrRetry(ctx, util.StringToHex(pid)); err != nil || ctx.Err() != nil {
+				return err
+			}
+			if err := idx.db.Update(func(txn *badger.Txn) error {
+				if err := txn.Set(key(prefixProcessIndex, uint32Key(indexed)), util.StringToHex(pid)); err != nil {
+					return err
+				}
+				return txn.Set(keyProcessCount, uint32Key(indexed+1))
+			}); err != nil {
+				return err
+			}
+			indexed++
+		}
+		if len(pids) < batchSize {
+			break
+		}
+	}
+
+	// Refresh the processes touched by the indexed transactions and the ones which reached
+	// their end block without results, and retry the ones which failed to index
+	var refresh [][]byte
+	queued := make(map[string]bool)
+	queue := func(pid []byte) {
+		if !queued[string(pid)] {
+			queued[string(pid)] = true
+			refresh = append(refresh, pid)
+		}
+	}
+	height := idx.Status().Height
+	err := idx.iterate(prefixEndBlock, false, func(k, v []byte) bool {
+		k = k[len(prefixEndBlock):]
+		if binary.BigEndian.Uint32(k[:4]) > height {
+			return false
+		}
+		queue(k[4:])
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, prefix := range [][]byte{prefixTouched, prefixRetry} {
+		err := idx.iterate(prefix, false, func(k, v []byte) bool {
+			queue(k[len(prefix):])
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, pid := range refresh {
+		if err := idx.indexProcessOrRetry(ctx, pid); err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexProcessOrRetry indexes a process, recording it to be retried on the next sync if
+// that fails, so a single process the gateway can't serve doesn't stall the others. It
+// only returns the errors of the index database.
+func (idx *Indexer) indexProcessOrRetry(ctx context.Context, pid []byte) error {
+	indexErr := idx.indexProcess(ctx, pid)
+	if ctx.Err() != nil {
+		// Interrupted, a touched process is still refreshed on the next sync
+		return nil
+	}
+	if indexErr != nil {
+		log.Warnf("indexer: cannot index process %x, retrying on the next sync: %v", pid, indexErr)
+	}
+	return idx.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(key(prefixTouched, pid)); err != nil {
+			return err
+		}
+		if indexErr != nil {
+			return txn.Set(key(prefixRetry, pid), nil)
+		}
+		return txn.Delete(key(prefixRetry, pid))
+	})
+}
+
+// indexProcess stores the current state, summary and results of a process and indexes
+// its new envelopes
+func (idx *Indexer) indexProcess(ctx context.Context, pid []byte) error {
+	process, err := idx.Client.GetProcess(pid)
+	if err != nil {
+		return err
+	}
+	if process == nil {
+		return fmt.Errorf("process %x not found", pid)
+	}
+	summary, err := idx.Client.GetProcessSummary(pid)
+	if err != nil {
+		return err
+	}
+	// The gateway may not serve the results of a process yet, so they are only served
+	// from the index once it did
+	res := new(results)
+	var resErr error
+	res.Results, res.State, res.Type, res.Final, resErr = idx.Client.GetResults(pid)
+
+	old := new(indexertypes.Process)
+	stored := idx.getJSON(key(prefixProcess, pid), old) != badger.ErrKeyNotFound
+	height := idx.Status().Height
+	if err := idx.db.Update(func(txn *badger.Txn) error {
+		var err error
+		if err = setJSON(txn, key(prefixProcess, pid), process); err != nil {
+			return err
+		}
+		if err = setJSON(txn, key(prefixSummary, pid), summary); err != nil {
+			return err
+		}
+		if resErr == nil {
+			err = setJSON(txn, key(prefixResults, pid), res)
+		} else {
+			err = txn.Delete(key(prefixResults, pid))
+		}
+		if err != nil {
+			return err
+		}
+		if stored {
+			err = txn.Delete(key(prefixEndBlock, uint32Key(old.EndBlock), pid))
+		} else {
+			err = addEntityProcess(txn, process.EntityID, pid)
+		}
+		if err != nil {
+			return err
+		}
+		if awaitingResults(process) && height <= process.EndBlock+resultsWindow {
+			return txn.Set(key(prefixEndBlock, uint32Key(process.EndBlock), pid), nil)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return idx.indexEnvelopes(ctx, pid)
+}
+
+// addEntityProcess lists a new process under its entity, listing the entity too if it's new
+func addEntityProcess(txn *badger.Txn, entityID, pid []byte) error {
+	count, err := txnUint32(txn, key(prefixEntityCount, entityID))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		entities, err := txnUint32(txn, keyEntityCount)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(key(prefixEntity, uint32Key(entities)), entityID); err != nil {
+			return err
+		}
+		if err := txn.Set(keyEntityCount, uint32Key(entities+1)); err != nil {
+			return err
+		}
+	}
+	if err := txn.Set(key(prefixEntityProcess, entityID, uint32Key(count)), pid); err != nil {
+		return err
+	}
+	return txn.Set(key(prefixEntityCount, entityID), uint32Key(count+1))
+}
+
+// indexEnvelopes stores the envelope metadata of a process received since the last sync
+func (idx *Indexer) indexEnvelopes(ctx context.Context, pid []byte) error {
+	total, err := idx.Client.GetEnvelopeHeight(pid)
+	if err != nil {
+		return err
+	}
+	var indexed uint32
+	if err := idx.getUint32(key(prefixEnvCount, pid), &indexed); err != nil {
+		return err
+	}
+	for indexed < total {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		envelopes, err := idx.Client.GetEnvelopeList(pid, int(indexed), batchSize, "")
+		if err != nil {
+			return err
+		}
+		if len(envelopes) == 0 {
+			return nil
+		}
+		if err := idx.db.Update(func(txn *badger.Txn) error {
+			for _, envelope := range envelopes {
+				if err := setJSON(txn, key(prefixEnvelope, envelope.Nullifier), envelope); err != nil {
+					return err
+				}
+				if err := txn.Set(key(prefixProcessEnv, pid, uint32Key(indexed)), envelope.Nullifier); err != nil {
+					return err
+				}
+				indexed++
+			}
+			return txn.Set(key(prefixEnvCount, pid), uint32Key(indexed))
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processFinal returns true if a process can't change anymore
+func processFinal(process *indexertypes.Process) bool {
+	status := models.ProcessStatus(process.Status)
+	return status == models.ProcessStatus_CANCELED || status == models.ProcessStatus_RESULTS
+}
+
+// awaitingResults returns true if a process may still get results
+func awaitingResults(process *indexertypes.Process) bool {
+	return !processFinal(process) && !process.HaveResults
+}
+
+// txProcessID returns the id of the process a transaction touches, or nil if it touches none
+func txProcessID(rawTx []byte) []byte {
+	var tx models.Tx
+	if err := proto.Unmarshal(rawTx, &tx); err != nil {
+		return nil
+	}
+	switch tx.Payload.(type) {
+	case *models.Tx_Vote:
+		return tx.GetVote().GetProcessId()
+	case *models.Tx_NewProcess:
+		return tx.GetNewProcess().GetProcess().GetProcessId()
+	case *models.Tx_SetProcess:
+		return tx.GetSetProcess().GetProcessId()
+	case *models.Tx_Admin:
+		return tx.GetAdmin().GetProcessId()
+	case *models.Tx_RegisterKey:
+		return tx.GetRegisterKey().GetProcessId()
+	}
+	return nil
+}
+
+// key concatenates a prefix and key parts
+func key(prefix []byte, parts ...[]byte) []byte {
+	k := append([]byte{}, prefix...)
+	for _, p := range parts {
+		k = append(k, p...)
+	}
+	return k
+}
+
+// uint32Key encodes n as big endian, so keys sort numerically
+func uint32Key(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
+
+func setJSON(txn *badger.Txn, k []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return txn.Set(k, data)
+}
+
+// getJSON decodes the value stored at k into v, returning badger.ErrKeyNotFound if there's none
+func (idx *Indexer) getJSON(k []byte, v interface{}) error {
+	return idx.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(k)
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, v)
+		})
+	})
+}
+
+// getUint32 decodes the number stored at k into n, 0 if there's none
+func (idx *Indexer) getUint32(k []byte, n *uint32) error {
+	return idx.db.View(func(txn *badger.Txn) error {
+		var err error
+		*n, err = txnUint32(txn, k)
+		return err
+	})
+}
+
+// txnUint32 returns the number stored at k within txn, 0 if there's none
+func txnUint32(txn *badger.Txn, k []byte) (uint32, error) {
+	item, err := txn.Get(k)
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var n uint32
+	err = item.Value(func(val []byte) error {
+		if len(val) != 4 {
+			return fmt.Errorf("invalid stored number at %q", k)
+		}
+		n = binary.BigEndian.Uint32(val)
+		return nil
+	})
+	return n, err
+}
+
+// iterate calls fn with every key and value under prefix, starting at prefix+from, until fn returns false
+func (idx *Indexer) iterate(prefix []byte, reverse bool, fn func(k, v []byte) bool) error {
+	return idx.iterateFrom(prefix, nil, reverse, fn)
+}
+
+func (idx *Indexer) iterateFrom(prefix, from []byte, reverse bool, fn func(k, v []byte) bool) error {
+	return idx.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = reverse
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		start := key(prefix, from)
+		if reverse && from == nil {
+			// Seek past the last key of the prefix
+			start = key(prefix, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+		}
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if !fn(item.KeyCopy(nil), v) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+func deletePrefix(txn *badger.Txn, prefix []byte) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	var keys [][]byte
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	it.Close()
+	for _, k := range keys {
+		if err := txn.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
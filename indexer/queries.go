@@ -0,0 +1,317 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+// The methods below shadow the client.Client ones, answering from the index when the
+// requested data has been indexed and forwarding the query to the gateway otherwise.
+
+// GetStats returns the chain stats as of the last sync
+func (idx *Indexer) GetStats() (*client.VochainStats, error) {
+	stats := new(client.VochainStats)
+	if err := idx.getJSON(keyStats, stats); err == nil {
+		return stats, nil
+	}
+	return idx.Client.GetStats()
+}
+
+// GetBlockStatus returns the block times, height and timestamp of the chain as of the last sync
+func (idx *Indexer) GetBlockStatus() (*[5]int32, *uint32, int32, error) {
+	status := new(blockStatus)
+	if err := idx.getJSON(keyBlockStatus, status); err == nil {
+		return &status.BlockTime, &status.Height, status.Timestamp, nil
+	}
+	return idx.Client.GetBlockStatus()
+}
+
+// GetBlock returns the block at the given height
+func (idx *Indexer) GetBlock(height uint32) (*indexertypes.BlockMetadata, error) {
+	block := new(indexertypes.BlockMetadata)
+	if err := idx.getJSON(key(prefixBlock, uint32Key(height)), block); err == nil {
+		return block, nil
+	}
+	return idx.Client.GetBlock(height)
+}
+
+// GetBlockByHash returns the block with the given hash
+func (idx *Indexer) GetBlockByHash(hash []byte) (*indexertypes.BlockMetadata, error) {
+	var height uint32
+	if err := idx.getUint32(key(prefixBlockHash, hash), &height); err == nil && height > 0 {
+		return idx.GetBlock(height)
+	}
+	return idx.Client.GetBlockByHash(hash)
+}
+
+// GetBlockList returns listSize blocks starting at height from
+func (idx *Indexer) GetBlockList(from, listSize int) ([]*indexertypes.BlockMetadata, error) {
+	from = util.Max(from, 0)
+	if uint32(from+listSize-1) > idx.Status().Height {
+		return idx.Client.GetBlockList(from, listSize)
+	}
+	blocks := []*indexertypes.BlockMetadata{}
+	var decodeErr error
+	err := idx.iterateFrom(prefixBlock, uint32Key(uint32(from)), false, func(k, v []byte) bool {
+		block := new(indexertypes.BlockMetadata)
+		if decodeErr = json.Unmarshal(v, block); decodeErr != nil {
+			return false
+		}
+		blocks = append(blocks, block)
+		return len(blocks) < listSize
+	})
+	if err != nil || decodeErr != nil {
+		return idx.Client.GetBlockList(from, listSize)
+	}
+	return blocks, nil
+}
+
+// GetTx returns the transaction at the given block height and index
+func (idx *Indexer) GetTx(blockHeight uint32, txIndex int32) (*indexertypes.TxPackage, error) {
+	tx := new(indexertypes.TxPackage)
+	if err := idx.getJSON(key(prefixTx, uint32Key(blockHeight), uint32Key(uint32(txIndex))), tx); err == nil {
+		return tx, nil
+	}
+	return idx.Client.GetTx(blockHeight, txIndex)
+}
+
+// GetTxListForBlock returns listSize transactions of a block, starting at index from
+func (idx *Indexer) GetTxListForBlock(blockHeight uint32, from, listSize int) ([]*indexertypes.TxMetadata, error) {
+	if blockHeight > idx.Status().Height {
+		return idx.Client.GetTxListForBlock(blockHeight, from, listSize)
+	}
+	prefix := key(prefixTxMeta, uint32Key(blockHeight))
+	txs := []*indexertypes.TxMetadata{}
+	var decodeErr error
+	err := idx.iterateFrom(prefix, uint32Key(uint32(util.Max(from, 0))), false, func(k, v []byte) bool {
+		tx := new(indexertypes.TxMetadata)
+		if decodeErr = json.Unmarshal(v, tx); decodeErr != nil {
+			return false
+		}
+		txs = append(txs, tx)
+		return len(txs) < listSize
+	})
+	if err != nil || decodeErr != nil {
+		return idx.Client.GetTxListForBlock(blockHeight, from, listSize)
+	}
+	return txs, nil
+}
+
+// GetProcess returns a process as of the last sync
+func (idx *Indexer) GetProcess(pid []byte) (*indexertypes.Process, error) {
+	process := new(indexertypes.Process)
+	if err := idx.getJSON(key(prefixProcess, pid), process); err == nil {
+		return process, nil
+	}
+	return idx.Client.GetProcess(pid)
+}
+
+// GetProcessList returns listSize process ids starting at from, of an entity or of all of
+// them, as of the last sync. Filtered lists are forwarded to the gateway.
+func (idx *Indexer) GetProcessList(entityId []byte, searchTerm string, namespace uint32, status string, withResults bool, srcNetId string, from, listSize int) ([]string, error) {
+	if searchTerm != "" || namespace != 0 || status != "" || withResults || srcNetId != "" || !idx.caughtUp() {
+		return idx.Client.GetProcessList(entityId, searchTerm, namespace, status, withResults, srcNetId, from, listSize)
+	}
+	prefix := prefixProcessIndex
+	if len(entityId) > 0 {
+		prefix = key(prefixEntityProcess, entityId)
+	}
+	pids := []string{}
+	err := idx.iterateFrom(prefix, uint32Key(uint32(util.Max(from, 0))), false, func(k, v []byte) bool {
+		pids = append(pids, util.HexToString(v))
+		return len(pids) < listSize
+	})
+	if err != nil {
+		return idx.Client.GetProcessList(entityId, searchTerm, namespace, status, withResults, srcNetId, from, listSize)
+	}
+	return pids, nil
+}
+
+// GetProcessCount returns the number of processes of an entity, or of all of them, as of the last sync
+func (idx *Indexer) GetProcessCount(entityId []byte) (int64, error) {
+	k := keyProcessCount
+	if len(entityId) > 0 {
+		k = key(prefixEntityCount, entityId)
+	}
+	var count uint32
+	if idx.caughtUp() && idx.getUint32(k, &count) == nil {
+		return int64(count), nil
+	}
+	return idx.Client.GetProcessCount(entityId)
+}
+
+// GetProcessSummary returns the summary of a process as of the last sync
+func (idx *Indexer) GetProcessSummary(pid []byte) (*client.ProcessSummary, error) {
+	summary := new(client.ProcessSummary)
+	envelopes := new(uint32)
+	if idx.processIndexed(pid) && idx.getJSON(key(prefixSummary, pid), summary) == nil &&
+		idx.getUint32(key(prefixEnvCount, pid), envelopes) == nil {
+		summary.EnvelopeHeight = envelopes
+		return summary, nil
+	}
+	return idx.Client.GetProcessSummary(pid)
+}
+
+// GetResults returns the results of a process as of the last sync
+func (idx *Indexer) GetResults(pid []byte) ([][]string, string, string, bool, error) {
+	res := new(results)
+	if idx.processIndexed(pid) && idx.getJSON(key(prefixResults, pid), res) == nil {
+		return res.Results, res.State, res.Type, res.Final, nil
+	}
+	return idx.Client.GetResults(pid)
+}
+
+// GetEnvelopeHeight returns the number of envelopes of a process as of the last sync
+func (idx *Indexer) GetEnvelopeHeight(pid []byte) (uint32, error) {
+	var envelopes uint32
+	if idx.processIndexed(pid) && idx.getUint32(key(prefixEnvCount, pid), &envelopes) == nil {
+		return envelopes, nil
+	}
+	return idx.Client.GetEnvelopeHeight(pid)
+}
+
+// GetEntityList returns listSize entity ids starting at from, as of the last sync.
+// Searches are forwarded to the gateway.
+func (idx *Indexer) GetEntityList(searchTerm string, listSize, from int) ([]string, error) {
+	if searchTerm != "" || !idx.caughtUp() {
+		return idx.Client.GetEntityList(searchTerm, listSize, from)
+	}
+	entities := []string{}
+	err := idx.iterateFrom(prefixEntity, uint32Key(uint32(util.Max(from, 0))), false, func(k, v []byte) bool {
+		entities = append(entities, util.HexToString(v))
+		return len(entities) < listSize
+	})
+	if err != nil {
+		return idx.Client.GetEntityList(searchTerm, listSize, from)
+	}
+	return entities, nil
+}
+
+// GetEntityCount returns the number of entities as of the last sync
+func (idx *Indexer) GetEntityCount() (int64, error) {
+	var count uint32
+	if idx.caughtUp() && idx.getUint32(keyEntityCount, &count) == nil {
+		return int64(count), nil
+	}
+	return idx.Client.GetEntityCount()
+}
+
+// GetEnvelope returns the envelope with the given nullifier.
+// Envelopes are immutable, so the ones fetched from the gateway are stored for later queries.
+func (idx *Indexer) GetEnvelope(nullifier []byte) (*indexertypes.EnvelopePackage, error) {
+	envelope := new(indexertypes.EnvelopePackage)
+	if err := idx.getJSON(key(prefixEnvelopeFull, nullifier), envelope); err == nil {
+		return envelope, nil
+	}
+	envelope, err := idx.Client.GetEnvelope(nullifier)
+	if err != nil {
+		return nil, err
+	}
+	// Failing to store the envelope doesn't affect the query
+	idx.db.Update(func(txn *badger.Txn) error {
+		return setJSON(txn, key(prefixEnvelopeFull, nullifier), envelope)
+	})
+	return envelope, nil
+}
+
+// GetEnvelopeList returns listSize envelopes of a process, starting at index from
+func (idx *Indexer) GetEnvelopeList(pid []byte, from, listSize int, searchTerm string) ([]*indexertypes.EnvelopeMetadata, error) {
+	var indexed uint32
+	if err := idx.getUint32(key(prefixEnvCount, pid), &indexed); err != nil || searchTerm != "" ||
+		uint32(util.Max(from, 0)+listSize) > indexed {
+		return idx.Client.GetEnvelopeList(pid, from, listSize, searchTerm)
+	}
+	var nullifiers [][]byte
+	err := idx.iterateFrom(key(prefixProcessEnv, pid), uint32Key(uint32(util.Max(from, 0))), false, func(k, v []byte) bool {
+		nullifiers = append(nullifiers, v)
+		return len(nullifiers) < listSize
+	})
+	if err != nil {
+		return idx.Client.GetEnvelopeList(pid, from, listSize, searchTerm)
+	}
+	envelopes := []*indexertypes.EnvelopeMetadata{}
+	for _, nullifier := range nullifiers {
+		envelope := new(indexertypes.EnvelopeMetadata)
+		if err := idx.getJSON(key(prefixEnvelope, nullifier), envelope); err != nil {
+			return idx.Client.GetEnvelopeList(pid, from, listSize, searchTerm)
+		}
+		envelopes = append(envelopes, envelope)
+	}
+	return envelopes, nil
+}
+
+// GetValidatorList returns the validator set, from the gateway if it's reachable
+func (idx *Indexer) GetValidatorList() ([]*models.Validator, error) {
+	validators, err := idx.Client.GetValidatorList()
+	if err == nil {
+		return validators, nil
+	}
+	stored := []*models.Validator{}
+	idx.iterate(prefixValidator, false, func(k, v []byte) bool {
+		validator := new(models.Validator)
+		if json.Unmarshal(v, validator) == nil {
+			stored = append(stored, validator)
+		}
+		return true
+	})
+	if len(stored) == 0 {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// The methods below answer queries the gateway doesn't offer.
+
+// GetBlocksByProposer returns the heights of the blocks proposed by a validator, newest first.
+// Up to listSize heights are returned, skipping the newest from ones.
+func (idx *Indexer) GetBlocksByProposer(address []byte, from, listSize int) ([]uint32, error) {
+	prefix := key(prefixProposer, address)
+	heights := []uint32{}
+	skipped := 0
+	err := idx.iterate(prefix, true, func(k, v []byte) bool {
+		if skipped < from {
+			skipped++
+			return true
+		}
+		heights = append(heights, binary.BigEndian.Uint32(k[len(prefix):]))
+		return len(heights) < listSize
+	})
+	return heights, err
+}
+
+// GetEntityProcessIDs returns the ids of all the indexed processes of an entity, oldest first
+func (idx *Indexer) GetEntityProcessIDs(entityID []byte) ([]string, error) {
+	pids := []string{}
+	err := idx.iterate(key(prefixEntityProcess, entityID), false, func(k, v []byte) bool {
+		pids = append(pids, util.HexToString(v))
+		return true
+	})
+	return pids, err
+}
+
+// caughtUp returns true once the index has caught up with the chain and completed a sync
+// round since the server started, so its lists and counts are as fresh as the last sync
+func (idx *Indexer) caughtUp() bool {
+	st := idx.Status()
+	return st.Synced && !st.LastSync.IsZero()
+}
+
+// processIndexed returns true if a process and its envelopes were indexed by the last sync
+// which refreshed it
+func (idx *Indexer) processIndexed(pid []byte) bool {
+	err := idx.db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(key(prefixRetry, pid)); err != badger.ErrKeyNotFound {
+			return fmt.Errorf("process %x pending retry", pid)
+		}
+		_, err := txn.Get(key(prefixProcess, pid))
+		return err
+	})
+	return err == nil
+}
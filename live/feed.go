@@ -0,0 +1,481 @@
+// Package live follows the Vochain through a single gateway client and fans the changes
+// out to any number of subscribers: every new block with its transactions and the current
+// stats, and every process state change. The server runs one Feed and pushes its events
+// to browsers, so N open explorers cost the gateway as much as one.
+package live
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/live/livetypes"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/log"
+	"go.vocdoni.io/dvote/types"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+const (
+	// PollInterval is the time between two chain height checks
+	PollInterval = 2 * time.Second
+	// maxBlocksPerPoll bounds the blocks pushed at once; when the feed falls further
+	// behind, as after a gateway outage, older blocks are skipped
+	maxBlocksPerPoll = 20
+	// historySize is the number of past events kept for subscribers resuming a stream
+	historySize = 200
+	// subscriberBuffer is the number of events a subscriber may lag behind before it's dropped
+	subscriberBuffer = 64
+	// listSize is the list size used when fetching lists from the gateway
+	listSize = 100
+)
+
+// Source is the gateway data the feed follows
+type Source interface {
+	GetBlockStatus() (*[5]int32, *uint32, int32, error)
+	GetStats() (*client.VochainStats, error)
+	GetBlockList(from, listSize int) ([]*indexertypes.BlockMetadata, error)
+	GetTxListForBlock(blockHeight uint32, from, listSize int) ([]*indexertypes.TxMetadata, error)
+	GetProcessCount(entityId []byte) (int64, error)
+	GetProcessList(entityId []byte, searchTerm string, namespace uint32, status string, withResults bool, srcNetId string, from, listSize int) ([]string, error)
+	GetProcess(pid []byte) (*indexertypes.Process, error)
+}
+
+// Feed polls the chain and broadcasts its changes. It's safe for concurrent use.
+type Feed struct {
+	src Source
+
+	// lock guards every field below
+	lock sync.RWMutex
+	seq  uint64
+	subs map[chan livetypes.Event]bool
+	// history holds the latest events, oldest first
+	history []livetypes.Event
+	// status is the latest status event, while the feed can't follow the chain
+	status *livetypes.Event
+	// height is the latest block pushed
+	height uint32
+	// synced is the height up to which the process changes have been pushed, which may be
+	// below height when syncing them failed, so it's retried on the next poll
+	synced uint32
+	// refresh is set when a block pushed above synced may have changed the open processes
+	refresh bool
+	// processCount is the number of processes known to the feed
+	processCount int64
+	// open holds the processes which may still change, by hex id
+	open map[string]*indexertypes.Process
+}
+
+// NewFeed returns a feed following the chain through src. Call Run to start it.
+func NewFeed(src Source) *Feed {
+	return &Feed{
+		src:  src,
+		subs: make(map[chan livetypes.Event]bool),
+		open: make(map[string]*indexertypes.Process),
+	}
+}
+
+// Subscribe returns a channel receiving every new event. Subscribers not keeping up
+// are dropped, closing their channel. The returned function cancels the subscription.
+func (f *Feed) Subscribe() (<-chan livetypes.Event, func()) {
+	ch := make(chan livetypes.Event, subscriberBuffer)
+	f.lock.Lock()
+	f.subs[ch] = true
+	f.lock.Unlock()
+	return ch, func() {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		if f.subs[ch] {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Since returns the kept events with a sequence number above seq, oldest first
+func (f *Feed) Since(seq uint64) []livetypes.Event {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	var events []livetypes.Event
+	for _, ev := range f.history {
+		if ev.Seq > seq {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// Recent returns the latest n block events kept, oldest first, so new subscribers can
+// render the chain tip right away. It's followed by the status event while the feed
+// can't follow the chain.
+func (f *Feed) Recent(n int) []livetypes.Event {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	var events []livetypes.Event
+	for i := len(f.history) - 1; i >= 0 && len(events) < n; i-- {
+		if f.history[i].Type == livetypes.EventBlock {
+			events = append(events, f.history[i])
+		}
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	if f.status != nil {
+		events = append(events, *f.status)
+	}
+	return events
+}
+
+// Run follows the chain until ctx is done. Only changes after Run is called are pushed.
+func (f *Feed) Run(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	started := false
+	for {
+		var err error
+		if !started {
+			if err = f.start(); err == nil {
+				started = true
+			}
+		} else {
+			err = f.poll(ctx)
+		}
+		if err != nil {
+			log.Warnf("live feed: %v", err)
+		}
+		f.setStatus(err)
+		select {
+		case <-ctx.Done():
+			f.closeSubscribers()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// start sets the feed at the chain tip and loads the processes which may still change
+func (f *Feed) start() error {
+	tip, err := f.tip()
+	if err != nil {
+		return err
+	}
+	count, err := f.src.GetProcessCount(nil)
+	if err != nil {
+		return err
+	}
+	open := make(map[string]*indexertypes.Process)
+	for _, status := range []models.ProcessStatus{models.ProcessStatus_READY, models.ProcessStatus_PAUSED, models.ProcessStatus_ENDED} {
+		for from := 0; ; from += listSize {
+			pids, err := f.src.GetProcessList(nil, "", 0, models.ProcessStatus_name[int32(status)], false, "", from, listSize)
+			if err != nil {
+				return err
+			}
+			for _, pid := range pids {
+				process, err := f.getProcess(pid)
+				if err != nil {
+					return err
+				}
+				open[process.ID.String()] = process
+			}
+			if len(pids) < listSize {
+				break
+			}
+		}
+	}
+	f.lock.Lock()
+	f.height = tip
+	f.synced = tip
+	f.processCount = count
+	f.open = open
+	f.lock.Unlock()
+	log.Infof("live feed following the chain from height %d, %d open processes", tip, len(open))
+	return nil
+}
+
+// poll pushes the blocks committed since the last poll and the process changes they brought.
+// The process changes are only marked as pushed once all of them are, so a failed sync is
+// retried from the same height on the next poll, while the blocks are never pushed twice.
+func (f *Feed) poll(ctx context.Context) error {
+	tip, err := f.tip()
+	if err != nil {
+		return err
+	}
+	if err := f.pushBlocks(ctx, tip); err != nil {
+		return err
+	}
+	f.lock.RLock()
+	height, synced, refresh := f.height, f.synced, f.refresh
+	f.lock.RUnlock()
+	if height <= synced || ctx.Err() != nil {
+		return nil
+	}
+	if err := f.syncProcesses(synced, height, refresh); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	f.synced = height
+	f.refresh = false
+	f.lock.Unlock()
+	return nil
+}
+
+// pushBlocks pushes the blocks committed up to tip and not pushed yet
+func (f *Feed) pushBlocks(ctx context.Context, tip uint32) error {
+	f.lock.RLock()
+	last := f.height
+	f.lock.RUnlock()
+	if tip <= last {
+		return nil
+	}
+	from := last + 1
+	if tip-last > maxBlocksPerPoll {
+		from = tip - maxBlocksPerPoll + 1
+		// The transactions of the skipped blocks are unknown, so they may have changed any process
+		f.lock.Lock()
+		f.refresh = true
+		f.lock.Unlock()
+	}
+	blocks, err := f.src.GetBlockList(int(from), int(tip-from)+1)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	stats, err := f.src.GetStats()
+	if err != nil {
+		return err
+	}
+	for i, block := range blocks {
+		if ctx.Err() != nil {
+			return nil
+		}
+		txs, err := f.blockTxs(block)
+		if err != nil {
+			return err
+		}
+		refresh := false
+		for _, tx := range txs {
+			// Every transaction but votes may change a process
+			refresh = refresh || tx.Type != types.TxVote
+		}
+		ev := livetypes.Event{Type: livetypes.EventBlock, Height: block.Height, Block: block, Txs: txs}
+		if i == len(blocks)-1 {
+			ev.Stats = stats
+		}
+		f.publish(ev)
+		f.lock.Lock()
+		f.height = block.Height
+		f.refresh = f.refresh || refresh
+		f.lock.Unlock()
+	}
+	return nil
+}
+
+// syncProcesses pushes the new processes and the changes of the open ones
+// between heights from (excluded) and to
+func (f *Feed) syncProcesses(from, to uint32, refresh bool) error {
+	count, err := f.src.GetProcessCount(nil)
+	if err != nil {
+		return err
+	}
+	f.lock.RLock()
+	known := f.processCount
+	f.lock.RUnlock()
+
+	// The creations are pushed as the processes are counted, so they're never pushed twice
+	// even if the sync fails afterwards
+	created := make(map[string]bool)
+	for known < count {
+		pids, err := f.src.GetProcessList(nil, "", 0, "", false, "", int(known), listSize)
+		if err != nil {
+			return err
+		}
+		if len(pids) == 0 {
+			break
+		}
+		for _, pid := range pids {
+			process, err := f.getProcess(pid)
+			if err != nil {
+				return err
+			}
+			known++
+			f.lock.Lock()
+			f.processCount = known
+			if !processFinal(process) {
+				f.open[process.ID.String()] = process
+			}
+			f.lock.Unlock()
+			created[process.ID.String()] = true
+			f.publish(livetypes.Event{Type: livetypes.EventProcess, Height: to, Process: process, Change: livetypes.ProcessCreated})
+		}
+	}
+
+	// Taken once the new processes are open, which may start or end within the heights too
+	f.lock.RLock()
+	open := make([]*indexertypes.Process, 0, len(f.open))
+	for _, process := range f.open {
+		open = append(open, process)
+	}
+	f.lock.RUnlock()
+	for _, process := range open {
+		if created[process.ID.String()] {
+			// Just fetched
+			continue
+		}
+		// Processes end at their end block without any transaction
+		ending := process.EndBlock > from && process.EndBlock <= to
+		if refresh || ending {
+			if err := f.refreshProcess(process, to); err != nil {
+				return err
+			}
+		}
+	}
+	// Pushed once nothing can fail anymore, since a failed sync is retried from the same
+	// height, with the processes it created open by then. Refreshing only changes the
+	// processes refreshed, which aren't pushed twice.
+	for _, process := range open {
+		if process.StartBlock > from && process.StartBlock <= to {
+			f.publish(livetypes.Event{Type: livetypes.EventProcess, Height: to, Process: process, Change: livetypes.ProcessStarted})
+		}
+	}
+	return nil
+}
+
+// refreshProcess fetches an open process again, pushing its changes
+func (f *Feed) refreshProcess(old *indexertypes.Process, height uint32) error {
+	process, err := f.src.GetProcess(old.ID)
+	if err != nil {
+		return err
+	}
+	if process == nil {
+		return nil
+	}
+	if process.Status != old.Status {
+		f.publish(livetypes.Event{Type: livetypes.EventProcess, Height: height, Process: process, Change: livetypes.ProcessStatus,
+			PreviousStatus: models.ProcessStatus_name[old.Status]})
+	}
+	if len(process.PrivateKeys) > 0 && len(old.PrivateKeys) == 0 {
+		f.publish(livetypes.Event{Type: livetypes.EventProcess, Height: height, Process: process, Change: livetypes.ProcessKeysRevealed})
+	}
+	if process.FinalResults && !old.FinalResults {
+		f.publish(livetypes.Event{Type: livetypes.EventProcess, Height: height, Process: process, Change: livetypes.ProcessResults})
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if processFinal(process) {
+		delete(f.open, process.ID.String())
+	} else {
+		f.open[process.ID.String()] = process
+	}
+	return nil
+}
+
+// setStatus publishes a status event when the feed stops or resumes following the chain,
+// so pages can tell whether the gateway of the server is working without asking it
+func (f *Feed) setStatus(err error) {
+	f.lock.RLock()
+	failing := f.status != nil
+	f.lock.RUnlock()
+	if (err != nil) == failing {
+		return
+	}
+	ev := livetypes.Event{Type: livetypes.EventStatus}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	f.publish(ev)
+}
+
+// publish stamps an event and sends it to every subscriber
+func (f *Feed) publish(ev livetypes.Event) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.seq++
+	ev.Seq = f.seq
+	if ev.Type == livetypes.EventStatus {
+		f.status = nil
+		if ev.Error != "" {
+			status := ev
+			f.status = &status
+		}
+	}
+	f.history = append(f.history, ev)
+	if len(f.history) > historySize {
+		f.history = f.history[len(f.history)-historySize:]
+	}
+	for ch := range f.subs {
+		select {
+		case ch <- ev:
+		default:
+			log.Debugf("live feed: dropping slow subscriber")
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (f *Feed) closeSubscribers() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for ch := range f.subs {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// tip returns the height of the last committed block
+func (f *Feed) tip() (uint32, error) {
+	_, height, _, err := f.src.GetBlockStatus()
+	if err != nil {
+		return 0, err
+	}
+	if height == nil || *height == 0 {
+		return 0, fmt.Errorf("gateway returned no block height")
+	}
+	// The block at the current height is not committed yet
+	return *height - 1, nil
+}
+
+// blockTxs returns the transactions of a block
+func (f *Feed) blockTxs(block *indexertypes.BlockMetadata) ([]*indexertypes.TxMetadata, error) {
+	var txs []*indexertypes.TxMetadata
+	for uint64(len(txs)) < block.NumTxs {
+		list, err := f.src.GetTxListForBlock(block.Height, len(txs), listSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			break
+		}
+		txs = append(txs, list...)
+	}
+	return txs, nil
+}
+
+func (f *Feed) getProcess(pid string) (*indexertypes.Process, error) {
+	id, err := util.DecodeHex(pid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid process id %s: %v", pid, err)
+	}
+	process, err := f.src.GetProcess(id)
+	if err != nil {
+		return nil, err
+	}
+	if process == nil {
+		return nil, fmt.Errorf("process %s not found", pid)
+	}
+	if len(process.ID) == 0 {
+		process.ID = id
+	}
+	return process, nil
+}
+
+// processFinal returns true if a process can't change anymore
+func processFinal(process *indexertypes.Process) bool {
+	status := models.ProcessStatus(process.Status)
+	return status == models.ProcessStatus_CANCELED || status == models.ProcessStatus_RESULTS
+}
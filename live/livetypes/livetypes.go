@@ -0,0 +1,48 @@
+// Package livetypes holds the events of the live feed, shared by the server pushing them
+// and the pages receiving them, without pulling the feed and its server logging into the
+// WebAssembly bundle
+package livetypes
+
+import (
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+)
+
+// Event types
+const (
+	// EventBlock is sent for every new block
+	EventBlock = "block"
+	// EventProcess is sent for every process change
+	EventProcess = "process"
+	// EventStatus is sent when the feed stops or resumes following the chain
+	EventStatus = "status"
+)
+
+// Process changes
+const (
+	ProcessCreated      = "created"
+	ProcessStarted      = "started"
+	ProcessStatus       = "status"
+	ProcessKeysRevealed = "keysRevealed"
+	ProcessResults      = "results"
+)
+
+// Event is a chain change pushed to subscribers
+type Event struct {
+	// Seq orders the events of a feed, starting at 1
+	Seq    uint64 `json:"seq"`
+	Type   string `json:"type"`
+	Height uint32 `json:"height"`
+	// Block, Txs and Stats are set for block events. Stats is only set on the last
+	// block of a batch, since it describes the chain at its tip.
+	Block *indexertypes.BlockMetadata `json:"block,omitempty"`
+	Txs   []*indexertypes.TxMetadata  `json:"txs,omitempty"`
+	Stats *client.VochainStats        `json:"stats,omitempty"`
+	// Process, Change and PreviousStatus are set for process events
+	Process        *indexertypes.Process `json:"process,omitempty"`
+	Change         string                `json:"change,omitempty"`
+	PreviousStatus string                `json:"previousStatus,omitempty"`
+	// Error is set for status events while the feed can't follow the chain, and empty
+	// once it follows it again
+	Error string `json:"error,omitempty"`
+}
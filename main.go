@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	flag "github.com/spf13/pflag"
@@ -13,9 +17,20 @@ import (
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/gorilla/mux"
+	"gitlab.com/vocdoni/vocexplorer/alert"
+	"gitlab.com/vocdoni/vocexplorer/client"
 	"gitlab.com/vocdoni/vocexplorer/config"
+	"gitlab.com/vocdoni/vocexplorer/history"
+	"gitlab.com/vocdoni/vocexplorer/https"
+	"gitlab.com/vocdoni/vocexplorer/indexer"
+	"gitlab.com/vocdoni/vocexplorer/live"
+	"gitlab.com/vocdoni/vocexplorer/metrics"
+	"gitlab.com/vocdoni/vocexplorer/proxy"
+	"gitlab.com/vocdoni/vocexplorer/ratelimit"
 	"gitlab.com/vocdoni/vocexplorer/router"
+	"gitlab.com/vocdoni/vocexplorer/subscription"
 	"go.vocdoni.io/dvote/log"
+	"golang.org/x/crypto/acme"
 )
 
 func newConfig() (*config.MainCfg, error) {
@@ -28,9 +43,45 @@ func newConfig() (*config.MainCfg, error) {
 	flag.StringVar(&cfg.DataDir, "dataDir", home+"/.vocexplorer", "directory where data is stored")
 	cfg.Global.RefreshTime = *flag.Int("refreshTime", 10, "Number of seconds between each content refresh")
 	cfg.Global.GatewayUrl = *flag.String("gatewayUrl", "ws://0.0.0.0:9090/dvote", "URL for the gateway to query for data")
-	cfg.Global.GatewayUrl = *flag.String("network", "main", "vochain network <main, dev, stg>")
+	cfg.Global.GatewayUrls = *flag.StringSlice("gatewayUrls", []string{}, "fallback gateway URLs, used when gatewayUrl is unavailable")
+	cfg.Global.TrustedGateways = *flag.StringSlice("trustedGateways", []string{}, "addresses or public keys of the gateways trusted to sign responses")
+	cfg.Global.RejectUntrusted = *flag.Bool("rejectUntrusted", false, "reject gateway responses not signed by a trusted gateway, instead of flagging them")
+	cfg.Global.Network = *flag.String("network", "main", "name of the default vochain network, served at the root of the explorer <main, dev, stg or custom>")
+	cfg.Global.LinkDomain = *flag.String("linkDomain", "", "domain of the app the entity and process profiles of the default network link to (defaults to the one of main, dev or stg)")
+	cfg.NetworkGateways = *flag.StringSlice("networkGateways", []string{}, "gateways of the networks served along the default one under /<name>, as <name>=<gatewayUrl>, repeated for fallback gateways")
 	cfg.DisableGzip = *flag.Bool("disableGzip", false, "use to disable gzip compression on web server")
+	cfg.DisableMetrics = *flag.Bool("disableMetrics", false, "use to disable the Prometheus metrics served on /metrics")
 	cfg.HostURL = *flag.String("hostURL", "http://localhost:8081", "url to host block explorer")
+	cfg.Indexer = *flag.Bool("indexer", false, "index the chain into dataDir, serving the REST API from the local index")
+	cfg.CacheSize = *flag.Int("cacheSize", 0, "number of gateway responses cached by the server, shared by the REST API and the indexer (0 disables the cache)")
+	cfg.StatsInterval = *flag.Int("statsInterval", 60, "number of seconds between each chain stats sample stored in dataDir for the stats history (0 disables the history)")
+	cfg.AlertWebhooks = *flag.StringSlice("alertWebhooks", []string{}, "webhooks notified when the chain halts or the gateway turns unhealthy, as <json|slack|matrix>=<url>")
+	cfg.AlertHaltFactor = *flag.Int("alertHaltFactor", 5, "number of average block times without a new block after which the chain is considered halted")
+	cfg.AlertDebounce = *flag.Int("alertDebounce", 60, "number of seconds a problem must last, or be over, before notifying the alert webhooks")
+	cfg.Subscriptions = *flag.Bool("subscriptions", false, "let users subscribe webhooks and emails to process changes, stored in dataDir")
+	cfg.SMTP.Host = *flag.String("smtpHost", "", "SMTP server sending the subscription emails (email subscriptions are disabled if empty)")
+	cfg.SMTP.Port = *flag.Int("smtpPort", 587, "SMTP server port")
+	cfg.SMTP.Username = *flag.String("smtpUsername", "", "SMTP username, if the server requires authentication")
+	cfg.SMTP.Password = *flag.String("smtpPassword", "", "SMTP password")
+	cfg.SMTP.From = *flag.String("smtpFrom", "", "sender address of the subscription emails")
+	cfg.Proxy = *flag.Bool("proxy", false, "relay the gateway requests of the pages through the server, which hides the gateways")
+	cfg.ProxyCacheSize = *flag.Int("proxyCacheSize", 2000, "number of gateway responses cached by the proxy (0 disables the cache)")
+	cfg.ProxyRate = *flag.Float64("proxyRate", 20, "number of proxy requests per second allowed to every client IP (0 disables the limits)")
+	cfg.ProxyBurst = *flag.Int("proxyBurst", 100, "number of proxy requests a client IP may burst above proxyRate")
+	cfg.RateLimit.Rate = *flag.Float64("rateLimit", 0, "number of requests per second allowed to every client IP across all routes (0 disables the limit)")
+	cfg.RateLimit.Burst = *flag.Int("rateBurst", 100, "number of requests a client IP may burst above rateLimit")
+	cfg.RateLimit.Routes = *flag.StringSlice("rateLimitRoutes", []string{}, "limits of every client IP on the routes under a path prefix, as <path prefix>=<rate>:<burst>")
+	cfg.RateLimit.TrustedProxies = *flag.StringSlice("trustedProxies", []string{}, "IPs or CIDRs of the reverse proxies trusted to set X-Forwarded-For")
+	cfg.RateLimit.MaxStreams = *flag.Int("maxStreams", 0, "number of long-lived streams (live events and exports) a client IP may open at once (0 for no limit)")
+	cfg.TLS.CertFile = *flag.String("tlsCert", "", "PEM certificate file to serve the explorer over HTTPS")
+	cfg.TLS.KeyFile = *flag.String("tlsKey", "", "PEM key file of tlsCert")
+	cfg.TLS.ACMEDomains = *flag.StringSlice("acmeDomains", []string{}, "domains to obtain certificates for from the ACME server, serving the explorer over HTTPS, stored in dataDir")
+	cfg.TLS.ACMEEmail = *flag.String("acmeEmail", "", "contact email of the ACME account")
+	cfg.TLS.ACMEDirectory = *flag.String("acmeDirectory", acme.LetsEncryptURL, "directory URL of the ACME server")
+	cfg.TLS.ACMECA = *flag.String("acmeCA", "", "PEM file with the CA certificate of the ACME server, for test servers such as Pebble")
+	cfg.TLS.HTTPAddr = *flag.String("httpAddr", ":80", "address of the HTTP listener redirecting to HTTPS and answering ACME challenges, when serving over HTTPS (empty to disable)")
+	cfg.TLS.HSTSMaxAge = *flag.Int("hstsMaxAge", 31536000, "number of seconds browsers remember to only use HTTPS for the explorer (0 disables HSTS)")
+	cfg.ShutdownTimeout = *flag.Int("shutdownTimeout", 30, "number of seconds given to the requests in progress and the background workers to finish on SIGTERM or SIGINT")
 	cfg.LogLevel = *flag.String("logLevel", "error", "log level <debug, info, warn, error>")
 	flag.Parse()
 
@@ -51,9 +102,45 @@ func newConfig() (*config.MainCfg, error) {
 
 	viper.BindPFlag("global.refreshTime", flag.Lookup("refreshTime"))
 	viper.BindPFlag("global.gatewayUrl", flag.Lookup("gatewayUrl"))
+	viper.BindPFlag("global.gatewayUrls", flag.Lookup("gatewayUrls"))
+	viper.BindPFlag("global.trustedGateways", flag.Lookup("trustedGateways"))
+	viper.BindPFlag("global.rejectUntrusted", flag.Lookup("rejectUntrusted"))
 	viper.BindPFlag("global.network", flag.Lookup("network"))
+	viper.BindPFlag("global.linkDomain", flag.Lookup("linkDomain"))
+	viper.BindPFlag("networkGateways", flag.Lookup("networkGateways"))
 	viper.BindPFlag("disableGzip", flag.Lookup("disableGzip"))
+	viper.BindPFlag("disableMetrics", flag.Lookup("disableMetrics"))
 	viper.BindPFlag("hostURL", flag.Lookup("hostURL"))
+	viper.BindPFlag("indexer", flag.Lookup("indexer"))
+	viper.BindPFlag("cacheSize", flag.Lookup("cacheSize"))
+	viper.BindPFlag("statsInterval", flag.Lookup("statsInterval"))
+	viper.BindPFlag("alertWebhooks", flag.Lookup("alertWebhooks"))
+	viper.BindPFlag("alertHaltFactor", flag.Lookup("alertHaltFactor"))
+	viper.BindPFlag("alertDebounce", flag.Lookup("alertDebounce"))
+	viper.BindPFlag("subscriptions", flag.Lookup("subscriptions"))
+	viper.BindPFlag("smtp.host", flag.Lookup("smtpHost"))
+	viper.BindPFlag("smtp.port", flag.Lookup("smtpPort"))
+	viper.BindPFlag("smtp.username", flag.Lookup("smtpUsername"))
+	viper.BindPFlag("smtp.password", flag.Lookup("smtpPassword"))
+	viper.BindPFlag("smtp.from", flag.Lookup("smtpFrom"))
+	viper.BindPFlag("proxy", flag.Lookup("proxy"))
+	viper.BindPFlag("proxyCacheSize", flag.Lookup("proxyCacheSize"))
+	viper.BindPFlag("proxyRate", flag.Lookup("proxyRate"))
+	viper.BindPFlag("proxyBurst", flag.Lookup("proxyBurst"))
+	viper.BindPFlag("rateLimit.rate", flag.Lookup("rateLimit"))
+	viper.BindPFlag("rateLimit.burst", flag.Lookup("rateBurst"))
+	viper.BindPFlag("rateLimit.routes", flag.Lookup("rateLimitRoutes"))
+	viper.BindPFlag("rateLimit.trustedProxies", flag.Lookup("trustedProxies"))
+	viper.BindPFlag("rateLimit.maxStreams", flag.Lookup("maxStreams"))
+	viper.BindPFlag("tls.certFile", flag.Lookup("tlsCert"))
+	viper.BindPFlag("tls.keyFile", flag.Lookup("tlsKey"))
+	viper.BindPFlag("tls.acmeDomains", flag.Lookup("acmeDomains"))
+	viper.BindPFlag("tls.acmeEmail", flag.Lookup("acmeEmail"))
+	viper.BindPFlag("tls.acmeDirectory", flag.Lookup("acmeDirectory"))
+	viper.BindPFlag("tls.acmeCA", flag.Lookup("acmeCA"))
+	viper.BindPFlag("tls.httpAddr", flag.Lookup("httpAddr"))
+	viper.BindPFlag("tls.hstsMaxAge", flag.Lookup("hstsMaxAge"))
+	viper.BindPFlag("shutdownTimeout", flag.Lookup("shutdownTimeout"))
 	viper.BindPFlag("logLevel", flag.Lookup("logLevel"))
 
 	var cfgError error
@@ -93,6 +180,9 @@ func main() {
 		log.Fatal("cannot read configuration")
 	}
 	log.Init(cfg.LogLevel, "stdout")
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(cfg, flag.Args()))
+	}
 	if _, err := os.Stat("./static/wasm_exec.js"); os.IsNotExist(err) {
 		panic(`
 		Required webassembly file not found at ./static/wasm_exec.js  
@@ -106,30 +196,223 @@ func main() {
 		log.Fatal(err)
 	}
 	log.Infof("Server on: %v", *urlR)
-	log.Infof("Gateway %s", cfg.Global.GatewayUrl)
+	log.Infof("Gateways %v", cfg.Global.Gateways())
+	networks, err := cfg.NetworkCfgs()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	r := mux.NewRouter()
-	router.RegisterRoutes(r, &cfg.Global)
+	// The REST API is served through this client. If no gateway is reachable the client
+	// keeps reconnecting in the background, and API calls report the gateway as unavailable.
+	cli, err := client.NewTrusted(cfg.Global.TrustedGateways, cfg.Global.RejectUntrusted, cfg.Global.Gateways()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+	if cfg.CacheSize > 0 {
+		cli.SetCache(client.NewLRUCache(cfg.CacheSize))
+	}
 
-	s := &http.Server{
-		Addr:         urlR.Host,
-		ReadTimeout:  20 * time.Second,
-		WriteTimeout: 20 * time.Second,
+	// The background workers run until ctx is cancelled on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var workers sync.WaitGroup
+	run := func(worker func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker(ctx)
+		}()
 	}
 
-	if cfg.DisableGzip {
-		s.Handler = r
-		if err = s.ListenAndServe(); err != nil {
+	var src router.Source = cli
+	if cfg.Indexer {
+		idx, err := indexer.New(cfg.DataDir, cli)
+		if err != nil {
 			log.Fatal(err)
 		}
-	} else {
+		defer idx.Close()
+		run(idx.Run)
+		src = idx
+	}
+
+	// A single feed follows the chain and pushes its changes to every browser
+	feed := live.NewFeed(src)
+	run(feed.Run)
+
+	var hist *history.Recorder
+	if cfg.StatsInterval > 0 {
+		if hist, err = history.New(cfg.DataDir, src, time.Duration(cfg.StatsInterval)*time.Second); err != nil {
+			log.Fatal(err)
+		}
+		run(hist.Run)
+	}
+
+	if len(cfg.AlertWebhooks) > 0 {
+		var notifiers []alert.Notifier
+		for _, s := range cfg.AlertWebhooks {
+			hook, err := alert.ParseWebhook(s)
+			if err != nil {
+				log.Fatal(err)
+			}
+			notifiers = append(notifiers, hook)
+		}
+		watcher := alert.NewWatcher(cli, alert.Config{
+			HaltFactor: cfg.AlertHaltFactor,
+			Debounce:   time.Duration(cfg.AlertDebounce) * time.Second,
+		}, notifiers...)
+		run(watcher.Run)
+	}
+
+	var subs *subscription.Notifier
+	if cfg.Subscriptions {
+		store, err := subscription.NewStore(cfg.DataDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var smtp *config.SMTPCfg
+		if cfg.SMTP.Host != "" {
+			smtp = &cfg.SMTP
+		}
+		if subs, err = subscription.NewNotifier(store, feed, src, cfg.HostURL, smtp); err != nil {
+			log.Fatal(err)
+		}
+		run(subs.Run)
+	}
+
+	r := mux.NewRouter()
+	if !cfg.DisableMetrics {
+		r.Handle("/metrics", metrics.Handler(src, cli)).Methods(http.MethodGet)
+	}
+	router.RegisterHealthRoutes(r, src)
+	proxyCfg := proxy.Config{CacheSize: cfg.ProxyCacheSize, Rate: cfg.ProxyRate, Burst: cfg.ProxyBurst}
+	// The other networks are served from their gateways, with the live feed only
+	for _, ncfg := range networks[1:] {
+		log.Infof("Network %s on %s, gateways %v", ncfg.Network, ncfg.Prefix, ncfg.Gateways())
+		ncli, err := client.NewTrusted(ncfg.TrustedGateways, ncfg.RejectUntrusted, ncfg.Gateways()...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer ncli.Close()
+		if cfg.CacheSize > 0 {
+			ncli.SetCache(client.NewLRUCache(cfg.CacheSize))
+		}
+		nfeed := live.NewFeed(ncli)
+		run(nfeed.Run)
+		r.Handle(ncfg.Prefix, http.RedirectHandler(ncfg.Prefix+"/", http.StatusMovedPermanently))
+		sub := r.PathPrefix(ncfg.Prefix).Subrouter()
+		if cfg.Proxy {
+			sub.Handle(config.ProxyPath, proxy.New(ncli, proxyCfg)).Methods(http.MethodPost)
+		}
+		router.RegisterRoutes(ctx, sub, ncfg, ncli, nfeed, nil, nil)
+	}
+	if cfg.Proxy {
+		r.Handle(config.ProxyPath, proxy.New(cli, proxyCfg)).Methods(http.MethodPost)
+	}
+	router.RegisterRoutes(ctx, r, networks[0], src, feed, hist, subs)
+
+	guard, err := ratelimit.NewGuard(cfg.RateLimit, router.IsStream)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var handler http.Handler = r
+	if !cfg.DisableGzip {
 		h, err := gziphandler.NewGzipLevelHandler(9)
 		if err != nil {
 			log.Error(err)
 		}
-		s.Handler = h(r)
-		if err = s.ListenAndServe(); err != nil {
-			log.Fatal(err)
+		gzip := h(r)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// The gzip writer hides the write deadline, which streams lift
+			if router.IsStream(req.URL.Path) {
+				r.ServeHTTP(w, req)
+				return
+			}
+			gzip.ServeHTTP(w, req)
+		})
+	}
+
+	tlsm, err := https.New(cfg.TLS, cfg.DataDir, urlR.Host)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if tlsm != nil {
+		handler = tlsm.HSTS(handler)
+	}
+
+	s := &http.Server{
+		Addr: urlR.Host,
+		// Requests beyond the limits are rejected before anything else
+		Handler:      guard.Handler(handler),
+		ReadTimeout:  20 * time.Second,
+		WriteTimeout: 20 * time.Second,
+	}
+	servers := []*http.Server{s}
+	if tlsm == nil {
+		go serve(s.ListenAndServe)
+	} else {
+		if cfg.TLS.HTTPAddr != "" {
+			redirect := &http.Server{
+				Addr:         cfg.TLS.HTTPAddr,
+				Handler:      tlsm.HTTPHandler(),
+				ReadTimeout:  20 * time.Second,
+				WriteTimeout: 20 * time.Second,
+			}
+			servers = append(servers, redirect)
+			go serve(redirect.ListenAndServe)
 		}
+		s.TLSConfig = tlsm.TLSConfig()
+		log.Infof("Serving over HTTPS on %s", urlR.Host)
+		go serve(func() error { return s.ListenAndServeTLS("", "") })
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	sig := <-stop
+	signal.Stop(stop)
+	log.Infof("received %s, shutting down", sig)
+	shutdown(servers, cancel, &workers, time.Duration(cfg.ShutdownTimeout)*time.Second)
+}
+
+// serve runs the listener of a server, which returns once the server is shut down
+func serve(listen func() error) {
+	if err := listen(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// shutdown cancels the background workers, which closes the live streams the servers would
+// wait for otherwise, and meanwhile stops the servers from accepting connections. It then
+// waits for the requests in progress, exports included, and for the workers to finish,
+// each within timeout, closing the connections left.
+func shutdown(servers []*http.Server, cancel context.CancelFunc, workers *sync.WaitGroup, timeout time.Duration) {
+	cancel()
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			ctx, cancelTimeout := context.WithTimeout(context.Background(), timeout)
+			defer cancelTimeout()
+			if err := s.Shutdown(ctx); err != nil {
+				log.Warnf("cannot shut down server on %s: %v", s.Addr, err)
+				s.Close()
+			}
+		}(s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	workersTimeout := time.NewTimer(timeout)
+	defer workersTimeout.Stop()
+	select {
+	case <-done:
+	case <-workersTimeout.C:
+		log.Warnf("background workers still running after %s, exiting anyway", timeout)
 	}
+	wg.Wait()
+	log.Infof("shutdown complete")
 }
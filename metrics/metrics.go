@@ -0,0 +1,193 @@
+// Package metrics exports the health of the Vochain and of the gateways the explorer reads it
+// through as Prometheus metrics. Every metric is read from the gateway when scraped, so
+// alerts see the chain as the explorer does.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"go.vocdoni.io/dvote/log"
+)
+
+const namespace = "vocexplorer"
+
+// blockTimeWindows names the windows of the average block times reported by the gateway
+var blockTimeWindows = [5]string{"1m", "10m", "1h", "6h", "24h"}
+
+// apis are the gateway APIs the explorer needs, reported as enabled or not
+var apis = []string{"indexer", "vote"}
+
+// Source is the chain data exported
+type Source interface {
+	GetStats() (*client.VochainStats, error)
+	GetBlockStatus() (*[5]int32, *uint32, int32, error)
+}
+
+// Gateway is the gateway client whose health and requests are exported
+type Gateway interface {
+	GetGatewayStatus() (*client.GatewayStatus, error)
+	UntrustedSigner() string
+	MethodStats() map[string]client.MethodStats
+	CacheStats() client.CacheStats
+}
+
+var (
+	descHeight = prometheus.NewDesc(namespace+"_block_height",
+		"Height of the latest block.", nil, nil)
+	descLastBlock = prometheus.NewDesc(namespace+"_last_block_timestamp_seconds",
+		"Timestamp of the latest block.", nil, nil)
+	descSinceLastBlock = prometheus.NewDesc(namespace+"_seconds_since_last_block",
+		"Time elapsed since the latest block.", nil, nil)
+	descBlockTime = prometheus.NewDesc(namespace+"_block_time_seconds",
+		"Average block time over a window.", []string{"window"}, nil)
+	descTransactions = prometheus.NewDesc(namespace+"_transactions_total",
+		"Transactions on the chain.", nil, nil)
+	descEnvelopes = prometheus.NewDesc(namespace+"_envelopes_total",
+		"Vote envelopes on the chain.", nil, nil)
+	descProcesses = prometheus.NewDesc(namespace+"_processes",
+		"Processes on the chain.", nil, nil)
+	descEntities = prometheus.NewDesc(namespace+"_entities",
+		"Entities with processes on the chain.", nil, nil)
+	descValidators = prometheus.NewDesc(namespace+"_validators",
+		"Validators of the chain.", nil, nil)
+	descSyncing = prometheus.NewDesc(namespace+"_gateway_syncing",
+		"Whether the gateway node is still syncing the chain.", nil, nil)
+	descStatsUp = prometheus.NewDesc(namespace+"_stats_up",
+		"Whether the chain stats could be read from the gateway.", nil, nil)
+
+	descGatewayUp = prometheus.NewDesc(namespace+"_gateway_up",
+		"Whether the gateway in use answers and reports itself healthy.", []string{"gateway"}, nil)
+	descGatewayHealth = prometheus.NewDesc(namespace+"_gateway_health",
+		"Health score reported by the gateway in use.", []string{"gateway"}, nil)
+	descGatewayAPI = prometheus.NewDesc(namespace+"_gateway_api_enabled",
+		"Whether the gateway in use enables an API needed by the explorer.", []string{"gateway", "api"}, nil)
+	descGatewayTrusted = prometheus.NewDesc(namespace+"_gateway_trusted",
+		"Whether the gateway responses are signed by a trusted key, or signatures aren't checked.", nil, nil)
+	descRequests = prometheus.NewDesc(namespace+"_gateway_request_duration_seconds",
+		"Gateway requests and the time spent waiting for them, by method.", []string{"method"}, nil)
+	descRequestErrors = prometheus.NewDesc(namespace+"_gateway_request_errors_total",
+		"Gateway requests which failed or got an error response, by method.", []string{"method"}, nil)
+	descCacheHits = prometheus.NewDesc(namespace+"_cache_hits_total",
+		"Gateway responses served from the cache.", nil, nil)
+	descCacheMisses = prometheus.NewDesc(namespace+"_cache_misses_total",
+		"Cacheable gateway requests not found in the cache.", nil, nil)
+)
+
+// Collector is a prometheus.Collector reading the metrics from src and gw on every scrape
+type Collector struct {
+	src Source
+	gw  Gateway
+}
+
+// NewCollector returns a collector exporting the chain read from src and the health of gw
+func NewCollector(src Source, gw Gateway) *Collector {
+	return &Collector{src: src, gw: gw}
+}
+
+// Handler returns the handler serving the metrics of src and gw, along with the Go runtime ones
+func Handler(src Source, gw Gateway) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		NewCollector(src, gw),
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		descHeight, descLastBlock, descSinceLastBlock, descBlockTime,
+		descTransactions, descEnvelopes, descProcesses, descEntities, descValidators, descSyncing, descStatsUp,
+		descGatewayUp, descGatewayHealth, descGatewayAPI, descGatewayTrusted,
+		descRequests, descRequestErrors, descCacheHits, descCacheMisses,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.collectChain(ch)
+	c.collectGateway(ch)
+	c.collectRequests(ch)
+}
+
+// collectChain exports the chain stats, leaving them out if the gateway doesn't answer
+func (c *Collector) collectChain(ch chan<- prometheus.Metric) {
+	blockTimes, height, timestamp, err := c.src.GetBlockStatus()
+	if err != nil {
+		log.Debugf("metrics: cannot get block status: %v", err)
+	} else {
+		if height != nil {
+			ch <- prometheus.MustNewConstMetric(descHeight, prometheus.GaugeValue, float64(*height))
+		}
+		if timestamp > 0 {
+			last := time.Unix(int64(timestamp), 0)
+			ch <- prometheus.MustNewConstMetric(descLastBlock, prometheus.GaugeValue, float64(timestamp))
+			ch <- prometheus.MustNewConstMetric(descSinceLastBlock, prometheus.GaugeValue, time.Since(last).Seconds())
+		}
+		if blockTimes != nil {
+			for i, bt := range blockTimes {
+				// Windows longer than the chain has run are reported as 0
+				if bt > 0 {
+					ch <- prometheus.MustNewConstMetric(descBlockTime, prometheus.GaugeValue,
+						float64(bt)/1000, blockTimeWindows[i])
+				}
+			}
+		}
+	}
+
+	stats, err := c.src.GetStats()
+	if err != nil || stats == nil {
+		log.Debugf("metrics: cannot get stats: %v", err)
+		ch <- prometheus.MustNewConstMetric(descStatsUp, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(descStatsUp, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(descTransactions, prometheus.CounterValue, float64(stats.TransactionCount))
+	ch <- prometheus.MustNewConstMetric(descEnvelopes, prometheus.CounterValue, float64(stats.EnvelopeCount))
+	ch <- prometheus.MustNewConstMetric(descProcesses, prometheus.GaugeValue, float64(stats.ProcessCount))
+	ch <- prometheus.MustNewConstMetric(descEntities, prometheus.GaugeValue, float64(stats.EntityCount))
+	ch <- prometheus.MustNewConstMetric(descValidators, prometheus.GaugeValue, float64(stats.ValidatorCount))
+	ch <- prometheus.MustNewConstMetric(descSyncing, prometheus.GaugeValue, boolValue(stats.Syncing))
+}
+
+// collectGateway exports the health of the gateway in use
+func (c *Collector) collectGateway(ch chan<- prometheus.Metric) {
+	status, err := c.gw.GetGatewayStatus()
+	if err != nil {
+		log.Debugf("metrics: cannot get gateway info: %v", err)
+		ch <- prometheus.MustNewConstMetric(descGatewayUp, prometheus.GaugeValue, 0, "")
+	} else {
+		ch <- prometheus.MustNewConstMetric(descGatewayUp, prometheus.GaugeValue, boolValue(status.Health > 0), status.Address)
+		ch <- prometheus.MustNewConstMetric(descGatewayHealth, prometheus.GaugeValue, float64(status.Health), status.Address)
+		for _, api := range apis {
+			ch <- prometheus.MustNewConstMetric(descGatewayAPI, prometheus.GaugeValue, boolValue(status.Enables(api)), status.Address, api)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(descGatewayTrusted, prometheus.GaugeValue, boolValue(c.gw.UntrustedSigner() == ""))
+}
+
+// collectRequests exports the gateway requests made by the server and its cache usage
+func (c *Collector) collectRequests(ch chan<- prometheus.Metric) {
+	for method, s := range c.gw.MethodStats() {
+		ch <- prometheus.MustNewConstSummary(descRequests, s.Requests, s.Latency.Seconds(), nil, method)
+		ch <- prometheus.MustNewConstMetric(descRequestErrors, prometheus.CounterValue, float64(s.Errors), method)
+	}
+	cache := c.gw.CacheStats()
+	ch <- prometheus.MustNewConstMetric(descCacheHits, prometheus.CounterValue, float64(cache.Hits))
+	ch <- prometheus.MustNewConstMetric(descCacheMisses, prometheus.CounterValue, float64(cache.Misses))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
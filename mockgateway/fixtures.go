@@ -0,0 +1,506 @@
+package mockgateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/types"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Fixtures is the chain state served by the gateway
+type Fixtures struct {
+	// Health and APIList are returned by getInfo
+	Health  int32
+	APIList []string
+	ChainID string
+	// BlockTime holds the average block times returned by getBlockStatus and getStats
+	BlockTime [5]int32
+	// Syncing is reported by getStats while the gateway node catches up with the chain
+	Syncing bool
+	// Blocks are the committed blocks, sorted by height. The chain height is the last height plus one.
+	Blocks []*indexertypes.BlockMetadata
+	// Txs are the committed transactions, sorted by ID. Their BlockHeight and Index must be set,
+	// and the NumTxs of their blocks must match.
+	Txs        []*Tx
+	Processes  []*Process
+	Entities   []string
+	Validators []*models.Validator
+}
+
+// Tx is a committed transaction along with its type
+type Tx struct {
+	indexertypes.TxPackage
+	Type string
+}
+
+// Process is a process along with everything the gateway serves about it
+type Process struct {
+	indexertypes.Process
+	PublicKeys  []client.Key
+	PrivateKeys []client.Key
+	// Results is nil until the process has results
+	Results      [][]string
+	ResultsState string
+	ResultsType  string
+	FinalResults bool
+	Envelopes    []*indexertypes.EnvelopePackage
+}
+
+// DefaultFixtures returns a small chain: ten blocks, two validators and one entity with
+// an ended encrypted process, which has revealed its two keys and has final results, and
+// a running plain process. The votes of the ended process are encrypted with the first
+// key, and with both keys in turn. Every envelope has its vote transaction.
+func DefaultFixtures() *Fixtures {
+	genesis := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &Fixtures{
+		Health:    100,
+		APIList:   []string{"file", "vote", "indexer", "results"},
+		ChainID:   "vocdoni-mock",
+		BlockTime: [5]int32{10000, 10000, 10000, 10000, 10000},
+		Entities:  []string{"e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1"},
+		Validators: []*models.Validator{
+			{Address: hexBytes("a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1"), PubKey: hexBytes("b1b1b1b1"), Power: 10, Name: "validator-1"},
+			{Address: hexBytes("a2a2a2a2a2a2a2a2a2a2a2a2a2a2a2a2a2a2a2a2"), PubKey: hexBytes("b2b2b2b2"), Power: 10, Name: "validator-2"},
+		},
+	}
+	for height := uint32(1); height <= 10; height++ {
+		block := &indexertypes.BlockMetadata{
+			Height:          height,
+			Timestamp:       genesis.Add(time.Duration(height) * 10 * time.Second),
+			Hash:            hexBytes(fmt.Sprintf("%064x", height)),
+			ProposerAddress: f.Validators[height%2].Address,
+		}
+		if height > 1 {
+			block.LastBlockHash = f.Blocks[height-2].Hash
+		}
+		f.Blocks = append(f.Blocks, block)
+	}
+
+	pubKeys, privKeys := encryptionKeys(1, 2)
+	ended := &Process{
+		Process: indexertypes.Process{
+			ID:           hexBytes(fmt.Sprintf("%064x", 0xa1)),
+			EntityID:     hexBytes(f.Entities[0]),
+			StartBlock:   2,
+			EndBlock:     6,
+			Status:       int32(models.ProcessStatus_RESULTS),
+			Envelope:     &models.EnvelopeType{EncryptedVotes: true},
+			Mode:         &models.ProcessMode{AutoStart: true},
+			VoteOpts:     &models.ProcessVoteOptions{MaxCount: 2, MaxValue: 3},
+			CreationTime: genesis.Add(10 * time.Second),
+			HaveResults:  true,
+			FinalResults: true,
+		},
+		PublicKeys:   pubKeys,
+		PrivateKeys:  privKeys,
+		Results:      [][]string{{"0", "2", "0", "0"}, {"2", "0", "0", "0"}},
+		ResultsState: "RESULTS",
+		ResultsType:  "encrypted-poll",
+		FinalResults: true,
+	}
+	running := &Process{
+		Process: indexertypes.Process{
+			ID:           hexBytes(fmt.Sprintf("%064x", 0xa2)),
+			EntityID:     hexBytes(f.Entities[0]),
+			EntityIndex:  1,
+			StartBlock:   5,
+			EndBlock:     100,
+			Status:       int32(models.ProcessStatus_READY),
+			Envelope:     &models.EnvelopeType{},
+			Mode:         &models.ProcessMode{AutoStart: true, Interruptible: true},
+			VoteOpts:     &models.ProcessVoteOptions{MaxCount: 1, MaxValue: 1},
+			CreationTime: genesis.Add(40 * time.Second),
+		},
+		ResultsState: "READY",
+		ResultsType:  "poll-vote",
+	}
+	f.Processes = []*Process{ended, running}
+
+	// Two votes on the ended process and one on the running one, one per block
+	votes := []struct {
+		process    *Process
+		height     uint32
+		keyIndexes []uint32
+	}{{ended, 3, []uint32{1}}, {ended, 4, []uint32{1, 2}}, {running, 7, nil}}
+	for i, vote := range votes {
+		nullifier := hexBytes(fmt.Sprintf("%064x", 0xf0+i))
+		hash := hexBytes(fmt.Sprintf("%064x", 0xe0+i))
+		vote.process.Envelopes = append(vote.process.Envelopes, &indexertypes.EnvelopePackage{
+			Meta: indexertypes.EnvelopeMetadata{
+				ProcessId: vote.process.ID,
+				Nullifier: nullifier,
+				Height:    vote.height,
+				TxHash:    hash,
+			},
+			Nonce:                hexBytes(fmt.Sprintf("%08x", i)),
+			VotePackage:          encryptVote([]byte(`{"votes":[1,0]}`), vote.process.PublicKeys, vote.keyIndexes),
+			EncryptionKeyIndexes: vote.keyIndexes,
+			Weight:               "1",
+		})
+		f.Txs = append(f.Txs, &Tx{
+			TxPackage: indexertypes.TxPackage{
+				ID:          uint32(i + 1),
+				BlockHeight: vote.height,
+				Index:       int32(f.Blocks[vote.height-1].NumTxs),
+				Hash:        hash,
+			},
+			Type: types.TxVote,
+		})
+		f.Blocks[vote.height-1].NumTxs++
+	}
+	return f
+}
+
+// encryptionKeys returns process encryption key pairs with the given indexes. The private
+// keys are fixed, so the fixtures are the same on every run.
+func encryptionKeys(indexes ...int) (pubKeys, privKeys []client.Key) {
+	for _, idx := range indexes {
+		priv := hexBytes(fmt.Sprintf("%064x", 0xd0+idx))
+		pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+		if err != nil {
+			panic(err)
+		}
+		pubKeys = append(pubKeys, client.Key{Idx: idx, Key: hex.EncodeToString(pub)})
+		privKeys = append(privKeys, client.Key{Idx: idx, Key: hex.EncodeToString(priv)})
+	}
+	return pubKeys, privKeys
+}
+
+// encryptVote seals votePackage with the public keys with the given indexes in turn, the
+// way voters encrypt their votes, so it's only readable once all of them are revealed
+func encryptVote(votePackage []byte, pubKeys []client.Key, indexes []uint32) []byte {
+	for _, idx := range indexes {
+		for _, k := range pubKeys {
+			if k.Idx != int(idx) {
+				continue
+			}
+			var pub [32]byte
+			copy(pub[:], hexBytes(k.Key))
+			sealed, err := box.SealAnonymous(nil, votePackage, &pub, rand.Reader)
+			if err != nil {
+				panic(err)
+			}
+			votePackage = sealed
+		}
+	}
+	return votePackage
+}
+
+// Height returns the current chain height, the one of the block being built
+func (f *Fixtures) Height() uint32 {
+	if len(f.Blocks) == 0 {
+		return 0
+	}
+	return f.Blocks[len(f.Blocks)-1].Height + 1
+}
+
+// AddBlock appends an empty block to the chain, as if it had just been committed
+func (f *Fixtures) AddBlock() *indexertypes.BlockMetadata {
+	block := &indexertypes.BlockMetadata{
+		Height: f.Height(),
+		Hash:   hexBytes(fmt.Sprintf("%064x", f.Height())),
+	}
+	if block.Height == 0 {
+		block.Height = 1
+	}
+	if len(f.Blocks) > 0 {
+		last := f.Blocks[len(f.Blocks)-1]
+		block.Timestamp = last.Timestamp.Add(time.Duration(f.BlockTime[0]) * time.Millisecond)
+		block.LastBlockHash = last.Hash
+	}
+	if len(f.Validators) > 0 {
+		block.ProposerAddress = f.Validators[int(block.Height)%len(f.Validators)].Address
+	}
+	f.Blocks = append(f.Blocks, block)
+	return block
+}
+
+// answer returns the response for a request, built from the fixtures
+func (f *Fixtures) answer(req *client.APIrequest) *client.APIresponse {
+	resp := &client.APIresponse{Ok: true}
+	switch req.Method {
+	case "getInfo":
+		resp.APIList = f.APIList
+		resp.Health = f.Health
+	case "getStats":
+		resp.Stats = f.stats()
+	case "getBlockStatus":
+		height := f.Height()
+		blockTime := f.BlockTime
+		resp.Height = &height
+		resp.BlockTime = &blockTime
+		if len(f.Blocks) > 0 {
+			resp.BlockTimestamp = int32(f.Blocks[len(f.Blocks)-1].Timestamp.Unix())
+		}
+	case "getBlock":
+		if block := f.block(req.Height); block != nil {
+			resp.Block = block
+		} else {
+			return fail("block %d not found", req.Height)
+		}
+	case "getBlockByHash":
+		for _, block := range f.Blocks {
+			if string(block.Hash) == string(req.Hash) {
+				resp.Block = block
+				return resp
+			}
+		}
+		return fail("block %x not found", []byte(req.Hash))
+	case "getBlockList":
+		for _, block := range f.Blocks {
+			if int(block.Height) >= req.From && len(resp.BlockList) < listSize(req) {
+				resp.BlockList = append(resp.BlockList, block)
+			}
+		}
+	case "getTx":
+		for _, tx := range f.blockTxs(req.Height) {
+			if tx.Index == req.TxIndex {
+				resp.Tx = &tx.TxPackage
+				return resp
+			}
+		}
+		return fail("transaction %d/%d not found", req.Height, req.TxIndex)
+	case "getTxById":
+		for _, tx := range f.Txs {
+			if tx.ID == req.ID {
+				resp.Tx = &tx.TxPackage
+				return resp
+			}
+		}
+		return fail("transaction %d not found", req.ID)
+	case "getTxListForBlock":
+		if f.block(req.Height) == nil {
+			return fail("block %d not found", req.Height)
+		}
+		txs := f.blockTxs(req.Height)
+		for _, i := range page(len(txs), req) {
+			tx := txs[i]
+			resp.TxList = append(resp.TxList, &indexertypes.TxMetadata{
+				Type:        tx.Type,
+				BlockHeight: tx.BlockHeight,
+				Index:       tx.Index,
+				Hash:        tx.Hash,
+			})
+		}
+	case "getProcessList":
+		var pids []string
+		for _, p := range f.Processes {
+			if f.processMatches(p, req) {
+				pids = append(pids, p.ID.String())
+			}
+		}
+		for _, i := range page(len(pids), req) {
+			resp.ProcessList = append(resp.ProcessList, pids[i])
+		}
+		if len(resp.ProcessList) == 0 {
+			resp.Message = "no results yet"
+		}
+	case "getProcessCount":
+		var count int64
+		for _, p := range f.Processes {
+			if len(req.EntityId) == 0 || string(p.EntityID) == string(req.EntityId) {
+				count++
+			}
+		}
+		resp.Size = &count
+	case "getProcessInfo":
+		p := f.process(req.ProcessID)
+		if p == nil {
+			return fail("process %x not found", []byte(req.ProcessID))
+		}
+		resp.Process = &p.Process
+	case "getProcessSummary":
+		p := f.process(req.ProcessID)
+		if p == nil {
+			return fail("process %x not found", []byte(req.ProcessID))
+		}
+		envelopes := uint32(len(p.Envelopes))
+		resp.ProcessSummary = &client.ProcessSummary{
+			BlockCount:      p.EndBlock - p.StartBlock,
+			EntityID:        p.EntityID.String(),
+			EntityIndex:     p.EntityIndex,
+			EnvelopeHeight:  &envelopes,
+			Metadata:        p.Metadata,
+			SourceNetworkID: p.SourceNetworkId,
+			StartBlock:      p.StartBlock,
+			State:           models.ProcessStatus_name[p.Status],
+			EnvelopeType:    p.Envelope,
+		}
+	case "getProcessKeys":
+		p := f.process(req.ProcessID)
+		if p == nil {
+			return fail("process %x not found", []byte(req.ProcessID))
+		}
+		resp.EncryptionPublicKeys = p.PublicKeys
+		resp.EncryptionPrivKeys = p.PrivateKeys
+	case "getResults":
+		p := f.process(req.ProcessID)
+		if p == nil {
+			return fail("process %x not found", []byte(req.ProcessID))
+		}
+		resp.State = p.ResultsState
+		resp.Type = p.ResultsType
+		if p.Results == nil {
+			resp.Message = "no results yet"
+			return resp
+		}
+		final := p.FinalResults
+		resp.Results = p.Results
+		resp.Final = &final
+	case "getEnvelopeHeight":
+		var height uint32
+		for _, p := range f.Processes {
+			if len(req.ProcessID) == 0 || string(p.ID) == string(req.ProcessID) {
+				height += uint32(len(p.Envelopes))
+			}
+		}
+		resp.Height = &height
+	case "getEnvelope":
+		for _, p := range f.Processes {
+			for _, envelope := range p.Envelopes {
+				if string(envelope.Meta.Nullifier) == string(req.Nullifier) {
+					resp.Envelope = envelope
+					return resp
+				}
+			}
+		}
+		return fail("envelope %x not found", []byte(req.Nullifier))
+	case "getEnvelopeList":
+		var envelopes []*indexertypes.EnvelopeMetadata
+		for _, p := range f.Processes {
+			if string(p.ID) != string(req.ProcessID) {
+				continue
+			}
+			for _, envelope := range p.Envelopes {
+				if strings.Contains(envelope.Meta.Nullifier.String(), util.TrimHex(req.SearchTerm)) {
+					envelopes = append(envelopes, &envelope.Meta)
+				}
+			}
+		}
+		for _, i := range page(len(envelopes), req) {
+			resp.Envelopes = append(resp.Envelopes, envelopes[i])
+		}
+	case "getEntityList":
+		var entities []string
+		for _, eid := range f.Entities {
+			if strings.Contains(eid, util.TrimHex(req.SearchTerm)) {
+				entities = append(entities, eid)
+			}
+		}
+		for _, i := range page(len(entities), req) {
+			resp.EntityIDs = append(resp.EntityIDs, entities[i])
+		}
+	case "getEntityCount":
+		count := int64(len(f.Entities))
+		resp.Size = &count
+	case "getValidatorList":
+		resp.ValidatorList = f.Validators
+	default:
+		return fail("method not found: %s", req.Method)
+	}
+	return resp
+}
+
+func (f *Fixtures) stats() *client.VochainStats {
+	stats := &client.VochainStats{
+		BlockHeight:      f.Height(),
+		EntityCount:      int64(len(f.Entities)),
+		ProcessCount:     int64(len(f.Processes)),
+		TransactionCount: uint64(len(f.Txs)),
+		ValidatorCount:   len(f.Validators),
+		BlockTime:        f.BlockTime,
+		ChainID:          f.ChainID,
+		Syncing:          f.Syncing,
+	}
+	for _, p := range f.Processes {
+		stats.EnvelopeCount += uint64(len(p.Envelopes))
+	}
+	if len(f.Blocks) > 0 {
+		stats.GenesisTimeStamp = f.Blocks[0].Timestamp
+		stats.BlockTimeStamp = int32(f.Blocks[len(f.Blocks)-1].Timestamp.Unix())
+	}
+	return stats
+}
+
+func (f *Fixtures) block(height uint32) *indexertypes.BlockMetadata {
+	for _, block := range f.Blocks {
+		if block.Height == height {
+			return block
+		}
+	}
+	return nil
+}
+
+// blockTxs returns the transactions of a block
+func (f *Fixtures) blockTxs(height uint32) []*Tx {
+	var txs []*Tx
+	for _, tx := range f.Txs {
+		if tx.BlockHeight == height {
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
+
+func (f *Fixtures) process(pid []byte) *Process {
+	for _, p := range f.Processes {
+		if string(p.ID) == string(pid) {
+			return p
+		}
+	}
+	return nil
+}
+
+// processMatches applies the getProcessList filters to a process
+func (f *Fixtures) processMatches(p *Process, req *client.APIrequest) bool {
+	if len(req.EntityId) > 0 && string(p.EntityID) != string(req.EntityId) {
+		return false
+	}
+	if req.Namespace != 0 && p.Namespace != req.Namespace {
+		return false
+	}
+	if req.SrcNetId != "" && p.SourceNetworkId != req.SrcNetId {
+		return false
+	}
+	if req.Status != "" && !strings.EqualFold(models.ProcessStatus_name[p.Status], req.Status) {
+		return false
+	}
+	if req.WithResults && !p.HaveResults {
+		return false
+	}
+	return strings.Contains(p.ID.String(), util.TrimHex(req.SearchTerm))
+}
+
+// page returns the indexes of a list of n items requested by req.From and req.ListSize
+func page(n int, req *client.APIrequest) []int {
+	var indexes []int
+	for i := util.Max(req.From, 0); i < n && len(indexes) < listSize(req); i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// listSize returns the requested list size, defaulting to 10 as the gateway does
+func listSize(req *client.APIrequest) int {
+	if req.ListSize <= 0 {
+		return 10
+	}
+	return req.ListSize
+}
+
+func fail(format string, args ...interface{}) *client.APIresponse {
+	return &client.APIresponse{Message: fmt.Sprintf(format, args...)}
+}
+
+func hexBytes(s string) types.HexBytes {
+	return util.StringToHex(s)
+}
@@ -0,0 +1,333 @@
+// Package mockgateway implements an in-process dvote gateway serving scripted fixtures,
+// so the client and the server can be exercised without a live Vochain. It speaks the
+// jsonrpcapi format over both websockets and HTTP, signs every response, and can inject
+// errors, latency and dropped connections per method.
+package mockgateway
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"go.vocdoni.io/dvote/httprouter/jsonrpcapi"
+	"nhooyr.io/websocket"
+)
+
+// Path is the endpoint path the gateway is served at
+const Path = "/dvote"
+
+// signingPrefix is prepended to every message before hashing and signing it, as real gateways do
+const signingPrefix = "\u0019Ethereum Signed Message:\n"
+
+// Fault describes how the gateway misbehaves when answering a method
+type Fault struct {
+	// Latency delays the response
+	Latency time.Duration
+	// Message makes the gateway answer with ok=false and this message
+	Message string
+	// HTTPStatus makes the gateway answer HTTP requests with this status and no body
+	HTTPStatus int
+	// Drop makes the gateway close the websocket, or the HTTP connection, instead of answering
+	Drop bool
+	// BadSignature makes the gateway sign the response with a random key
+	BadSignature bool
+	// WrongID makes the gateway answer with a request ID which doesn't match the request
+	WrongID bool
+	// Replay makes the gateway answer with the request ID, but sign a response to another request
+	Replay bool
+}
+
+// Handler answers a request, overriding the fixtures for a method
+type Handler func(req *client.APIrequest) *client.APIresponse
+
+// Gateway is a fake dvote gateway. It's safe for concurrent use, and fixtures and faults
+// may be changed while it's serving requests.
+type Gateway struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+
+	// lock guards every field below
+	lock     sync.RWMutex
+	fixtures *Fixtures
+	faults   map[string]Fault
+	handlers map[string]Handler
+	requests map[string]int
+	conns    map[*websocket.Conn]bool
+}
+
+// New starts a gateway serving the given fixtures on a random local port.
+// If fixtures is nil, DefaultFixtures are served.
+func New(fixtures *Fixtures) (*Gateway, error) {
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate gateway key: %v", err)
+	}
+	if fixtures == nil {
+		fixtures = DefaultFixtures()
+	}
+	g := &Gateway{
+		key:      key,
+		fixtures: fixtures,
+		faults:   make(map[string]Fault),
+		handlers: make(map[string]Handler),
+		requests: make(map[string]int),
+		conns:    make(map[*websocket.Conn]bool),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(Path, g.serve)
+	g.server = httptest.NewServer(mux)
+	return g, nil
+}
+
+// Start starts a gateway serving fixtures and a websocket client connected to it, both
+// closed when the test ends. If fixtures is nil, DefaultFixtures are served.
+func Start(tb testing.TB, fixtures *Fixtures) (*Gateway, *client.Client) {
+	tb.Helper()
+	gw, err := New(fixtures)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(gw.Close)
+	cli, err := client.New(gw.WsURL())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { cli.Close() })
+	return gw, cli
+}
+
+// Close shuts the gateway down, closing all its connections
+func (g *Gateway) Close() {
+	g.DropConnections()
+	g.server.Close()
+}
+
+// WsURL returns the websocket endpoint of the gateway
+func (g *Gateway) WsURL() string {
+	return "ws" + strings.TrimPrefix(g.server.URL, "http") + Path
+}
+
+// HTTPURL returns the HTTP endpoint of the gateway
+func (g *Gateway) HTTPURL() string {
+	return g.server.URL + Path
+}
+
+// SignerAddress returns the hex address of the key signing the responses,
+// to be trusted with client.SetTrustedSigners
+func (g *Gateway) SignerAddress() string {
+	return ethcrypto.PubkeyToAddress(g.key.PublicKey).Hex()
+}
+
+// Update calls fn with the fixtures being served, so they can be changed safely
+func (g *Gateway) Update(fn func(f *Fixtures)) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	fn(g.fixtures)
+}
+
+// SetFault makes the gateway misbehave when answering method. An empty method applies
+// the fault to every method without a fault of its own.
+func (g *Gateway) SetFault(method string, fault Fault) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.faults[method] = fault
+}
+
+// ClearFaults makes the gateway behave again
+func (g *Gateway) ClearFaults() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.faults = make(map[string]Fault)
+}
+
+// SetHandler answers method with handler instead of the fixtures. A nil handler restores the fixtures.
+func (g *Gateway) SetHandler(method string, handler Handler) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if handler == nil {
+		delete(g.handlers, method)
+		return
+	}
+	g.handlers[method] = handler
+}
+
+// Requests returns the number of requests received for method, or for every method if it's empty
+func (g *Gateway) Requests(method string) int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	if method != "" {
+		return g.requests[method]
+	}
+	total := 0
+	for _, n := range g.requests {
+		total += n
+	}
+	return total
+}
+
+// DropConnections closes every open websocket, as a restarting gateway would
+func (g *Gateway) DropConnections() {
+	g.lock.Lock()
+	conns := g.conns
+	g.conns = make(map[*websocket.Conn]bool)
+	g.lock.Unlock()
+	for conn := range conns {
+		conn.Close(websocket.StatusGoingAway, "gateway going away")
+	}
+}
+
+// serve answers websocket upgrades and plain HTTP posts
+func (g *Gateway) serve(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		g.serveWs(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message, fault := g.handle(body)
+	if fault.Drop {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+	if fault.HTTPStatus != 0 {
+		w.WriteHeader(fault.HTTPStatus)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(message)
+}
+
+// serveWs answers every request received on a websocket, each one concurrently,
+// so responses may be sent in a different order than their requests
+func (g *Gateway) serveWs(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn.SetReadLimit(32 << 20)
+	g.lock.Lock()
+	g.conns[conn] = true
+	g.lock.Unlock()
+	defer func() {
+		g.lock.Lock()
+		delete(g.conns, conn)
+		g.lock.Unlock()
+		conn.Close(websocket.StatusNormalClosure, "")
+	}()
+	ctx := r.Context()
+	for {
+		_, body, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		go func() {
+			message, fault := g.handle(body)
+			if fault.Drop {
+				conn.Close(websocket.StatusInternalError, "dropped by fault injection")
+				return
+			}
+			conn.Write(ctx, websocket.MessageText, message)
+		}()
+	}
+}
+
+// handle answers a raw jsonrpcapi request, returning the raw response and the fault applied to it
+func (g *Gateway) handle(body []byte) ([]byte, Fault) {
+	var reqOuter jsonrpcapi.RequestMessage
+	var req client.APIrequest
+	var resp *client.APIresponse
+	if err := json.Unmarshal(body, &reqOuter); err != nil {
+		resp = &client.APIresponse{Message: fmt.Sprintf("invalid request: %v", err)}
+	} else if err := json.Unmarshal(reqOuter.MessageAPI, &req); err != nil {
+		resp = &client.APIresponse{Message: fmt.Sprintf("invalid request: %v", err)}
+	}
+
+	g.lock.Lock()
+	g.requests[req.Method]++
+	fault, ok := g.faults[req.Method]
+	if !ok {
+		fault = g.faults[""]
+	}
+	handler := g.handlers[req.Method]
+	g.lock.Unlock()
+
+	if fault.Latency > 0 {
+		time.Sleep(fault.Latency)
+	}
+	switch {
+	case resp != nil:
+	case fault.Message != "":
+		resp = &client.APIresponse{Message: fault.Message}
+	case handler != nil:
+		if resp = handler(&req); resp == nil {
+			resp = fail("no response for %s", req.Method)
+		}
+	default:
+		g.lock.RLock()
+		resp = g.fixtures.answer(&req)
+		g.lock.RUnlock()
+	}
+	resp.Request = reqOuter.ID
+	if fault.Replay {
+		resp.Request += "-replayed"
+	}
+	resp.Timestamp = int32(time.Now().Unix())
+
+	id := reqOuter.ID
+	if fault.WrongID {
+		id += "-wrong"
+	}
+	// The response may point into the fixtures, so encode it while they can't be updated
+	g.lock.RLock()
+	message, err := g.sign(id, resp, fault.BadSignature)
+	g.lock.RUnlock()
+	if err != nil {
+		return nil, Fault{Drop: true}
+	}
+	return message, fault
+}
+
+// sign encodes resp into a jsonrpcapi response message signed by the gateway key,
+// or by a random key if badSignature is set
+func (g *Gateway) sign(id string, resp *client.APIresponse, badSignature bool) ([]byte, error) {
+	respInner, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	key := g.key
+	if badSignature {
+		if key, err = ethcrypto.GenerateKey(); err != nil {
+			return nil, err
+		}
+	}
+	hash := ethcrypto.Keccak256([]byte(fmt.Sprintf("%s%d%s", signingPrefix, len(respInner), respInner)))
+	signature, err := ethcrypto.Sign(hash, key)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonrpcapi.ResponseMessage{
+		ID:         id,
+		MessageAPI: respInner,
+		Signature:  signature,
+	})
+}
@@ -0,0 +1,191 @@
+// Package proxy relays the gateway requests of the explorer pages through the server, so
+// browsers don't connect to the gateways themselves. Requests are relayed with the ID of
+// the page and responses as signed by the gateway, so pages still verify them and the
+// request they answer, while identical requests in flight are sent to the gateway once,
+// responses are cached and every client IP is rate limited.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/ratelimit"
+	"go.vocdoni.io/dvote/httprouter/jsonrpcapi"
+	"go.vocdoni.io/dvote/log"
+)
+
+// maxRequestSize bounds the size of a request body
+const maxRequestSize = 64 << 10
+
+// maxIDSize bounds the size of a request ID
+const maxIDSize = 64
+
+// allowedMethods are the read-only gateway methods relayed, the ones used by the explorer
+var allowedMethods = map[string]bool{
+	"getInfo":           true,
+	"getStats":          true,
+	"getBlockStatus":    true,
+	"getBlock":          true,
+	"getBlockByHash":    true,
+	"getBlockList":      true,
+	"getTx":             true,
+	"getTxById":         true,
+	"getTxListForBlock": true,
+	"getProcessList":    true,
+	"getProcessInfo":    true,
+	"getProcessSummary": true,
+	"getProcessKeys":    true,
+	"getProcessCount":   true,
+	"getResults":        true,
+	"getResultsWeight":  true,
+	"getEntityList":     true,
+	"getEntityCount":    true,
+	"getValidatorList":  true,
+	"getEnvelope":       true,
+	"getEnvelopeList":   true,
+	"getEnvelopeHeight": true,
+}
+
+// Config sets the caching and rate limits of a Proxy
+type Config struct {
+	// CacheSize is the number of responses cached, 0 to disable the cache
+	CacheSize int
+	// Rate is the number of requests per second allowed to every client IP, with bursts
+	// of up to Burst requests. A Rate of 0 disables the limits.
+	Rate  float64
+	Burst int
+}
+
+// Proxy is an http.Handler speaking the gateway JSON-RPC protocol over HTTP, which relays
+// the requests through the gateway client of the server
+type Proxy struct {
+	cli     *client.Client
+	cache   client.Cache
+	limiter *ratelimit.Limiter
+
+	// lock guards inflight
+	lock sync.Mutex
+	// inflight holds the requests sent to the gateway and not answered yet, by request ID
+	// and cache key
+	inflight map[string]*call
+}
+
+// call is a request sent to the gateway, shared by every identical request with the same ID
+// made meanwhile
+type call struct {
+	done chan struct{}
+	msg  *jsonrpcapi.ResponseMessage
+	err  error
+}
+
+// New returns a Proxy relaying requests through cli
+func New(cli *client.Client, cfg Config) *Proxy {
+	p := &Proxy{
+		cli:      cli,
+		limiter:  ratelimit.New(cfg.Rate, cfg.Burst),
+		inflight: make(map[string]*call),
+	}
+	if cfg.CacheSize > 0 {
+		p.cache = client.NewLRUCache(cfg.CacheSize)
+	}
+	return p
+}
+
+// ServeHTTP relays a jsonrpcapi request message posted by a page
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ok, wait := p.limiter.Allow(ratelimit.ClientIP(r)); !ok {
+		ratelimit.TooManyRequests(w, wait)
+		return
+	}
+	var reqOuter jsonrpcapi.RequestMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&reqOuter); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if reqOuter.ID == "" || len(reqOuter.ID) > maxIDSize {
+		http.Error(w, "invalid request: bad request ID", http.StatusBadRequest)
+		return
+	}
+	var req client.APIrequest
+	if err := json.Unmarshal(reqOuter.MessageAPI, &req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !allowedMethods[req.Method] {
+		http.Error(w, fmt.Sprintf("method %q not allowed", req.Method), http.StatusForbidden)
+		return
+	}
+	msg, err := p.relay(r.Context(), reqOuter.ID, req)
+	if err != nil {
+		log.Debugf("proxy: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		log.Debugf("proxy: cannot write response: %v", err)
+	}
+}
+
+// relay returns the cached response to req with the given ID, or sends req to the gateway
+// with that ID, unless an identical request is in flight already. The gateway signs the ID
+// along with the response, so responses are only shared by requests with the same ID.
+func (p *Proxy) relay(ctx context.Context, id string, req client.APIrequest) (*jsonrpcapi.ResponseMessage, error) {
+	key, err := client.CacheKey(req)
+	if err != nil {
+		return nil, err
+	}
+	key = id + "/" + key
+	ttl, cacheable := client.CacheTTL(req.Method)
+	cacheable = cacheable && p.cache != nil
+	if cacheable {
+		if data, ok := p.cache.Get(key); ok {
+			var msg jsonrpcapi.ResponseMessage
+			if err := json.Unmarshal(data, &msg); err == nil {
+				return &msg, nil
+			}
+		}
+	}
+
+	p.lock.Lock()
+	c, ok := p.inflight[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		p.inflight[key] = c
+		// The request is shared, so it isn't cancelled along with the page which sent it first
+		go func() {
+			rctx, cancel := context.WithTimeout(context.Background(), client.DefaultTimeout)
+			defer cancel()
+			c.msg, c.err = p.cli.Relay(rctx, id, req)
+			if c.err == nil && cacheable && responseOk(c.msg) {
+				if data, err := json.Marshal(c.msg); err == nil {
+					p.cache.Set(key, data, ttl)
+				}
+			}
+			p.lock.Lock()
+			delete(p.inflight, key)
+			p.lock.Unlock()
+			close(c.done)
+		}()
+	}
+	p.lock.Unlock()
+
+	select {
+	case <-c.done:
+		return c.msg, c.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %v", req.Method, ctx.Err())
+	}
+}
+
+// responseOk returns true if msg holds a successful response, the only ones cached
+func responseOk(msg *jsonrpcapi.ResponseMessage) bool {
+	var resp struct {
+		Ok bool `json:"ok"`
+	}
+	return json.Unmarshal(msg.MessageAPI, &resp) == nil && resp.Ok
+}
@@ -0,0 +1,207 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/config"
+)
+
+// streamRetryAfter is the time clients are asked to wait before opening another live
+// stream, once they have too many open
+const streamRetryAfter = 30 * time.Second
+
+// clientIPKey is the request context key of the client IP resolved by a Guard
+type clientIPKey struct{}
+
+// Guard applies the rate limits of the server to every request: a limit per client IP
+// across all routes, limits per client IP for the routes under some path prefixes, and a
+// limit of live streams open at once per client IP. It's safe for concurrent use.
+type Guard struct {
+	global *Limiter
+	// routes are sorted by prefix, longest first, so the most specific one applies
+	routes     []routeLimiter
+	trusted    []*net.IPNet
+	maxStreams int
+	// isStream tells the paths of the routes answered with a live stream
+	isStream func(path string) bool
+
+	// streamsLock guards streams
+	streamsLock sync.Mutex
+	// streams counts the live streams open by client IP
+	streams map[string]int
+}
+
+type routeLimiter struct {
+	prefix  string
+	limiter *Limiter
+}
+
+// NewGuard returns a Guard applying the limits of cfg, counting the requests to the paths
+// isStream returns true for as live streams
+func NewGuard(cfg config.RateLimitCfg, isStream func(path string) bool) (*Guard, error) {
+	g := &Guard{
+		global:     New(cfg.Rate, cfg.Burst),
+		maxStreams: cfg.MaxStreams,
+		isStream:   isStream,
+		streams:    make(map[string]int),
+	}
+	for _, s := range cfg.Routes {
+		route, err := parseRoute(s)
+		if err != nil {
+			return nil, err
+		}
+		g.routes = append(g.routes, route)
+	}
+	sort.SliceStable(g.routes, func(i, j int) bool { return len(g.routes[i].prefix) > len(g.routes[j].prefix) })
+	for _, s := range cfg.TrustedProxies {
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", s, err)
+		}
+		g.trusted = append(g.trusted, ipNet)
+	}
+	return g, nil
+}
+
+// parseRoute parses a route limit as <path prefix>=<rate>:<burst>
+func parseRoute(s string) (routeLimiter, error) {
+	invalid := fmt.Errorf("invalid route limit %q, expected <path prefix>=<rate>:<burst>", s)
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || !strings.HasPrefix(kv[0], "/") {
+		return routeLimiter{}, invalid
+	}
+	limits := strings.SplitN(kv[1], ":", 2)
+	rate, err := strconv.ParseFloat(limits[0], 64)
+	if err != nil || rate < 0 {
+		return routeLimiter{}, invalid
+	}
+	burst := int(math.Ceil(rate))
+	if len(limits) == 2 {
+		if burst, err = strconv.Atoi(limits[1]); err != nil {
+			return routeLimiter{}, invalid
+		}
+	}
+	return routeLimiter{prefix: kv[0], limiter: New(rate, burst)}, nil
+}
+
+// Handler wraps next, answering the requests beyond the limits with 429 Too Many Requests
+// and a Retry-After header
+func (g *Guard) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := g.clientIP(r)
+		r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip))
+		if ok, wait := g.global.Allow(ip); !ok {
+			TooManyRequests(w, wait)
+			return
+		}
+		for _, route := range g.routes {
+			if strings.HasPrefix(r.URL.Path, route.prefix) {
+				if ok, wait := route.limiter.Allow(ip); !ok {
+					TooManyRequests(w, wait)
+					return
+				}
+				break
+			}
+		}
+		if g.maxStreams > 0 && g.isStream(r.URL.Path) {
+			if !g.openStream(ip) {
+				TooManyRequests(w, streamRetryAfter)
+				return
+			}
+			defer g.closeStream(ip)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the IP of the client which sent r. Requests sent by a trusted proxy
+// come from the last address of X-Forwarded-For not added by a trusted proxy.
+func (g *Guard) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !g.isTrusted(ip) {
+		return ip
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !g.isTrusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func (g *Guard) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range g.trusted {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// openStream counts a live stream opened by ip, unless it has too many open already
+func (g *Guard) openStream(ip string) bool {
+	g.streamsLock.Lock()
+	defer g.streamsLock.Unlock()
+	if g.streams[ip] >= g.maxStreams {
+		return false
+	}
+	g.streams[ip]++
+	return true
+}
+
+func (g *Guard) closeStream(ip string) {
+	g.streamsLock.Lock()
+	defer g.streamsLock.Unlock()
+	if g.streams[ip]--; g.streams[ip] <= 0 {
+		delete(g.streams, ip)
+	}
+}
+
+// ClientIP returns the IP of the client which sent r, as resolved by the Guard of the
+// server if any, or the remote address of the connection
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// TooManyRequests answers a request beyond the limits, to be retried after wait
+func TooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
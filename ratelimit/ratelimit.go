@@ -0,0 +1,81 @@
+// Package ratelimit bounds the requests made by every client with token buckets: each
+// client gets a bucket of Burst tokens refilled at Rate tokens per second, and every
+// request takes a token, so clients may burst but not exceed the rate for long.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// idleTimeout is the time after which the bucket of a client without requests is dropped.
+// A bucket idle that long is full again, so dropping it doesn't change the limits.
+const idleTimeout = 10 * time.Minute
+
+// Limiter holds a token bucket per key, such as the client IP. It's safe for concurrent use.
+type Limiter struct {
+	// rate is the number of tokens refilled per second, and burst the bucket size
+	rate  float64
+	burst float64
+
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter allowing rate requests per second to every key, with bursts of
+// up to burst requests. A rate of 0 or less disables the limits.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of key. If it's empty, the request isn't allowed
+// and Allow returns the time until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.rate <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the idle buckets, at most once per idleTimeout
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
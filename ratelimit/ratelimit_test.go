@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/config"
+)
+
+func TestLimiter(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		rate     float64
+		burst    int
+		requests int
+		allowed  int
+	}{
+		{"disabled", 0, 1, 10, 10},
+		{"burst", 0.001, 5, 10, 5},
+		{"burst below one", 0.001, 0, 3, 1},
+		{"within burst", 0.001, 10, 10, 10},
+	} {
+		l := New(tc.rate, tc.burst)
+		allowed := 0
+		for i := 0; i < tc.requests; i++ {
+			ok, wait := l.Allow("10.0.0.1")
+			if ok {
+				allowed++
+			} else if wait <= 0 {
+				t.Errorf("%s: request %d denied without a wait", tc.name, i)
+			}
+		}
+		if allowed != tc.allowed {
+			t.Errorf("%s: allowed %d of %d requests, want %d", tc.name, allowed, tc.requests, tc.allowed)
+		}
+		// Every key has its own bucket
+		if ok, _ := l.Allow("10.0.0.2"); !ok {
+			t.Errorf("%s: another key denied", tc.name)
+		}
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l := New(1, 1)
+	if ok, _ := l.Allow("ip"); !ok {
+		t.Fatal("first request denied")
+	}
+	ok, wait := l.Allow("ip")
+	if ok || wait <= 0 || wait > time.Second {
+		t.Fatalf("got allowed %v waiting %s, want denied waiting up to 1s", ok, wait)
+	}
+	// Rewind the bucket instead of sleeping
+	l.buckets["ip"].last = l.buckets["ip"].last.Add(-time.Second)
+	if ok, _ := l.Allow("ip"); !ok {
+		t.Fatal("request denied after the bucket refilled")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := New(1, 1)
+	l.Allow("idle")
+	l.Allow("active")
+	l.buckets["idle"].last = l.buckets["idle"].last.Add(-idleTimeout)
+	l.lastSweep = l.lastSweep.Add(-idleTimeout)
+	l.Allow("active")
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket not dropped")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("active bucket dropped")
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	for _, tc := range []struct {
+		route  string
+		prefix string
+		rate   float64
+		burst  float64
+		err    bool
+	}{
+		{"/api/v1/export=0.5:2", "/api/v1/export", 0.5, 2, false},
+		{"/api/v1/export=2.5", "/api/v1/export", 2.5, 3, false},
+		{"/api/v1/export=0", "/api/v1/export", 0, 1, false},
+		{"api/v1/export=1:1", "", 0, 0, true},
+		{"/api/v1/export", "", 0, 0, true},
+		{"/api/v1/export=fast", "", 0, 0, true},
+		{"/api/v1/export=-1:1", "", 0, 0, true},
+		{"/api/v1/export=1:many", "", 0, 0, true},
+	} {
+		route, err := parseRoute(tc.route)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: got error %v, want error %v", tc.route, err, tc.err)
+			continue
+		}
+		if err == nil && (route.prefix != tc.prefix || route.limiter.rate != tc.rate || route.limiter.burst != tc.burst) {
+			t.Errorf("%s: got %s=%v:%v, want %s=%v:%v", tc.route, route.prefix, route.limiter.rate,
+				route.limiter.burst, tc.prefix, tc.rate, tc.burst)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	g, err := NewGuard(config.RateLimitCfg{TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16", "::1"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		remote    string
+		forwarded string
+		ip        string
+	}{
+		{"203.0.113.7:1234", "", "203.0.113.7"},
+		{"203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+		{"10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "198.51.100.9, 198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "198.51.100.1, not an ip", "10.0.0.1"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"[::1]:1234", "2001:db8::1", "2001:db8::1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if ip := g.clientIP(r); ip != tc.ip {
+			t.Errorf("%s forwarding %q: got %s, want %s", tc.remote, tc.forwarded, ip, tc.ip)
+		}
+	}
+}
+
+func TestNewGuardInvalid(t *testing.T) {
+	for _, cfg := range []config.RateLimitCfg{
+		{Routes: []string{"/api=x"}},
+		{TrustedProxies: []string{"10.0.0.300"}},
+		{TrustedProxies: []string{"10.0.0.0/33"}},
+	} {
+		if _, err := NewGuard(cfg, nil); err == nil {
+			t.Errorf("%+v: accepted", cfg)
+		}
+	}
+}
+
+func TestGuardHandler(t *testing.T) {
+	release := make(chan struct{})
+	g, err := NewGuard(config.RateLimitCfg{
+		Routes:     []string{"/api=0.001:2", "/api/v1/export=0.001:1"},
+		MaxStreams: 1,
+	}, func(path string) bool { return strings.HasSuffix(path, "/live") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := g.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/live") {
+			<-release
+		}
+	}))
+	serve := func(ip, path string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: 429 without Retry-After", path)
+		}
+		return w.Code
+	}
+
+	for i, tc := range []struct {
+		ip   string
+		path string
+		code int
+	}{
+		// The longest prefix applies alone
+		{"10.0.0.1", "/api/v1/export/0a", http.StatusOK},
+		{"10.0.0.1", "/api/v1/export/0a", http.StatusTooManyRequests},
+		{"10.0.0.1", "/api/v1/stats", http.StatusOK},
+		{"10.0.0.1", "/api/v1/stats", http.StatusOK},
+		{"10.0.0.1", "/api/v1/stats", http.StatusTooManyRequests},
+		// Other clients and unlimited routes aren't affected
+		{"10.0.0.2", "/api/v1/export/0a", http.StatusOK},
+		{"10.0.0.1", "/", http.StatusOK},
+	} {
+		if code := serve(tc.ip, tc.path); code != tc.code {
+			t.Errorf("request %d to %s: got %d, want %d", i, tc.path, code, tc.code)
+		}
+	}
+
+	// A second live stream is refused while the first is open
+	done := make(chan int)
+	go func() { done <- serve("10.0.0.3", "/live") }()
+	for {
+		g.streamsLock.Lock()
+		open := g.streams["10.0.0.3"]
+		g.streamsLock.Unlock()
+		if open == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if code := serve("10.0.0.3", "/live"); code != http.StatusTooManyRequests {
+		t.Errorf("second stream: got %d, want 429", code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("first stream: got %d, want 200", code)
+	}
+	if code := serve("10.0.0.3", "/live"); code != http.StatusOK {
+		t.Errorf("stream after the first closed: got %d, want 200", code)
+	}
+}
@@ -0,0 +1,630 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/vocdoni/vocexplorer/analytics"
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/config"
+	"gitlab.com/vocdoni/vocexplorer/history"
+	"gitlab.com/vocdoni/vocexplorer/history/historytypes"
+	"gitlab.com/vocdoni/vocexplorer/tally"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/log"
+)
+
+// APIPrefix is the path prefix for the versioned JSON REST API
+const APIPrefix = "/api/v1"
+
+// maxAPIListSize is the largest page size accepted by list endpoints
+const maxAPIListSize = 100
+
+// entityAnalyticsTTL is the time the analytics of an entity are cached for
+const entityAnalyticsTTL = time.Minute
+
+// validatorReportTTL is the time the validator stats over a window of blocks are cached
+// for, a few blocks
+const validatorReportTTL = time.Minute
+
+// registerAPIRoutes registers the REST API routes, each one backed by the equivalent Source method.
+// The stats history is only served if hist is not nil. The reports computed in the background
+// are cancelled once ctx is done.
+func registerAPIRoutes(ctx context.Context, m *mux.Router, cli Source, hist *history.Recorder) {
+	api := m.PathPrefix(APIPrefix).Subrouter()
+	rs := newReports(ctx)
+
+	api.HandleFunc("/gateway", gatewayInfoHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/stats", statsHandler(cli)).Methods(http.MethodGet)
+	if hist != nil {
+		api.HandleFunc("/stats/history", statsHistoryHandler(hist)).Methods(http.MethodGet)
+	}
+
+	api.HandleFunc("/blocks", blockListHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/blocks/status", blockStatusHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/blocks/hash/{hash}", blockByHashHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/blocks/{height:[0-9]+}", blockHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/blocks/{height:[0-9]+}/txs", blockTxListHandler(cli)).Methods(http.MethodGet)
+
+	api.HandleFunc("/tx/id/{id:[0-9]+}", txByIDHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/tx/{block:[0-9]+}/{index:[0-9]+}", txHandler(cli)).Methods(http.MethodGet)
+
+	api.HandleFunc("/processes", processListHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/count", processCountHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}", processHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}/summary", processSummaryHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}/keys", processKeysHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}/results", processResultsHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}/results/export", processResultsExportHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}/verify", processVerifyHandler(cli, rs)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}/envelopes", envelopeListHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}/envelopes/count", envelopeHeightHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{id}/envelopes/export", envelopesExportHandler(cli)).Methods(http.MethodGet)
+
+	api.HandleFunc("/envelopes/{nullifier}", envelopeHandler(cli)).Methods(http.MethodGet)
+
+	api.HandleFunc("/entities", entityListHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/entities/count", entityCountHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/entities/{id}/analytics", entityAnalyticsHandler(cli, rs)).Methods(http.MethodGet)
+
+	api.HandleFunc("/validators", validatorListHandler(cli)).Methods(http.MethodGet)
+	api.HandleFunc("/validators/stats", validatorStatsHandler(cli, rs)).Methods(http.MethodGet)
+	api.HandleFunc("/validators/{address}/stats", validatorHandler(cli, rs)).Methods(http.MethodGet)
+
+	// Queries only answered by the local indexer
+	if idx, ok := cli.(IndexSource); ok {
+		api.HandleFunc("/index/status", indexStatusHandler(idx)).Methods(http.MethodGet)
+		api.HandleFunc("/entities/{id}/processes", entityProcessesHandler(idx)).Methods(http.MethodGet)
+		api.HandleFunc("/validators/{address}/blocks", proposedBlocksHandler(idx)).Methods(http.MethodGet)
+	}
+}
+
+// apiError is the body returned by every failed API call
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warnf("cannot encode api response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(apiError{Error: err.Error()}); err != nil {
+		log.Warnf("cannot encode api error: %v", err)
+	}
+}
+
+// writeResult writes v, or the error of the upstream call if it failed
+func writeResult(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		writeError(w, upstreamStatus(err), err)
+		return
+	}
+	writeJSON(w, v)
+}
+
+// upstreamStatus returns the status of a failed upstream call: not found if the gateway
+// doesn't know the object requested, and bad gateway if it failed or couldn't be reached
+func upstreamStatus(err error) int {
+	if errors.Is(err, client.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadGateway
+}
+
+// hexVar parses a hex-encoded mux path variable
+func hexVar(r *http.Request, name string) ([]byte, error) {
+	bz, err := util.DecodeHex(mux.Vars(r)[name])
+	if err != nil || len(bz) == 0 {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return bz, nil
+}
+
+// uintVar parses an unsigned integer mux path variable
+func uintVar(r *http.Request, name string) (uint32, error) {
+	n, err := strconv.ParseUint(mux.Vars(r)[name], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return uint32(n), nil
+}
+
+// indexVar parses a non-negative int32 path variable, such as a transaction index
+func indexVar(r *http.Request, name string) (int32, error) {
+	n, err := strconv.ParseUint(mux.Vars(r)[name], 10, 31)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return int32(n), nil
+}
+
+// intQuery parses an integer query parameter, returning def if it's not set
+func intQuery(r *http.Request, name string, def int) (int, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return n, nil
+}
+
+// pageQuery parses the from and listSize query parameters shared by all list endpoints
+func pageQuery(r *http.Request) (from, listSize int, err error) {
+	if from, err = intQuery(r, "from", 0); err != nil {
+		return 0, 0, err
+	}
+	if listSize, err = intQuery(r, "listSize", config.ListSize); err != nil {
+		return 0, 0, err
+	}
+	if from < 0 || listSize <= 0 || listSize > maxAPIListSize {
+		return 0, 0, fmt.Errorf("listSize must be between 1 and %d, from must be positive", maxAPIListSize)
+	}
+	return from, listSize, nil
+}
+
+func gatewayInfoHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := cli.GetGatewayInfo(); err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, map[string]bool{"ok": true})
+	}
+}
+
+func statsHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := cli.GetStats()
+		writeResult(w, stats, err)
+	}
+}
+
+// statsHistoryHandler returns the stats sampled within the range query parameter, a day by default
+func statsHistoryHandler(hist *history.Recorder) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rng := r.URL.Query().Get("range")
+		if rng == "" {
+			rng = historytypes.RangeDay
+		}
+		series, err := hist.Series(rng)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, series)
+	}
+}
+
+// blockStatus is the response of the block status endpoint
+type blockStatus struct {
+	BlockTime      *[5]int32 `json:"blockTime"`
+	Height         *uint32   `json:"height"`
+	BlockTimestamp int32     `json:"blockTimestamp"`
+}
+
+func blockStatusHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		blockTime, height, timestamp, err := cli.GetBlockStatus()
+		writeResult(w, &blockStatus{BlockTime: blockTime, Height: height, BlockTimestamp: timestamp}, err)
+	}
+}
+
+func blockListHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, listSize, err := pageQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		blocks, err := cli.GetBlockList(from, listSize)
+		writeResult(w, blocks, err)
+	}
+}
+
+func blockHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		height, err := uintVar(r, "height")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		block, err := cli.GetBlock(height)
+		writeResult(w, block, err)
+	}
+}
+
+func blockByHashHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash, err := hexVar(r, "hash")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		block, err := cli.GetBlockByHash(hash)
+		writeResult(w, block, err)
+	}
+}
+
+func blockTxListHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		height, err := uintVar(r, "height")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		from, listSize, err := pageQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		txs, err := cli.GetTxListForBlock(height, from, listSize)
+		writeResult(w, txs, err)
+	}
+}
+
+func txHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		height, err := uintVar(r, "block")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		index, err := indexVar(r, "index")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		tx, err := cli.GetTx(height, index)
+		writeResult(w, tx, err)
+	}
+}
+
+func txByIDHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uintVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		tx, err := cli.GetTxByID(id)
+		writeResult(w, tx, err)
+	}
+}
+
+func processListHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, listSize, err := pageQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		q := r.URL.Query()
+		var entityID []byte
+		if eid := q.Get("entityId"); eid != "" {
+			if entityID, err = util.DecodeHex(eid); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid entityId"))
+				return
+			}
+		}
+		namespace, err := intQuery(r, "namespace", int(config.DefaultNamespace))
+		if err != nil || namespace < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid namespace"))
+			return
+		}
+		withResults := q.Get("withResults") == "true"
+		processes, err := cli.GetProcessList(entityID, q.Get("searchTerm"), uint32(namespace),
+			q.Get("status"), withResults, q.Get("srcNetId"), from, listSize)
+		writeResult(w, processes, err)
+	}
+}
+
+func processCountHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var entityID []byte
+		if eid := r.URL.Query().Get("entityId"); eid != "" {
+			var err error
+			if entityID, err = util.DecodeHex(eid); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid entityId"))
+				return
+			}
+		}
+		count, err := cli.GetProcessCount(entityID)
+		writeResult(w, map[string]int64{"count": count}, err)
+	}
+}
+
+func processHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		process, err := cli.GetProcess(pid)
+		writeResult(w, process, err)
+	}
+}
+
+func processSummaryHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		summary, err := cli.GetProcessSummary(pid)
+		writeResult(w, summary, err)
+	}
+}
+
+// processKeys is the response of the process keys endpoint
+type processKeys struct {
+	PublicKeys  []client.Key `json:"publicKeys"`
+	PrivateKeys []client.Key `json:"privateKeys"`
+}
+
+func processKeysHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		pubKeys, privKeys, err := cli.GetProcessKeys(pid)
+		writeResult(w, &processKeys{PublicKeys: pubKeys, PrivateKeys: privKeys}, err)
+	}
+}
+
+// processResults is the response of the process results endpoint
+type processResults struct {
+	Results [][]string `json:"results"`
+	State   string     `json:"state"`
+	Type    string     `json:"type"`
+	Final   bool       `json:"final"`
+}
+
+func processResultsHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		results, state, tp, final, err := cli.GetResults(pid)
+		writeResult(w, &processResults{Results: results, State: state, Type: tp, Final: final}, err)
+	}
+}
+
+// processVerifyHandler recomputes the results of an ended process from its envelopes and
+// compares them with the reported ones. Reports are cached for an hour once the results
+// are final, and for a minute until then.
+func processVerifyHandler(cli Source, rs *reports) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rs.serve(w, r, "verify/"+util.HexToString(pid), func(ctx context.Context) (interface{}, time.Duration, error) {
+			report, err := tally.Verify(ctx, cli, pid)
+			if err != nil {
+				return nil, 0, err
+			}
+			if report.Final {
+				return report, time.Hour, nil
+			}
+			return report, time.Minute, nil
+		})
+	}
+}
+
+func envelopeListHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		from, listSize, err := pageQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		envelopes, err := cli.GetEnvelopeList(pid, from, listSize, r.URL.Query().Get("searchTerm"))
+		writeResult(w, envelopes, err)
+	}
+}
+
+func envelopeHeightHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		height, err := cli.GetEnvelopeHeight(pid)
+		writeResult(w, map[string]uint32{"count": height}, err)
+	}
+}
+
+func envelopeHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nullifier, err := hexVar(r, "nullifier")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		envelope, err := cli.GetEnvelope(nullifier)
+		writeResult(w, envelope, err)
+	}
+}
+
+func entityListHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, listSize, err := pageQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		entities, err := cli.GetEntityList(r.URL.Query().Get("searchTerm"), listSize, from)
+		writeResult(w, entities, err)
+	}
+}
+
+func entityCountHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		count, err := cli.GetEntityCount()
+		writeResult(w, map[string]int64{"count": count}, err)
+	}
+}
+
+// entityAnalyticsHandler returns the stats of an entity across all its processes, cached
+// for entityAnalyticsTTL since computing them walks every process
+func entityAnalyticsHandler(cli Source, rs *reports) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rs.serve(w, r, "entity/"+util.HexToString(eid), func(ctx context.Context) (interface{}, time.Duration, error) {
+			stats, err := analytics.Entity(ctx, cli, eid)
+			return stats, entityAnalyticsTTL, err
+		})
+	}
+}
+
+func validatorListHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		validators, err := cli.GetValidatorList()
+		writeResult(w, validators, err)
+	}
+}
+
+// validatorWindow parses the window query parameter of the validator stats
+func validatorWindow(r *http.Request) (int, error) {
+	window, err := intQuery(r, "window", analytics.DefaultValidatorWindow)
+	if err != nil {
+		return 0, err
+	}
+	return window, analytics.ValidWindow(window)
+}
+
+// validatorReport waits for the validator stats over the window of blocks requested, as
+// reports.wait does. The report of a window is computed once for both validator stats
+// routes, and cached for validatorReportTTL.
+func validatorReport(w http.ResponseWriter, r *http.Request, cli Source, rs *reports) (*analytics.ValidatorReport, bool) {
+	window, err := validatorWindow(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	data, ok := rs.wait(w, r, "validators/"+strconv.Itoa(window), func(ctx context.Context) (interface{}, time.Duration, error) {
+		report, err := analytics.Validators(ctx, cli, window)
+		return report, validatorReportTTL, err
+	})
+	if !ok {
+		return nil, false
+	}
+	report := new(analytics.ValidatorReport)
+	if err := json.Unmarshal(data, report); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return report, true
+}
+
+// validatorStatsHandler returns the block proposal stats of every validator over the latest
+// window blocks, without their proposal history
+func validatorStatsHandler(cli Source, rs *reports) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, ok := validatorReport(w, r, cli, rs)
+		if !ok {
+			return
+		}
+		for _, v := range report.Validators {
+			v.History = nil
+		}
+		writeJSON(w, report)
+	}
+}
+
+// validatorHandler returns the block proposal stats and history of a validator over the
+// latest window blocks
+func validatorHandler(cli Source, rs *reports) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address, err := hexVar(r, "address")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		report, ok := validatorReport(w, r, cli, rs)
+		if !ok {
+			return
+		}
+		stats := report.Find(address)
+		if stats == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("validator not found"))
+			return
+		}
+		writeJSON(w, stats)
+	}
+}
+
+func indexStatusHandler(idx IndexSource) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, idx.Status())
+	}
+}
+
+func entityProcessesHandler(idx IndexSource) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		pids, err := idx.GetEntityProcessIDs(eid)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, pids)
+	}
+}
+
+func proposedBlocksHandler(idx IndexSource) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address, err := hexVar(r, "address")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		from, listSize, err := pageQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		heights, err := idx.GetBlocksByProposer(address, from, listSize)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, heights)
+	}
+}
@@ -0,0 +1,328 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/export"
+	"gitlab.com/vocdoni/vocexplorer/mockgateway"
+	"gitlab.com/vocdoni/vocexplorer/tally"
+	"gitlab.com/vocdoni/vocexplorer/vote"
+	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+)
+
+var (
+	testEnded     = fmt.Sprintf("%064x", 0xa1)
+	testRunning   = fmt.Sprintf("%064x", 0xa2)
+	testUnknown   = fmt.Sprintf("%064x", 0xbb)
+	testNullifier = fmt.Sprintf("%064x", 0xf0)
+	testEntity    = "e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1"
+	testValidator = "a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1"
+)
+
+// newTestAPI starts a gateway serving the default fixtures and the REST API backed by it
+func newTestAPI(t *testing.T) (*mockgateway.Gateway, *client.Client, *httptest.Server) {
+	t.Helper()
+	gw, cli := mockgateway.Start(t, nil)
+	m := mux.NewRouter()
+	registerAPIRoutes(context.Background(), m, cli, nil)
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	return gw, cli, srv
+}
+
+// get returns the status and body of a GET request to the API
+func get(t *testing.T, srv *httptest.Server, path string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + APIPrefix + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestAPIStatus(t *testing.T) {
+	_, _, srv := newTestAPI(t)
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/gateway", http.StatusOK},
+		{"/stats", http.StatusOK},
+		{"/stats/history", http.StatusNotFound},
+		{"/blocks", http.StatusOK},
+		{"/blocks?from=x", http.StatusBadRequest},
+		{"/blocks/status", http.StatusOK},
+		{"/blocks/hash/" + fmt.Sprintf("%064x", 3), http.StatusOK},
+		{"/blocks/hash/zz", http.StatusBadRequest},
+		{"/blocks/hash/" + testUnknown, http.StatusNotFound},
+		{"/blocks/3", http.StatusOK},
+		{"/blocks/99", http.StatusNotFound},
+		{"/blocks/x", http.StatusNotFound},
+		{"/blocks/3/txs", http.StatusOK},
+		{"/tx/id/1", http.StatusOK},
+		{"/tx/id/99", http.StatusNotFound},
+		{"/tx/3/0", http.StatusOK},
+		{"/tx/3/5", http.StatusNotFound},
+		{"/tx/3/2147483647", http.StatusNotFound},
+		{"/tx/3/2147483648", http.StatusBadRequest},
+		{"/tx/3/4294967296", http.StatusBadRequest},
+		{"/processes", http.StatusOK},
+		{"/processes?listSize=1000", http.StatusBadRequest},
+		{"/processes/count", http.StatusOK},
+		{"/processes/" + testEnded, http.StatusOK},
+		{"/processes/zz", http.StatusBadRequest},
+		{"/processes/" + testUnknown, http.StatusNotFound},
+		{"/processes/" + testEnded + "/summary", http.StatusOK},
+		{"/processes/" + testEnded + "/keys", http.StatusOK},
+		{"/processes/" + testEnded + "/results", http.StatusOK},
+		{"/processes/" + testRunning + "/results", http.StatusOK},
+		{"/processes/" + testUnknown + "/results", http.StatusNotFound},
+		{"/processes/" + testEnded + "/results/export", http.StatusOK},
+		{"/processes/" + testEnded + "/verify", http.StatusOK},
+		{"/processes/" + testRunning + "/verify", http.StatusBadGateway},
+		{"/processes/" + testUnknown + "/verify", http.StatusNotFound},
+		{"/processes/" + testEnded + "/envelopes", http.StatusOK},
+		{"/processes/" + testEnded + "/envelopes/count", http.StatusOK},
+		{"/processes/" + testEnded + "/envelopes/export", http.StatusOK},
+		{"/envelopes/" + testNullifier, http.StatusOK},
+		{"/envelopes/" + testUnknown, http.StatusNotFound},
+		{"/entities", http.StatusOK},
+		{"/entities/count", http.StatusOK},
+		{"/entities/" + testEntity + "/analytics", http.StatusOK},
+		{"/entities/zz/analytics", http.StatusBadRequest},
+		{"/validators", http.StatusOK},
+		{"/validators/stats", http.StatusOK},
+		{"/validators/stats?window=0", http.StatusBadRequest},
+		{"/validators/stats?window=5", http.StatusBadRequest},
+		{"/validators/stats?window=100", http.StatusOK},
+		{"/validators/" + testValidator + "/stats", http.StatusOK},
+		{"/validators/ffff/stats", http.StatusNotFound},
+		// Only answered by the local indexer
+		{"/index/status", http.StatusNotFound},
+	} {
+		if status, body := get(t, srv, tc.path); status != tc.status {
+			t.Errorf("GET %s: got %d, want %d: %s", tc.path, status, tc.status, body)
+		}
+	}
+}
+
+func TestAPIConcurrent(t *testing.T) {
+	gw, _, srv := newTestAPI(t)
+	gw.SetFault("getBlock", mockgateway.Fault{Latency: 10 * time.Millisecond})
+	paths := []string{
+		"/blocks/3",
+		"/blocks/status",
+		"/stats",
+		"/processes/" + testEnded,
+		"/processes/" + testEnded + "/verify",
+		"/validators/stats",
+		"/entities/" + testEntity + "/analytics",
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		for _, path := range paths {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+				resp, err := http.Get(srv.URL + APIPrefix + path)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("GET %s: got %d", path, resp.StatusCode)
+				}
+			}(path)
+		}
+	}
+	wg.Wait()
+}
+
+func TestAPIGatewayFailures(t *testing.T) {
+	gw, cli, srv := newTestAPI(t)
+
+	gw.SetFault("getBlock", mockgateway.Fault{Drop: true})
+	if status, body := get(t, srv, "/blocks/3"); status != http.StatusBadGateway {
+		t.Fatalf("gateway dropping: got %d, want 502: %s", status, body)
+	}
+	gw.SetFault("getBlock", mockgateway.Fault{Message: "unavailable"})
+	if status, body := get(t, srv, "/blocks/3"); status != http.StatusBadGateway {
+		t.Fatalf("gateway failing: got %d, want 502: %s", status, body)
+	}
+	gw.ClearFaults()
+	if status, body := get(t, srv, "/blocks/3"); status != http.StatusOK {
+		t.Fatalf("gateway back: got %d, want 200: %s", status, body)
+	}
+
+	if err := cli.SetTrustedSigners([]string{gw.SignerAddress()}, true); err != nil {
+		t.Fatal(err)
+	}
+	gw.SetFault("", mockgateway.Fault{BadSignature: true})
+	if status, body := get(t, srv, "/stats"); status != http.StatusBadGateway {
+		t.Fatalf("untrusted signer: got %d, want 502: %s", status, body)
+	}
+}
+
+func TestEnvelopesExportTrailer(t *testing.T) {
+	gw, _, srv := newTestAPI(t)
+	path := "/processes/" + testEnded + "/envelopes/export"
+	lastLine := func(format string) string {
+		t.Helper()
+		status, body := get(t, srv, path+"?format="+format)
+		if status != http.StatusOK {
+			t.Fatalf("got %d, want 200: %s", status, body)
+		}
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		return lines[len(lines)-1]
+	}
+
+	if line := lastLine("ndjson"); !strings.HasPrefix(line, `{"complete":true,`) {
+		t.Errorf("complete ndjson export ends with %s", line)
+	}
+	if line := lastLine("csv"); !strings.HasPrefix(line, export.CSVEndMarker+",") {
+		t.Errorf("complete csv export ends with %s", line)
+	}
+	gw.SetFault("getEnvelope", mockgateway.Fault{Message: "unavailable"})
+	if line := lastLine("ndjson"); !strings.HasPrefix(line, `{"complete":false,`) || !strings.Contains(line, "unavailable") {
+		t.Errorf("interrupted ndjson export ends with %s", line)
+	}
+	if line := lastLine("csv"); !strings.HasPrefix(line, export.CSVErrorMarker+",0,") {
+		t.Errorf("interrupted csv export ends with %s", line)
+	}
+}
+
+func TestEncryptedVotes(t *testing.T) {
+	_, _, srv := newTestAPI(t)
+
+	// The stored vote can't be read without the keys
+	status, body := get(t, srv, "/envelopes/"+testNullifier)
+	if status != http.StatusOK {
+		t.Fatalf("got %d, want 200: %s", status, body)
+	}
+	var pkg indexertypes.EnvelopePackage
+	if err := json.Unmarshal([]byte(body), &pkg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vote.Decode(pkg.VotePackage, nil); err == nil || len(pkg.EncryptionKeyIndexes) == 0 {
+		t.Fatalf("vote not encrypted: %s", pkg.VotePackage)
+	}
+
+	// Both votes are decrypted with the revealed keys and counted
+	status, body = get(t, srv, "/processes/"+testEnded+"/verify")
+	if status != http.StatusOK {
+		t.Fatalf("got %d, want 200: %s", status, body)
+	}
+	var report tally.Report
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != tally.StatusMatch || report.Counted != 2 || report.Undecoded != 0 {
+		t.Fatalf("got %s with %d counted and %d undecoded, want a match of 2 votes: %s",
+			report.Status, report.Counted, report.Undecoded, body)
+	}
+
+	status, body = get(t, srv, "/processes/"+testEnded+"/envelopes/export?format=ndjson")
+	if status != http.StatusOK {
+		t.Fatalf("got %d, want 200: %s", status, body)
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		var e export.Envelope
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.VotePackage == nil || fmt.Sprint(e.VotePackage.Votes) != "[1 0]" || len(e.EncryptionKeyIndexes) == 0 {
+			t.Errorf("envelope %s with keys %v not decrypted: %s", e.Nullifier, e.EncryptionKeyIndexes, e.DecodeError)
+		}
+	}
+	if len(lines) != 3 {
+		t.Errorf("got %d lines, want 2 envelopes and the trailer", len(lines))
+	}
+}
+
+func TestAPIReportsCached(t *testing.T) {
+	gw, _, srv := newTestAPI(t)
+	for i := 0; i < 3; i++ {
+		if status, body := get(t, srv, "/validators/stats?window=100"); status != http.StatusOK {
+			t.Fatalf("got %d: %s", status, body)
+		}
+		if status, body := get(t, srv, "/validators/"+testValidator+"/stats?window=100"); status != http.StatusOK {
+			t.Fatalf("got %d: %s", status, body)
+		}
+	}
+	// Both routes are served from a single report per window
+	if n := gw.Requests("getValidatorList"); n != 1 {
+		t.Fatalf("got %d getValidatorList requests, want 1", n)
+	}
+}
+
+func TestReportsExpire(t *testing.T) {
+	rs := newReports(context.Background())
+	var computed int32
+	compute := func(ctx context.Context) (interface{}, time.Duration, error) {
+		return atomic.AddInt32(&computed, 1), 50 * time.Millisecond, nil
+	}
+	serve := func() string {
+		w := httptest.NewRecorder()
+		rs.serve(w, httptest.NewRequest(http.MethodGet, "/", nil), "test", compute)
+		return w.Body.String()
+	}
+	if first, second := serve(), serve(); first != "1\n" || second != first {
+		t.Fatalf("got %q then %q, want the report cached", first, second)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := serve(); got != "2\n" {
+		t.Fatalf("got %q, want the report computed again once expired", got)
+	}
+}
+
+func TestReportsBounded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rs := newReports(ctx)
+	started := make(chan struct{}, maxBackgroundReports)
+	compute := func(ctx context.Context) (interface{}, time.Duration, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, 0, ctx.Err()
+	}
+	for i := 0; i < maxBackgroundReports; i++ {
+		if rs.start(fmt.Sprint(i), compute) == nil {
+			t.Fatalf("report %d not started", i)
+		}
+		<-started
+	}
+	w := httptest.NewRecorder()
+	rs.serve(w, httptest.NewRequest(http.MethodGet, "/", nil), "one more", compute)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("got %d, want 503 with Retry-After while every slot is taken", w.Code)
+	}
+	// Cancelling the server context stops the reports and frees their slots
+	c := rs.start("0", compute)
+	cancel()
+	<-c.done
+	if c.err != context.Canceled {
+		t.Fatalf("got %v, want the report cancelled", c.err)
+	}
+	// Blocks until every slot is released
+	for i := 0; i < maxBackgroundReports; i++ {
+		rs.slots <- struct{}{}
+	}
+}
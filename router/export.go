@@ -0,0 +1,136 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gitlab.com/vocdoni/vocexplorer/export"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/log"
+)
+
+// Export formats accepted by the format query parameter of the export endpoints
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// exportFlushInterval is the number of envelopes written between flushes of an export stream
+const exportFlushInterval = 64
+
+// exportFormat parses the format query parameter, defaulting to the first of formats
+func exportFormat(r *http.Request, formats ...string) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return formats[0], nil
+	}
+	for _, f := range formats {
+		if format == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid format, must be one of %v", formats)
+}
+
+// setAttachment makes the browser download the response as filename
+func setAttachment(w http.ResponseWriter, filename, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+// processResultsExportHandler serves the results of a process as a JSON or CSV download
+func processResultsExportHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		format, err := exportFormat(r, formatJSON, formatCSV)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		results, err := export.ProcessResults(cli, pid)
+		if err != nil {
+			writeError(w, upstreamStatus(err), err)
+			return
+		}
+		filename := fmt.Sprintf("process-%s-results.%s", util.HexToString(pid), format)
+		switch format {
+		case formatCSV:
+			setAttachment(w, filename, "text/csv")
+			if err := results.WriteCSV(w); err != nil {
+				log.Warnf("cannot write results csv: %v", err)
+			}
+		default:
+			setAttachment(w, filename, "application/json")
+			writeJSON(w, results)
+		}
+	}
+}
+
+// envelopesExportHandler streams every envelope of a process as NDJSON or CSV. The
+// X-Envelope-Count header tells the number of envelopes when the export started, and the
+// export ends with a trailer telling whether it's complete or a gateway error interrupted it.
+func envelopesExportHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		format, err := exportFormat(r, formatNDJSON, formatCSV)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		count, err := cli.GetEnvelopeHeight(pid)
+		if err != nil {
+			writeError(w, upstreamStatus(err), err)
+			return
+		}
+
+		header := http.Header{}
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+			fmt.Sprintf("process-%s-envelopes.%s", util.HexToString(pid), format)))
+		header.Set("X-Envelope-Count", strconv.FormatUint(uint64(count), 10))
+		if format == formatCSV {
+			header.Set("Content-Type", "text/csv")
+		} else {
+			header.Set("Content-Type", "application/x-ndjson")
+		}
+		s := newStream(w, header)
+		var ew export.EnvelopeWriter
+		if format == formatCSV {
+			ew = export.NewCSVWriter(s)
+		} else {
+			ew = export.NewNDJSONWriter(s)
+		}
+
+		written := 0
+		err = export.Envelopes(r.Context(), cli, pid, func(e *export.Envelope) error {
+			if err := ew.Write(e); err != nil {
+				return err
+			}
+			if written++; written%exportFlushInterval == 0 {
+				if err := ew.Flush(); err != nil {
+					return err
+				}
+				return s.flush()
+			}
+			return nil
+		})
+		if err != nil {
+			log.Warnf("envelope export of %x stopped after %d envelopes: %v", pid, written, err)
+		}
+		if err := ew.End(written, err); err != nil {
+			return
+		}
+		if err := ew.Flush(); err == nil {
+			s.flush()
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package router
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/log"
+)
+
+const (
+	// feedSize is the number of entries in every feed
+	feedSize = 20
+	// feedMaxAge is the time feed readers and proxies may cache a feed
+	feedMaxAge = 60
+	// atomNS is the Atom XML namespace
+	atomNS = "http://www.w3.org/2005/Atom"
+)
+
+// atomFeed is an Atom feed document, as in RFC 4287
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+// registerFeedRoutes registers the Atom feeds of the latest processes and blocks, whose
+// ids and links start with host, the URL the explorer is served at
+func registerFeedRoutes(m *mux.Router, cli Source, host string) {
+	m.HandleFunc("/feeds/processes.atom", processesFeedHandler(cli, host)).Methods(http.MethodGet)
+	m.HandleFunc("/feeds/blocks.atom", blocksFeedHandler(cli, host)).Methods(http.MethodGet)
+	m.HandleFunc("/feeds/entity/{id:[0-9a-fA-Fx]+}.atom", entityFeedHandler(cli, host)).Methods(http.MethodGet)
+}
+
+// processesFeedHandler serves the latest processes of every entity
+func processesFeedHandler(cli Source, host string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		base := host + networkPrefix(r)
+		feed, err := processFeed(cli, base, nil)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		feed.Title = "Vochain processes"
+		feed.Links = append(feed.Links, atomLink{Rel: "alternate", Type: "text/html", Href: base + "/processes"})
+		writeFeed(w, host+r.URL.Path, feed)
+	}
+}
+
+// entityFeedHandler serves the latest processes of an entity
+func entityFeedHandler(cli Source, host string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eid, err := hexVar(r, "id")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		base := host + networkPrefix(r)
+		feed, err := processFeed(cli, base, eid)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		feed.Title = "Vochain processes of entity " + util.HexToString(eid)
+		feed.Links = append(feed.Links, atomLink{Rel: "alternate", Type: "text/html",
+			Href: base + "/entity/" + util.HexToString(eid)})
+		writeFeed(w, host+r.URL.Path, feed)
+	}
+}
+
+// processFeed returns the feed of the latest processes, of the entity eid if not nil. Each
+// entry is updated when its process starts and again when it ends, so readers notice results.
+func processFeed(cli Source, base string, eid []byte) (*atomFeed, error) {
+	clock, err := newBlockClock(cli)
+	if err != nil {
+		return nil, err
+	}
+	count, err := cli.GetProcessCount(eid)
+	if err != nil {
+		return nil, err
+	}
+	// Processes are listed oldest first, so list the last page
+	pids, err := cli.GetProcessList(eid, "", 0, "", false, "", util.Max(int(count)-feedSize, 0), feedSize)
+	if err != nil {
+		return nil, err
+	}
+	feed := &atomFeed{}
+	for i := len(pids) - 1; i >= 0; i-- {
+		pid, err := util.DecodeHex(pids[i])
+		if err != nil {
+			log.Warnf("feed: invalid process id %s", pids[i])
+			continue
+		}
+		summary, err := cli.GetProcessSummary(pid)
+		if err != nil {
+			return nil, err
+		}
+		if summary == nil {
+			continue
+		}
+		id := util.HexToString(pid)
+		endBlock := summary.StartBlock + summary.BlockCount
+		updated := clock.at(summary.StartBlock)
+		title := "Process " + id + " " + strings.ToLower(summary.State)
+		switch summary.State {
+		case "ENDED", "CANCELED", "RESULTS":
+			updated = clock.at(endBlock)
+		}
+		if summary.State == "RESULTS" {
+			title = "Results of process " + id
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      base + "/process/" + id,
+			Title:   title,
+			Updated: updated,
+			Link:    atomLink{Rel: "alternate", Type: "text/html", Href: base + "/process/" + id},
+			Summary: processDescription(summary),
+		})
+	}
+	return feed, nil
+}
+
+// blocksFeedHandler serves the latest blocks
+func blocksFeedHandler(cli Source, host string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, height, _, err := cli.GetBlockStatus()
+		if err != nil || height == nil {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("cannot get the chain height: %v", err))
+			return
+		}
+		// The block at height is still being built
+		blocks, err := cli.GetBlockList(util.Max(int(*height)-feedSize, 0), feedSize)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		base := host + networkPrefix(r)
+		feed := &atomFeed{
+			Title: "Vochain blocks",
+			Links: []atomLink{{Rel: "alternate", Type: "text/html", Href: base + "/blocks"}},
+		}
+		for i := len(blocks) - 1; i >= 0; i-- {
+			block := blocks[i]
+			if block == nil {
+				continue
+			}
+			link := fmt.Sprintf("%s/block/%d", base, block.Height)
+			text := fmt.Sprintf("Block %d, hash %s, with %d transactions, proposed by %s.",
+				block.Height, block.Hash, block.NumTxs, block.ProposerAddress)
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID:      link,
+				Title:   fmt.Sprintf("Block %d", block.Height),
+				Updated: block.Timestamp.UTC().Format(time.RFC3339),
+				Link:    atomLink{Rel: "alternate", Type: "text/html", Href: link},
+				Summary: text,
+			})
+		}
+		writeFeed(w, host+r.URL.Path, feed)
+	}
+}
+
+// blockClock estimates the time of a block from the latest one and the average block time
+type blockClock struct {
+	height    uint32
+	timestamp time.Time
+	blockTime time.Duration
+}
+
+func newBlockClock(cli Source) (*blockClock, error) {
+	blockTimes, height, timestamp, err := cli.GetBlockStatus()
+	if err != nil {
+		return nil, err
+	}
+	if height == nil {
+		return nil, fmt.Errorf("cannot get the chain height")
+	}
+	c := &blockClock{height: *height, timestamp: time.Unix(int64(timestamp), 0), blockTime: 10 * time.Second}
+	if blockTimes != nil {
+		for _, bt := range blockTimes {
+			if bt > 0 {
+				c.blockTime = time.Duration(bt) * time.Millisecond
+				break
+			}
+		}
+	}
+	return c, nil
+}
+
+// at returns the estimated time of block height, as an Atom date. Future blocks are dated
+// as the latest one, so entries aren't updated before they happen.
+func (c *blockClock) at(height uint32) string {
+	t := c.timestamp
+	if height < c.height {
+		t = t.Add(-time.Duration(c.height-height) * c.blockTime)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeFeed completes feed, served at the URL self, with the fields shared by every feed and writes it
+func writeFeed(w http.ResponseWriter, self string, feed *atomFeed) {
+	feed.NS = atomNS
+	feed.ID = self
+	feed.Author = atomAuthor{Name: "Vochain Block Explorer"}
+	feed.Links = append(feed.Links, atomLink{Rel: "self", Type: "application/atom+xml", Href: self})
+	// The feed is as recent as its latest entry, or the epoch if it has none
+	feed.Updated = time.Unix(0, 0).UTC().Format(time.RFC3339)
+	for _, e := range feed.Entries {
+		if e.Updated > feed.Updated {
+			feed.Updated = e.Updated
+		}
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", feedMaxAge))
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Warnf("cannot encode feed: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// readyTimeout bounds the time the gateway is given to answer a readiness check
+const readyTimeout = 5 * time.Second
+
+// staticBundle are the files the explorer pages can't load without
+var staticBundle = []string{"index.html", "main.wasm", "wasm_exec.js"}
+
+// readiness is the body of a readiness check, with the result of every check by name,
+// "ok" or the reason it failed
+type readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// RegisterHealthRoutes registers the probes of the server for container orchestrators:
+// /healthz answers as long as the process serves requests, and /readyz once cli reaches
+// the gateway, the static bundle is built and, if cli is the local index, it has caught
+// up with the chain. They're registered once, at the root of the explorer.
+func RegisterHealthRoutes(m *mux.Router, cli Source) {
+	m.HandleFunc("/healthz", healthzHandler).Methods(http.MethodGet, http.MethodHead)
+	m.HandleFunc("/readyz", readyzHandler(cli)).Methods(http.MethodGet, http.MethodHead)
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func readyzHandler(cli Source) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]error{
+			"gateway": checkGateway(cli),
+			"static":  checkStatic("static"),
+		}
+		if idx, ok := cli.(IndexSource); ok {
+			checks["indexer"] = checkIndexer(idx)
+		}
+		ready := readiness{Ready: true, Checks: make(map[string]string)}
+		for name, err := range checks {
+			if err != nil {
+				ready.Ready = false
+				ready.Checks[name] = err.Error()
+			} else {
+				ready.Checks[name] = "ok"
+			}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if !ready.Ready {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		writeJSON(w, ready)
+	}
+}
+
+// checkGateway returns an error unless cli gets the gateway info within readyTimeout
+func checkGateway(cli Source) error {
+	done := make(chan error, 1)
+	go func() { done <- cli.GetGatewayInfo() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("gateway unavailable: %v", err)
+		}
+		return nil
+	case <-time.After(readyTimeout):
+		return fmt.Errorf("gateway unavailable: no answer in %s", readyTimeout)
+	}
+}
+
+// checkStatic returns an error if a file of the static bundle is missing from dir
+func checkStatic(dir string) error {
+	for _, name := range staticBundle {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("static bundle incomplete: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkIndexer returns an error until the index has caught up with the chain
+func checkIndexer(idx IndexSource) error {
+	st := idx.Status()
+	if !st.Synced {
+		return fmt.Errorf("indexer at height %d of %d", st.Height, st.ChainTip)
+	}
+	return nil
+}
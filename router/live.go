@@ -0,0 +1,174 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/vocdoni/vocexplorer/config"
+	"gitlab.com/vocdoni/vocexplorer/live"
+	"gitlab.com/vocdoni/vocexplorer/live/livetypes"
+	"go.vocdoni.io/dvote/log"
+	"nhooyr.io/websocket"
+)
+
+// LivePrefix is the path prefix of the live event streams
+const LivePrefix = APIPrefix + "/live"
+
+// keepAliveInterval is the time between keep-alive messages on idle live streams
+const keepAliveInterval = 30 * time.Second
+
+// recentBlocks is the number of block events sent first on new live streams, enough for
+// the pages to render their lists of latest blocks without asking the gateway
+const recentBlocks = config.ListSize
+
+// registerLiveRoutes registers the live event streams, pushing the events of feed
+// over websockets and Server-Sent Events
+func registerLiveRoutes(m *mux.Router, feed *live.Feed) {
+	m.HandleFunc(LivePrefix+"/ws", liveWsHandler(feed)).Methods(http.MethodGet)
+	m.HandleFunc(LivePrefix+"/events", liveEventsHandler(feed)).Methods(http.MethodGet)
+}
+
+// liveWsHandler pushes every event as a JSON text message, starting with the latest blocks
+func liveWsHandler(feed *live.Feed) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			log.Debugf("cannot accept live websocket: %v", err)
+			return
+		}
+		defer conn.Close(websocket.StatusNormalClosure, "")
+		events, cancel := feed.Subscribe()
+		defer cancel()
+		// Incoming messages are ignored, ctx is done once the browser closes the socket
+		ctx := conn.CloseRead(r.Context())
+
+		var lastSeq uint64
+		for _, ev := range feed.Recent(recentBlocks) {
+			if err := writeWsEvent(ctx, conn, &ev); err != nil {
+				return
+			}
+			if ev.Seq > lastSeq {
+				lastSeq = ev.Seq
+			}
+		}
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-keepAlive.C:
+				if err := conn.Ping(ctx); err != nil {
+					return
+				}
+			case ev, ok := <-events:
+				if !ok {
+					conn.Close(websocket.StatusTryAgainLater, "subscriber too slow")
+					return
+				}
+				if ev.Seq <= lastSeq {
+					continue
+				}
+				if err := writeWsEvent(ctx, conn, &ev); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func writeWsEvent(ctx context.Context, conn *websocket.Conn, ev *livetypes.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, keepAliveInterval)
+	defer cancel()
+	return conn.Write(ctx, websocket.MessageText, data)
+}
+
+// liveEventsHandler pushes every event as a Server-Sent Event, named after the event type
+// and with its sequence number as id. Clients reconnecting with a Last-Event-ID header
+// receive the events they missed first, as long as the feed still keeps them, and new
+// clients receive the latest blocks first.
+func liveEventsHandler(feed *live.Feed) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var lastSeq uint64
+		if id := r.Header.Get("Last-Event-ID"); id != "" {
+			seq, err := strconv.ParseUint(id, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID"))
+				return
+			}
+			lastSeq = seq
+		}
+		events, cancel := feed.Subscribe()
+		defer cancel()
+		stream, err := newEventStream(w)
+		if err != nil {
+			return
+		}
+
+		backlog := feed.Since(lastSeq)
+		if lastSeq == 0 {
+			backlog = feed.Recent(recentBlocks)
+		}
+		for _, ev := range backlog {
+			if err := stream.send(&ev); err != nil {
+				return
+			}
+			if ev.Seq > lastSeq {
+				lastSeq = ev.Seq
+			}
+		}
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if err := stream.write(": keep-alive\n\n"); err != nil {
+					return
+				}
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				// Skip the events already sent from the backlog
+				if ev.Seq <= lastSeq {
+					continue
+				}
+				if err := stream.send(&ev); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// eventStream writes a Server-Sent Events response
+type eventStream struct {
+	*stream
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	es := &eventStream{newStream(w, header)}
+	return es, es.write(": connected\n\n")
+}
+
+func (s *eventStream) send(ev *livetypes.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return s.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data))
+}
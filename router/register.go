@@ -1,54 +1,103 @@
 package router
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"gitlab.com/vocdoni/vocexplorer/config"
+	"gitlab.com/vocdoni/vocexplorer/history"
+	"gitlab.com/vocdoni/vocexplorer/live"
+	"gitlab.com/vocdoni/vocexplorer/subscription"
 )
 
-// RegisterRoutes takes a mux and registers all the routes callbacks within this package
-func RegisterRoutes(m *mux.Router, cfg *config.Cfg) {
+// RegisterRoutes takes a mux and registers all the routes callbacks within this package.
+// cli backs the REST API routes, either the gateway client or the local indexer,
+// feed pushes the chain changes to the live event streams, and hist and subs serve the stats
+// history and the process subscriptions, if enabled. The routes of a network other than the
+// default one are registered on a subrouter under its prefix, and share the static files.
+// The work the routes start in the background is cancelled once ctx is done, on shutdown.
+func RegisterRoutes(ctx context.Context, m *mux.Router, cfg *config.Cfg, cli Source, feed *live.Feed, hist *history.Recorder, subs *subscription.Notifier) {
+	if cfg.Prefix != "" {
+		m.Use(networkMiddleware(cfg.Prefix))
+	}
 
-	// Page Routes
+	// Page Routes. The detail pages are rendered by the server for crawlers and clients without JS.
+	// Absolute links are built from the configured URL, rather than the request headers
+	// which clients control and caches may store the response for
+	host := strings.TrimSuffix(cfg.HostURL, "/")
+	pages := newPageRenders(cli, host)
 	m.HandleFunc("/", indexHandler)
 	m.HandleFunc("/processes", indexHandler)
-	m.HandleFunc("/process/{id}", indexHandler)
+	m.HandleFunc("/process/{id}", pages.handler(processPage))
 	m.HandleFunc("/entities", indexHandler)
-	m.HandleFunc("/entity/{id}", indexHandler)
+	m.HandleFunc("/entity/{id}", pages.handler(entityPage))
 	m.HandleFunc("/envelopes", indexHandler)
-	m.HandleFunc("/envelope/{id}", indexHandler)
+	m.HandleFunc("/envelope/{id}", pages.handler(envelopePage))
 	m.HandleFunc("/blocks", indexHandler)
-	m.HandleFunc("/block/{id}", indexHandler)
+	m.HandleFunc("/block/{id}", pages.handler(blockPage))
 	m.HandleFunc("/transactions", indexHandler)
-	m.HandleFunc("/transaction/{block}/{index}", indexHandler)
+	m.HandleFunc("/transaction/{block}/{index}", pages.handler(txPage))
 	m.HandleFunc("/stats", indexHandler)
 	m.HandleFunc("/validators", indexHandler)
-	m.HandleFunc("/validator/{id}", indexHandler)
+	m.HandleFunc("/validator/{id}", pages.handler(validatorPage))
 	m.HandleFunc("/search/{searchTerm}", indexHandler)
 
 	// API Routes
 	m.HandleFunc("/ping", pingHandler())
 	m.HandleFunc("/config", configHandler(cfg))
+	registerAPIRoutes(ctx, m, cli, hist)
+	registerLiveRoutes(m, feed)
+	registerFeedRoutes(m, cli, host)
+	if subs != nil {
+		registerSubscriptionRoutes(m, subs)
+	}
 
-	m.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	if cfg.Prefix == "" {
+		m.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	}
 	m.NotFoundHandler = http.Handler(http.NotFoundHandler())
 }
 
+// networkKey is the request context key of the route prefix of the network served
+type networkKey struct{}
+
+// networkMiddleware marks the requests as served for the network under prefix, so the
+// links of the feeds and rendered pages stay within it
+func networkMiddleware(prefix string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), networkKey{}, prefix)))
+		})
+	}
+}
+
+// networkPrefix returns the route prefix of the network the request is served for
+func networkPrefix(r *http.Request) string {
+	prefix, _ := r.Context().Value(networkKey{}).(string)
+	return prefix
+}
+
 func indexHandler(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "./static/index.html")
 }
 
 func configHandler(cfg *config.Cfg) func(w http.ResponseWriter, r *http.Request) {
+	public := *cfg
+	if cfg.Proxy {
+		// Pages reach the gateways through the proxy only
+		public.GatewayUrl, public.GatewayUrls = "", nil
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		if err := json.NewEncoder(w).Encode(cfg); err != nil {
+		if err := json.NewEncoder(w).Encode(&public); err != nil {
 			panic(err)
 		}
 	}
 }
 
-//PingHandler responds to a ping
+// PingHandler responds to a ping
 func pingHandler() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("pong"))
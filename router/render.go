@@ -0,0 +1,461 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/log"
+)
+
+const (
+	// indexFile is the page loading the WASM bundle, served for every page route
+	indexFile = "./static/index.html"
+	// renderTimeout bounds the gateway requests made to render a page, after which the
+	// bare index is served
+	renderTimeout = 3 * time.Second
+	// renderCacheSize is the number of rendered pages cached
+	renderCacheSize = 1000
+	// renderCacheTTL is the time a rendered page is cached for
+	renderCacheTTL = 30 * time.Second
+	// maxBackgroundRenders bounds the pages rendered at once for browsers, which don't
+	// wait for them
+	maxBackgroundRenders = 8
+	// entityPageProcesses is the number of processes linked from a rendered entity page
+	entityPageProcesses = 10
+	// siteName names the explorer in the rendered pages
+	siteName = "Vochain Block Explorer"
+)
+
+// crawlerAgents matches the user agents of search engines and link preview fetchers,
+// which don't run the WASM bundle
+var crawlerAgents = regexp.MustCompile(`(?i)bot|crawler|spider|slurp|facebookexternalhit|embedly|whatsapp|preview|vkshare|pinterest`)
+
+// titleTag matches the title of the index, replaced by the one of the rendered page
+var titleTag = regexp.MustCompile(`<title>.*</title>`)
+
+// page is a page rendered by the server for crawlers and clients without JS
+type page struct {
+	Title       string
+	Description string
+	URL         string
+	Fields      []pageField
+	// List links related pages, under ListTitle
+	ListTitle string
+	List      []pageField
+	// Home is the home page of the network
+	Home string
+}
+
+// pageField is a labeled value of a rendered page, linking to Link if set
+type pageField struct {
+	Name  string
+	Value string
+	Link  string
+}
+
+// pageRenderer returns the page at the request route, or nil if it doesn't exist
+type pageRenderer func(cli Source, r *http.Request) (*page, error)
+
+var pageTemplates = template.Must(template.New("page").Parse(`{{define "head"}}<title>{{.Title}} - ` + siteName + `</title>
+  <meta name="description" content="{{.Description}}">
+  <link rel="canonical" href="{{.URL}}">
+  <meta property="og:site_name" content="` + siteName + `">
+  <meta property="og:type" content="website">
+  <meta property="og:title" content="{{.Title}}">
+  <meta property="og:description" content="{{.Description}}">
+  <meta property="og:url" content="{{.URL}}">
+  <meta name="twitter:card" content="summary">{{end}}
+{{define "body"}}<main class="rendered-page">
+    <h1>{{.Title}}</h1>
+    <p>{{.Description}}</p>
+    <dl>{{range .Fields}}
+      <dt>{{.Name}}</dt>
+      <dd>{{if .Link}}<a href="{{.Link}}">{{.Value}}</a>{{else}}{{.Value}}{{end}}</dd>{{end}}
+    </dl>{{if .List}}
+    <h2>{{.ListTitle}}</h2>
+    <ul>{{range .List}}
+      <li><a href="{{.Link}}">{{.Value}}</a></li>{{end}}
+    </ul>{{end}}
+    <p><a href="{{.Home}}">` + siteName + `</a></p>
+  </main>{{end}}
+{{define "page"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  {{template "head" .}}
+  <link rel="stylesheet" href="/static/css/main.css">
+  <meta name="viewport" content="width=device-width,initial-scale=1">
+</head>
+<body>
+  {{template "body" .}}
+</body>
+</html>
+{{end}}`))
+
+// pageRenders renders the pages of a network and caches them, so browsers don't wait for
+// the gateway requests it takes
+type pageRenders struct {
+	cli Source
+	// host is the URL the explorer is served at, which the canonical page URLs start with
+	host  string
+	cache client.Cache
+
+	// lock guards inflight
+	lock sync.Mutex
+	// inflight holds the paths of the pages being rendered in the background
+	inflight map[string]bool
+	// slots bounds the pages rendered in the background at once
+	slots chan struct{}
+}
+
+func newPageRenders(cli Source, host string) *pageRenders {
+	return &pageRenders{
+		cli:      cli,
+		host:     host,
+		cache:    client.NewLRUCache(renderCacheSize),
+		inflight: make(map[string]bool),
+		slots:    make(chan struct{}, maxBackgroundRenders),
+	}
+}
+
+// handler serves a page route. Crawlers get the page rendered by the server, waiting for
+// it unless it's cached, and the bare index if it can't be rendered in time. Everyone else
+// gets the index at once, with the page meta tags and the rendered page for browsers
+// without JS if it's cached, and the page is rendered in the background otherwise.
+func (pr *pageRenders) handler(render pageRenderer) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		crawler := crawlerAgents.MatchString(r.UserAgent())
+		p, ok := pr.cached(r.URL.Path)
+		if !ok && !crawler {
+			pr.renderInBackground(r, render)
+			indexHandler(w, r)
+			return
+		}
+		if !ok {
+			var err error
+			if p, err = pr.render(r, render); err != nil {
+				log.Debugf("cannot render %s: %v", r.URL.Path, err)
+				indexHandler(w, r)
+				return
+			}
+		}
+		if p == nil && !crawler {
+			// The explorer shows its own not found message
+			indexHandler(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if p == nil {
+			w.WriteHeader(http.StatusNotFound)
+			p = &page{Title: "Not found", Description: "There is nothing at " + r.URL.Path + " on the Vochain."}
+		}
+		p.URL = pr.host + r.URL.Path
+		// Renderers link to the routes of the default network
+		prefix := networkPrefix(r)
+		p.Home = prefix + "/"
+		for i := range p.Fields {
+			if p.Fields[i].Link != "" {
+				p.Fields[i].Link = prefix + p.Fields[i].Link
+			}
+		}
+		for i := range p.List {
+			p.List[i].Link = prefix + p.List[i].Link
+		}
+
+		if crawler {
+			if err := pageTemplates.ExecuteTemplate(w, "page", p); err != nil {
+				log.Warnf("cannot render %s: %v", r.URL.Path, err)
+			}
+			return
+		}
+		index, err := ioutil.ReadFile(indexFile)
+		if err != nil {
+			log.Warnf("cannot read index: %v", err)
+			indexHandler(w, r)
+			return
+		}
+		var head, body bytes.Buffer
+		if err := pageTemplates.ExecuteTemplate(&head, "head", p); err != nil {
+			log.Warnf("cannot render %s: %v", r.URL.Path, err)
+			indexHandler(w, r)
+			return
+		}
+		if err := pageTemplates.ExecuteTemplate(&body, "body", p); err != nil {
+			log.Warnf("cannot render %s: %v", r.URL.Path, err)
+			indexHandler(w, r)
+			return
+		}
+		html := titleTag.ReplaceAllLiteralString(string(index), head.String())
+		html = strings.Replace(html, "<body>", "<body>\n  <noscript>"+body.String()+"</noscript>", 1)
+		w.Write([]byte(html))
+	}
+}
+
+// cached returns the rendered page at path, which is nil if the page doesn't exist, and
+// whether it's cached
+func (pr *pageRenders) cached(path string) (*page, bool) {
+	data, ok := pr.cache.Get(path)
+	if !ok {
+		return nil, false
+	}
+	var p *page
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, false
+	}
+	return p, true
+}
+
+// render runs render and caches the page, giving up after renderTimeout so a slow gateway
+// doesn't hold the request
+func (pr *pageRenders) render(r *http.Request, render pageRenderer) (*page, error) {
+	type result struct {
+		page *page
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		p, err := render(pr.cli, r)
+		if err == nil {
+			if data, err := json.Marshal(p); err == nil {
+				pr.cache.Set(r.URL.Path, data, renderCacheTTL)
+			}
+		}
+		done <- result{p, err}
+	}()
+	select {
+	case res := <-done:
+		return res.page, res.err
+	case <-time.After(renderTimeout):
+		return nil, fmt.Errorf("timed out")
+	}
+}
+
+// renderInBackground renders the page of r for the next requests, unless it's being
+// rendered already or too many pages are
+func (pr *pageRenders) renderInBackground(r *http.Request, render pageRenderer) {
+	path := r.URL.Path
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	if pr.inflight[path] {
+		return
+	}
+	select {
+	case pr.slots <- struct{}{}:
+	default:
+		return
+	}
+	pr.inflight[path] = true
+	go func() {
+		if _, err := pr.render(r, render); err != nil {
+			log.Debugf("cannot render %s: %v", path, err)
+		}
+		pr.lock.Lock()
+		delete(pr.inflight, path)
+		pr.lock.Unlock()
+		<-pr.slots
+	}()
+}
+
+// formatTime formats the time of a block for the rendered pages
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+func blockPage(cli Source, r *http.Request) (*page, error) {
+	height, err := uintVar(r, "id")
+	if err != nil {
+		return nil, nil
+	}
+	block, err := cli.GetBlock(height)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	p := &page{
+		Title: fmt.Sprintf("Block %d", block.Height),
+		Description: fmt.Sprintf("Block %d of the Vochain, committed on %s with %d transactions.",
+			block.Height, formatTime(block.Timestamp), block.NumTxs),
+		Fields: []pageField{
+			{Name: "Height", Value: strconv.Itoa(int(block.Height))},
+			{Name: "Hash", Value: block.Hash.String()},
+			{Name: "Time", Value: formatTime(block.Timestamp)},
+			{Name: "Transactions", Value: strconv.Itoa(int(block.NumTxs))},
+			{Name: "Proposer", Value: block.ProposerAddress.String(), Link: "/validator/" + block.ProposerAddress.String()},
+		},
+	}
+	if block.Height > 1 {
+		p.Fields = append(p.Fields, pageField{Name: "Previous block", Value: strconv.Itoa(int(block.Height - 1)),
+			Link: fmt.Sprintf("/block/%d", block.Height-1)})
+	}
+	return p, nil
+}
+
+func txPage(cli Source, r *http.Request) (*page, error) {
+	height, err := uintVar(r, "block")
+	if err != nil {
+		return nil, nil
+	}
+	index, err := indexVar(r, "index")
+	if err != nil {
+		return nil, nil
+	}
+	tx, err := cli.GetTx(height, index)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	// The transaction type is only listed along with the block transactions
+	txType := "Unknown"
+	if txs, err := cli.GetTxListForBlock(height, int(index), 1); err == nil && len(txs) == 1 {
+		txType = util.GetTransactionName(txs[0].Type)
+	}
+	return &page{
+		Title: fmt.Sprintf("Transaction %d/%d", height, index),
+		Description: fmt.Sprintf("%s transaction %d of block %d of the Vochain, with hash %s.",
+			txType, index, height, tx.Hash),
+		Fields: []pageField{
+			{Name: "Type", Value: txType},
+			{Name: "Block", Value: strconv.Itoa(int(height)), Link: fmt.Sprintf("/block/%d", height)},
+			{Name: "Index", Value: strconv.Itoa(int(index))},
+			{Name: "Hash", Value: tx.Hash.String()},
+			{Name: "ID", Value: strconv.Itoa(int(tx.ID))},
+		},
+	}, nil
+}
+
+// processDescription describes a process from its summary
+func processDescription(summary *client.ProcessSummary) string {
+	envelopes := uint32(0)
+	if summary.EnvelopeHeight != nil {
+		envelopes = *summary.EnvelopeHeight
+	}
+	return fmt.Sprintf("%s %s process of entity %s, from block %d to block %d. %d envelopes.",
+		util.GetProcessStatus(summary.State), util.DecodeEnvelopeType(summary.EnvelopeType),
+		util.TrimHex(summary.EntityID), summary.StartBlock, summary.StartBlock+summary.BlockCount, envelopes)
+}
+
+func processPage(cli Source, r *http.Request) (*page, error) {
+	pid, err := hexVar(r, "id")
+	if err != nil {
+		return nil, nil
+	}
+	summary, err := cli.GetProcessSummary(pid)
+	if err != nil || summary == nil {
+		return nil, err
+	}
+	envelopes := uint32(0)
+	if summary.EnvelopeHeight != nil {
+		envelopes = *summary.EnvelopeHeight
+	}
+	eid := util.TrimHex(summary.EntityID)
+	endBlock := summary.StartBlock + summary.BlockCount
+	return &page{
+		Title:       "Process " + util.HexToString(pid),
+		Description: processDescription(summary),
+		Fields: []pageField{
+			{Name: "Entity", Value: eid, Link: "/entity/" + eid},
+			{Name: "State", Value: util.GetProcessStatus(summary.State)},
+			{Name: "Type", Value: util.DecodeEnvelopeType(summary.EnvelopeType)},
+			{Name: "Start block", Value: strconv.Itoa(int(summary.StartBlock)), Link: fmt.Sprintf("/block/%d", summary.StartBlock)},
+			{Name: "End block", Value: strconv.Itoa(int(endBlock))},
+			{Name: "Envelopes", Value: strconv.Itoa(int(envelopes))},
+		},
+	}, nil
+}
+
+func entityPage(cli Source, r *http.Request) (*page, error) {
+	eid, err := hexVar(r, "id")
+	if err != nil {
+		return nil, nil
+	}
+	count, err := cli.GetProcessCount(eid)
+	if err != nil || count == 0 {
+		// Entities are only known on the chain by their processes
+		return nil, err
+	}
+	// Processes are listed oldest first, so list the last page
+	pids, err := cli.GetProcessList(eid, "", 0, "", false, "", util.Max(int(count)-entityPageProcesses, 0), entityPageProcesses)
+	if err != nil {
+		return nil, err
+	}
+	id := util.HexToString(eid)
+	p := &page{
+		Title:       "Entity " + id,
+		Description: fmt.Sprintf("Entity %s of the Vochain, with %d processes.", id, count),
+		Fields: []pageField{
+			{Name: "Processes", Value: strconv.Itoa(int(count))},
+			{Name: "Feed", Value: "Atom feed of the entity processes", Link: "/feeds/entity/" + id + ".atom"},
+		},
+		ListTitle: "Latest processes",
+	}
+	for i := len(pids) - 1; i >= 0; i-- {
+		pid := util.TrimHex(pids[i])
+		p.List = append(p.List, pageField{Value: pid, Link: "/process/" + pid})
+	}
+	return p, nil
+}
+
+func envelopePage(cli Source, r *http.Request) (*page, error) {
+	nullifier, err := hexVar(r, "id")
+	if err != nil {
+		return nil, nil
+	}
+	envelope, err := cli.GetEnvelope(nullifier)
+	if err != nil || envelope == nil {
+		return nil, err
+	}
+	meta := envelope.Meta
+	pid := meta.ProcessId.String()
+	return &page{
+		Title:       "Envelope " + util.HexToString(nullifier),
+		Description: fmt.Sprintf("Vote envelope of process %s, cast at block %d.", pid, meta.Height),
+		Fields: []pageField{
+			{Name: "Process", Value: pid, Link: "/process/" + pid},
+			{Name: "Nullifier", Value: util.HexToString(nullifier)},
+			{Name: "Block", Value: strconv.Itoa(int(meta.Height)), Link: fmt.Sprintf("/block/%d", meta.Height)},
+			{Name: "Transaction", Value: fmt.Sprintf("%d/%d", meta.Height, meta.TxIndex),
+				Link: fmt.Sprintf("/transaction/%d/%d", meta.Height, meta.TxIndex)},
+			{Name: "Weight", Value: envelope.Weight},
+		},
+	}, nil
+}
+
+func validatorPage(cli Source, r *http.Request) (*page, error) {
+	address, err := hexVar(r, "id")
+	if err != nil {
+		return nil, nil
+	}
+	validators, err := cli.GetValidatorList()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range validators {
+		if !bytes.Equal(v.Address, address) {
+			continue
+		}
+		name := v.Name
+		if name == "" {
+			name = util.HexToString(v.Address)
+		}
+		return &page{
+			Title:       "Validator " + name,
+			Description: fmt.Sprintf("Vochain validator %s, with a voting power of %d.", name, v.Power),
+			Fields: []pageField{
+				{Name: "Name", Value: v.Name},
+				{Name: "Address", Value: util.HexToString(v.Address)},
+				{Name: "Public key", Value: util.HexToString(v.PubKey)},
+				{Name: "Voting power", Value: strconv.FormatUint(v.Power, 10)},
+			},
+		}, nil
+	}
+	return nil, nil
+}
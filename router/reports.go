@@ -0,0 +1,152 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"go.vocdoni.io/dvote/log"
+)
+
+const (
+	// reportCacheSize is the number of reports kept by the report cache
+	reportCacheSize = 200
+	// reportTimeout bounds the time spent computing a report
+	reportTimeout = 10 * time.Minute
+	// reportWait is the time a request waits for a report being computed before it's
+	// answered with 202 Accepted, below the write timeout of the server
+	reportWait = 10 * time.Second
+	// reportRetryAfter is the time clients are asked to wait before asking again for a
+	// report still being computed
+	reportRetryAfter = 5 * time.Second
+	// maxBackgroundReports bounds the reports computed at once, since each one takes
+	// many gateway requests
+	maxBackgroundReports = 4
+)
+
+// reportFunc computes a report, returning the time it may be cached for
+type reportFunc func(ctx context.Context) (interface{}, time.Duration, error)
+
+// reports serves the reports which take many gateway requests to compute, such as the
+// tally of a process. A report is computed once for every request asking for it meanwhile,
+// in the background so a client leaving doesn't cancel it for the others, and cached.
+// The reports being computed are cancelled once ctx is done, on shutdown.
+// It's safe for concurrent use.
+type reports struct {
+	ctx   context.Context
+	cache client.Cache
+
+	// lock guards inflight
+	lock sync.Mutex
+	// inflight holds the reports being computed, by key
+	inflight map[string]*reportCall
+	// slots bounds the reports computed at once
+	slots chan struct{}
+}
+
+// reportCall is a report being computed, shared by every request for it meanwhile
+type reportCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func newReports(ctx context.Context) *reports {
+	return &reports{
+		ctx:      ctx,
+		cache:    client.NewLRUCache(reportCacheSize),
+		inflight: make(map[string]*reportCall),
+		slots:    make(chan struct{}, maxBackgroundReports),
+	}
+}
+
+// serve writes the report stored at key, computing it with compute unless it's cached.
+// If it isn't ready within reportWait, the request is answered with 202 Accepted and a
+// Retry-After header, and the report keeps being computed for the next request. If too
+// many reports are being computed, it's answered with 503 Service Unavailable instead.
+func (rs *reports) serve(w http.ResponseWriter, r *http.Request, key string, compute reportFunc) {
+	if data, ok := rs.wait(w, r, key, compute); ok {
+		writeReport(w, data)
+	}
+}
+
+// wait returns the JSON encoding of the report stored at key, as serve does, for handlers
+// answering with a part of it. If it returns false the request has been answered already.
+func (rs *reports) wait(w http.ResponseWriter, r *http.Request, key string, compute reportFunc) ([]byte, bool) {
+	if data, ok := rs.cache.Get(key); ok {
+		return data, true
+	}
+	c := rs.start(key, compute)
+	if c == nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(reportRetryAfter.Seconds())))
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("too many reports being computed"))
+		return nil, false
+	}
+	wait := time.NewTimer(reportWait)
+	defer wait.Stop()
+	select {
+	case <-c.done:
+		if c.err != nil {
+			writeError(w, upstreamStatus(c.err), c.err)
+			return nil, false
+		}
+		return c.data, true
+	case <-wait.C:
+		w.Header().Set("Retry-After", strconv.Itoa(int(reportRetryAfter.Seconds())))
+		w.WriteHeader(http.StatusAccepted)
+	case <-r.Context().Done():
+	}
+	return nil, false
+}
+
+// start returns the computation of the report stored at key, starting it unless it's
+// in progress already, or nil if too many reports are being computed
+func (rs *reports) start(key string, compute reportFunc) *reportCall {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if c, ok := rs.inflight[key]; ok {
+		return c
+	}
+	select {
+	case rs.slots <- struct{}{}:
+	default:
+		return nil
+	}
+	c := &reportCall{done: make(chan struct{})}
+	rs.inflight[key] = c
+	go func() {
+		defer func() { <-rs.slots }()
+		ctx, cancel := context.WithTimeout(rs.ctx, reportTimeout)
+		defer cancel()
+		report, ttl, err := compute(ctx)
+		if err == nil {
+			var data []byte
+			if data, err = json.Marshal(report); err == nil {
+				c.data = append(data, '\n')
+			}
+		}
+		c.err = err
+		if err != nil {
+			log.Debugf("cannot compute report %s: %v", key, err)
+		} else if ttl > 0 {
+			rs.cache.Set(key, c.data, ttl)
+		}
+		rs.lock.Lock()
+		delete(rs.inflight, key)
+		rs.lock.Unlock()
+		close(c.done)
+	}()
+	return c
+}
+
+// writeReport writes an encoded report, which is shared by the requests for it meanwhile
+// and mustn't be modified
+func writeReport(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
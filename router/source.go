@@ -0,0 +1,41 @@
+package router
+
+import (
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"gitlab.com/vocdoni/vocexplorer/indexer"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+// Source is the data source of the REST API, implemented by client.Client and indexer.Indexer
+type Source interface {
+	GetGatewayInfo() error
+	GetStats() (*client.VochainStats, error)
+	GetEnvelopeHeight(pid []byte) (uint32, error)
+	GetBlockStatus() (*[5]int32, *uint32, int32, error)
+	GetProcessList(entityId []byte, searchTerm string, namespace uint32, status string, withResults bool, srcNetId string, from, listSize int) ([]string, error)
+	GetProcess(pid []byte) (*indexertypes.Process, error)
+	GetProcessSummary(pid []byte) (*client.ProcessSummary, error)
+	GetProcessKeys(pid []byte) ([]client.Key, []client.Key, error)
+	GetProcessCount(entityId []byte) (int64, error)
+	GetResults(pid []byte) ([][]string, string, string, bool, error)
+	GetEntityList(searchTerm string, listSize, from int) ([]string, error)
+	GetEntityCount() (int64, error)
+	GetValidatorList() ([]*models.Validator, error)
+	GetEnvelope(nullifier []byte) (*indexertypes.EnvelopePackage, error)
+	GetEnvelopeList(pid []byte, from, listSize int, searchTerm string) ([]*indexertypes.EnvelopeMetadata, error)
+	GetBlock(height uint32) (*indexertypes.BlockMetadata, error)
+	GetBlockByHash(hash []byte) (*indexertypes.BlockMetadata, error)
+	GetBlockList(from, listSize int) ([]*indexertypes.BlockMetadata, error)
+	GetTx(blockHeight uint32, txIndex int32) (*indexertypes.TxPackage, error)
+	GetTxByID(id uint32) (*indexertypes.TxPackage, error)
+	GetTxListForBlock(blockHeight uint32, from, listSize int) ([]*indexertypes.TxMetadata, error)
+}
+
+// IndexSource is a Source which also answers the queries only a local index can
+type IndexSource interface {
+	Source
+	Status() indexer.Status
+	GetBlocksByProposer(address []byte, from, listSize int) ([]uint32, error)
+	GetEntityProcessIDs(entityID []byte) ([]string, error)
+}
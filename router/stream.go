@@ -0,0 +1,63 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.vocdoni.io/dvote/log"
+)
+
+// IsStream returns true if path is a route answered with a long-lived stream: the live event
+// streams and the exports, of any network. It's decided by the route rather than the request
+// headers, which clients could leave out to open any number of streams.
+func IsStream(path string) bool {
+	i := strings.Index(path, APIPrefix+"/")
+	if i < 0 {
+		return false
+	}
+	path = path[i:]
+	return strings.HasPrefix(path, LivePrefix+"/") ||
+		strings.HasPrefix(path, APIPrefix+"/processes/") && strings.HasSuffix(path, "/export")
+}
+
+// stream writes a long-lived response, flushed to the client as it's produced. The server
+// write timeout is lifted from its response, so it's only ended by its handler, once it's
+// done or its request context is cancelled by the client disconnecting.
+type stream struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+// newStream starts a 200 response with the given headers, along with the ones already set
+// on w by the middlewares
+func newStream(w http.ResponseWriter, header http.Header) *stream {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debugf("stream will end at the write timeout: %v", err)
+	}
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(http.StatusOK)
+	return &stream{w: w, rc: rc}
+}
+
+// Write writes p without flushing it
+func (s *stream) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// write writes msg and flushes it
+func (s *stream) write(msg string) error {
+	if _, err := io.WriteString(s.w, msg); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// flush sends what's written so far to the client
+func (s *stream) flush() error {
+	return s.rc.Flush()
+}
@@ -0,0 +1,138 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	const (
+		writeTimeout = 200 * time.Millisecond
+		messages     = 5
+	)
+	for _, tc := range []struct {
+		name  string
+		http2 bool
+	}{
+		{"http1", false},
+		{"http2", true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				s := newStream(w, http.Header{"Content-Type": {"text/event-stream"}})
+				for i := 0; i < messages; i++ {
+					if err := s.write(fmt.Sprintf("data: %d\n\n", i)); err != nil {
+						return
+					}
+					time.Sleep(writeTimeout / 2)
+				}
+			})
+			// Headers set by the middlewares, such as HSTS, are kept
+			stream := handler
+			handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+				stream.ServeHTTP(w, r)
+			})
+			srv := httptest.NewUnstartedServer(handler)
+			srv.EnableHTTP2 = tc.http2
+			srv.Config.WriteTimeout = writeTimeout
+			srv.StartTLS()
+			defer srv.Close()
+
+			resp, err := srv.Client().Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if tc.http2 && resp.ProtoMajor != 2 {
+				t.Fatalf("got %s, want HTTP/2", resp.Proto)
+			}
+			if resp.Header.Get("Strict-Transport-Security") == "" || resp.Header.Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("got headers %v, want the middleware and stream headers", resp.Header)
+			}
+			start := time.Now()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("stream cut after %s: %v", time.Since(start), err)
+			}
+			if want := fmt.Sprintf("data: %d\n\n", messages-1); !strings.Contains(string(body), want) {
+				t.Fatalf("stream cut after %s, got %q", time.Since(start), body)
+			}
+		})
+	}
+}
+
+func TestStreamEndsWithClient(t *testing.T) {
+	gone := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := newStream(w, http.Header{"Content-Type": {"text/event-stream"}})
+		for i := 0; ; i++ {
+			select {
+			case <-r.Context().Done():
+				close(gone)
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			s.write(fmt.Sprintf("data: %d\n\n", i))
+		}
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	select {
+	case <-gone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client disconnection not reported to the stream")
+	}
+}
+
+func TestShutdownWaitsForStreams(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := newStream(w, http.Header{"Content-Type": {"text/event-stream"}})
+		for i := 0; ; i++ {
+			select {
+			case <-release:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if err := s.write(fmt.Sprintf("data: %d\n\n", i)); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	released := time.Now().Add(50 * time.Millisecond)
+	time.AfterFunc(time.Until(released), func() { close(release) })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Config.Shutdown(ctx); err != nil || time.Now().Before(released) {
+		t.Fatalf("stream not waited for: %v", err)
+	}
+	if _, err := ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatalf("stream not ended cleanly: %v", err)
+	}
+}
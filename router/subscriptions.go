@@ -0,0 +1,95 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/vocdoni/vocexplorer/subscription"
+)
+
+// maxSubscriptionSize bounds the body of a subscription request
+const maxSubscriptionSize = 4 << 10
+
+// registerSubscriptionRoutes registers the routes managing the process lifecycle subscriptions
+func registerSubscriptionRoutes(m *mux.Router, subs *subscription.Notifier) {
+	api := m.PathPrefix(APIPrefix + "/subscriptions").Subrouter()
+	api.HandleFunc("", subscribeHandler(subs)).Methods(http.MethodPost)
+	api.HandleFunc("/{id}", subscriptionHandler(subs)).Methods(http.MethodGet)
+	api.HandleFunc("/{id}", unsubscribeHandler(subs)).Methods(http.MethodDelete)
+	// Linked from the notification emails and the webhook confirmations, so they're GET requests
+	api.HandleFunc("/{id}/confirm", confirmSubscriptionHandler(subs)).Methods(http.MethodGet)
+	api.HandleFunc("/{id}/unsubscribe", unsubscribeHandler(subs)).Methods(http.MethodGet)
+}
+
+// subscribeHandler registers the subscription in the request body. Its token is only sent
+// to the webhook or the email address, along with the link confirming it.
+func subscribeHandler(subs *subscription.Notifier) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub := new(subscription.Subscription)
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubscriptionSize)).Decode(sub); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid subscription: %v", err))
+			return
+		}
+		if err := sub.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := subs.Subscribe(sub); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case err == subscription.ErrEmailDisabled, errors.Is(err, subscription.ErrInvalidWebhook):
+				status = http.StatusBadRequest
+			case err == subscription.ErrTooManySubscriptions, err == subscription.ErrTooManyForTarget:
+				status = http.StatusTooManyRequests
+			}
+			writeError(w, status, err)
+			return
+		}
+		sub.Token = ""
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sub)
+	}
+}
+
+func subscriptionHandler(subs *subscription.Notifier) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub, err := subs.Store().Get(mux.Vars(r)["id"], r.URL.Query().Get("token"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, sub)
+	}
+}
+
+func confirmSubscriptionHandler(subs *subscription.Notifier) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := subs.Store().Confirm(mux.Vars(r)["id"], r.URL.Query().Get("token")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("Subscription confirmed, you'll be notified of the process changes.\n"))
+	}
+}
+
+func unsubscribeHandler(subs *subscription.Notifier) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := subs.Store().Remove(mux.Vars(r)["id"], r.URL.Query().Get("token")); err != nil {
+			status := http.StatusInternalServerError
+			if err == subscription.ErrNotFound {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write([]byte("Subscription removed, you won't be notified anymore.\n"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
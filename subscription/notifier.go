@@ -0,0 +1,547 @@
+package subscription
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/config"
+	"gitlab.com/vocdoni/vocexplorer/live"
+	"gitlab.com/vocdoni/vocexplorer/live/livetypes"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/log"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+const (
+	// queueSize is the number of deliveries which may be waiting to be sent
+	queueSize = 1024
+	// listSize is the list size used when fetching the processes of an entity
+	listSize = 100
+	// deliveryTimeout bounds a single webhook or email delivery
+	deliveryTimeout = 10 * time.Second
+)
+
+// ErrEmailDisabled is returned when subscribing an email while no SMTP server is configured
+var ErrEmailDisabled = errors.New("email notifications are disabled, subscribe a webhook")
+
+// EventConfirm is posted to a webhook once subscribed, with the link confirming the
+// subscription and its token
+const EventConfirm = "confirm"
+
+// retryDelays are the waits before retrying a failed delivery
+var retryDelays = []time.Duration{10 * time.Second, time.Minute, 10 * time.Minute}
+
+// Notification is the payload posted to webhooks for every event. Confirmation
+// notifications hold the token of the subscription, and the link confirming it as URL.
+type Notification struct {
+	SubscriptionID string    `json:"subscriptionId"`
+	Event          string    `json:"event"`
+	ProcessID      string    `json:"processId"`
+	EntityID       string    `json:"entityId"`
+	Status         string    `json:"status,omitempty"`
+	Height         uint32    `json:"height,omitempty"`
+	URL            string    `json:"url"`
+	Token          string    `json:"token,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// delivery is a notification waiting to be sent to a subscription
+type delivery struct {
+	// ID identifies the event delivered to the subscription, so it's queued only once
+	ID       string        `json:"id"`
+	Sub      Subscription  `json:"sub"`
+	Note     *Notification `json:"note"`
+	Attempts int           `json:"attempts"`
+	// Due is when the delivery is sent, later than queued once it failed
+	Due time.Time `json:"due"`
+}
+
+// Source is the gateway data the notifier checks the followed processes against on start
+type Source interface {
+	GetBlockStatus() (*[5]int32, *uint32, int32, error)
+	GetProcessList(entityId []byte, searchTerm string, namespace uint32, status string, withResults bool, srcNetId string, from, listSize int) ([]string, error)
+	GetProcess(pid []byte) (*indexertypes.Process, error)
+}
+
+// Notifier follows the process changes pushed by the live feed and delivers them to the
+// matching subscriptions. The deliveries and the process states notified are stored in an
+// outbox before being sent, so every event is delivered at least once across restarts.
+type Notifier struct {
+	store   *Store
+	feed    *live.Feed
+	src     Source
+	hostURL string
+	smtp    *config.SMTPCfg
+	http    *http.Client
+	outbox  *outbox
+	// wake is signaled when a delivery is queued
+	wake chan struct{}
+}
+
+// NewNotifier returns a notifier for the subscriptions in store, resuming the deliveries
+// stored along them. Links in the notifications point to the explorer at hostURL. Email
+// subscriptions are rejected if smtp is nil. Call Run to start it.
+func NewNotifier(store *Store, feed *live.Feed, src Source, hostURL string, smtp *config.SMTPCfg) (*Notifier, error) {
+	o, err := openOutbox(filepath.Dir(store.path))
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{
+		store:   store,
+		feed:    feed,
+		src:     src,
+		hostURL: strings.TrimSuffix(hostURL, "/"),
+		smtp:    smtp,
+		http:    newWebhookClient(),
+		outbox:  o,
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// Store returns the subscriptions store
+func (n *Notifier) Store() *Store {
+	return n.store
+}
+
+// Subscribe stores a new subscription and sends it the link confirming it, holding its
+// token: emails get it in a message, and webhooks in a confirmation notification. It's
+// only delivered once the link is opened. Webhooks must resolve to public addresses.
+func (n *Notifier) Subscribe(sub *Subscription) error {
+	if sub.Email != "" && n.smtp == nil {
+		return ErrEmailDisabled
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+	if sub.Webhook != "" {
+		if err := checkWebhook(ctx, sub.Webhook); err != nil {
+			return err
+		}
+	}
+	if err := n.store.Add(sub); err != nil {
+		return err
+	}
+	if sub.Webhook != "" {
+		if err := n.post(ctx, sub.Webhook, &Notification{
+			SubscriptionID: sub.ID,
+			Event:          EventConfirm,
+			ProcessID:      sub.ProcessID,
+			EntityID:       sub.EntityID,
+			URL:            n.Link(sub, "confirm"),
+			Token:          sub.Token,
+			Time:           time.Now().UTC().Truncate(time.Second),
+		}); err != nil {
+			n.store.Remove(sub.ID, sub.Token)
+			return fmt.Errorf("%w: cannot post the confirmation: %v", ErrInvalidWebhook, err)
+		}
+		return nil
+	}
+	if err := n.SendConfirmation(sub); err != nil {
+		n.store.Remove(sub.ID, sub.Token)
+		return fmt.Errorf("cannot send confirmation email: %v", err)
+	}
+	return nil
+}
+
+// Run delivers the process events until ctx is done. On start, and whenever the feed drops
+// it, the followed processes are checked against the gateway, notifying the changes missed.
+func (n *Notifier) Run(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		n.deliver(ctx)
+		close(done)
+	}()
+	for ctx.Err() == nil {
+		events, cancel := n.feed.Subscribe()
+		n.match(ctx, events)
+		cancel()
+	}
+	<-done
+	if err := n.outbox.close(); err != nil {
+		log.Warnf("subscriptions: %v", err)
+	}
+}
+
+// match notifies the process changes received, until ctx is done or the feed drops the
+// subscription. The followed processes are reconciled first, and again on every block
+// until it succeeds.
+func (n *Notifier) match(ctx context.Context, events <-chan livetypes.Event) {
+	reconciled := false
+	reconcile := func() {
+		if err := n.reconcile(ctx); err != nil {
+			log.Warnf("subscriptions: cannot check the followed processes: %v", err)
+			return
+		}
+		reconciled = true
+	}
+	reconcile()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			switch ev.Type {
+			case livetypes.EventBlock:
+				if ev.Block != nil {
+					n.outbox.follow(ev.Block.Timestamp)
+				}
+				if !reconciled {
+					reconcile()
+				}
+			case livetypes.EventProcess:
+				if ev.Process == nil {
+					continue
+				}
+				if err := n.update(ev.Process, ev.Height, ev.Change == livetypes.ProcessCreated); err != nil {
+					log.Warnf("subscriptions: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// reconcile checks every followed process against the gateway, notifying the changes
+// made since their states were last notified
+func (n *Notifier) reconcile(ctx context.Context) error {
+	_, h, _, err := n.src.GetBlockStatus()
+	if err != nil {
+		return err
+	}
+	if h == nil || *h == 0 {
+		return fmt.Errorf("gateway returned no block height")
+	}
+	// The block at the current height is not committed yet
+	height := *h - 1
+
+	pids, eids := n.store.Followed()
+	for _, eid := range eids {
+		id, err := util.DecodeHex(eid)
+		if err != nil {
+			continue
+		}
+		for from := 0; ; from += listSize {
+			list, err := n.src.GetProcessList(id, "", 0, "", false, "", from, listSize)
+			if err != nil {
+				return err
+			}
+			pids = append(pids, list...)
+			if len(list) < listSize {
+				break
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for _, pid := range pids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		id, err := util.DecodeHex(pid)
+		if err != nil || seen[util.HexToString(id)] {
+			continue
+		}
+		seen[util.HexToString(id)] = true
+		process, err := n.src.GetProcess(id)
+		if err != nil {
+			return fmt.Errorf("cannot get process %x: %v", id, err)
+		}
+		if process == nil {
+			continue
+		}
+		if len(process.ID) == 0 {
+			process.ID = id
+		}
+		if err := n.update(process, height, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update compares a followed process with the state last notified, and queues the events
+// it went through since for the matching subscriptions. A process not followed before is
+// notified as created if it's new to the feed, or created after the feed was last followed.
+func (n *Notifier) update(process *indexertypes.Process, height uint32, created bool) error {
+	pid, eid := process.ID.String(), process.EntityID.String()
+	if !n.store.Follows(pid, eid) {
+		return nil
+	}
+	final := models.ProcessStatus(process.Status) == models.ProcessStatus_CANCELED || process.FinalResults
+	cur := &processState{
+		Status:       process.Status,
+		Started:      height >= process.StartBlock,
+		KeysRevealed: len(process.PrivateKeys) > 0,
+		Results:      process.FinalResults,
+	}
+	prev, stored, followed := n.outbox.state(pid)
+	var events []string
+	if prev == nil {
+		if !created && (!stored || !process.CreationTime.After(followed)) {
+			// Followed since before its state was known, so only later changes are notified
+			if final {
+				return nil
+			}
+			return n.outbox.record(pid, cur, final, nil)
+		}
+		events = append(events, EventCreated)
+		prev = &processState{Status: process.Status}
+	}
+	events = append(events, transitions(prev, cur)...)
+	if len(events) == 0 && *prev == *cur {
+		return nil
+	}
+
+	var deliveries []*delivery
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, event := range events {
+		for _, sub := range n.store.Matching(event, pid, eid) {
+			deliveries = append(deliveries, &delivery{
+				ID:  sub.ID + "/" + pid + "/" + event,
+				Sub: sub,
+				Note: &Notification{
+					SubscriptionID: sub.ID,
+					Event:          event,
+					ProcessID:      pid,
+					EntityID:       eid,
+					Status:         models.ProcessStatus_name[process.Status],
+					Height:         height,
+					URL:            n.hostURL + "/process/" + pid,
+					Time:           now,
+				},
+				Due: now,
+			})
+		}
+	}
+	if err := n.outbox.record(pid, cur, final, deliveries); err != nil {
+		return err
+	}
+	if len(deliveries) > 0 {
+		select {
+		case n.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// transitions returns the lifecycle events a process went through from state prev to cur,
+// in lifecycle order
+func transitions(prev, cur *processState) []string {
+	var events []string
+	if cur.Started && !prev.Started {
+		events = append(events, EventStarted)
+	}
+	if cur.Status != prev.Status {
+		switch models.ProcessStatus(cur.Status) {
+		case models.ProcessStatus_PAUSED:
+			events = append(events, EventPaused)
+		case models.ProcessStatus_CANCELED:
+			events = append(events, EventCanceled)
+		case models.ProcessStatus_ENDED, models.ProcessStatus_RESULTS:
+			// A process may get its results before its end was seen
+			if models.ProcessStatus(prev.Status) != models.ProcessStatus_ENDED {
+				events = append(events, EventEnded)
+			}
+		}
+	}
+	if cur.KeysRevealed && !prev.KeysRevealed {
+		events = append(events, EventKeysRevealed)
+	}
+	if cur.Results && !prev.Results {
+		events = append(events, EventResults)
+	}
+	return events
+}
+
+// deliver sends the queued deliveries once due until ctx is done, retrying the failed
+// ones later. The deliveries left are sent on the next start.
+func (n *Notifier) deliver(ctx context.Context) {
+	for {
+		d, wait := n.outbox.next(time.Now())
+		if d != nil {
+			n.attempt(ctx, d)
+			continue
+		}
+		var timer *time.Timer
+		var due <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-n.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// attempt sends a delivery, scheduling a retry if it fails
+func (n *Notifier) attempt(ctx context.Context, d *delivery) {
+	err := n.send(ctx, d)
+	if err != nil && ctx.Err() != nil {
+		// Interrupted by the shutdown, so it's sent again on the next start
+		return
+	}
+	switch {
+	case err == nil:
+	case d.Attempts >= len(retryDelays):
+		log.Warnf("subscription %s: giving up %s event: %v", d.Sub.ID, d.Note.Event, err)
+	default:
+		log.Debugf("subscription %s: retrying %s event: %v", d.Sub.ID, d.Note.Event, err)
+		err = n.outbox.retry(d.ID, time.Now().Add(retryDelays[d.Attempts]))
+		if err != nil {
+			log.Warnf("subscriptions: %v", err)
+		}
+		return
+	}
+	if err := n.outbox.done(d.ID); err != nil {
+		log.Warnf("subscriptions: %v", err)
+	}
+}
+
+func (n *Notifier) send(ctx context.Context, d *delivery) error {
+	if d.Sub.Webhook != "" {
+		return n.post(ctx, d.Sub.Webhook, d.Note)
+	}
+	subject := fmt.Sprintf("Process %s %s", shortID(d.Note.ProcessID), d.Note.Event)
+	body := fmt.Sprintf("The process %s of the entity %s %s at block %d, and its status is now %s.\n\n%s\n",
+		d.Note.ProcessID, d.Note.EntityID, eventText[d.Note.Event], d.Note.Height, d.Note.Status, d.Note.URL)
+	return n.mail(d.Sub.Email, subject, body+n.unsubscribeText(&d.Sub))
+}
+
+// SendConfirmation emails the link confirming an email subscription, which holds its token
+func (n *Notifier) SendConfirmation(sub *Subscription) error {
+	target := "the process " + sub.ProcessID
+	if sub.EntityID != "" {
+		target = "every process of the entity " + sub.EntityID
+	}
+	body := fmt.Sprintf("Someone, hopefully you, subscribed this address to %s on the Vochain explorer.\n\n"+
+		"Open this link to start receiving the notifications:\n%s\n\nIf it wasn't you, just ignore this email.\n",
+		target, n.Link(sub, "confirm"))
+	return n.mail(sub.Email, "Confirm your Vochain process notifications", body)
+}
+
+func (n *Notifier) unsubscribeText(sub *Subscription) string {
+	return "\nTo stop these notifications, open this link:\n" + n.Link(sub, "unsubscribe") + "\n"
+}
+
+// Link returns the explorer link running action on sub, authorized by its token
+func (n *Notifier) Link(sub *Subscription, action string) string {
+	return fmt.Sprintf("%s/api/v1/subscriptions/%s/%s?token=%s", n.hostURL, sub.ID, action, sub.Token)
+}
+
+// eventText describes the events in notification emails
+var eventText = map[string]string{
+	EventCreated:      "was created",
+	EventStarted:      "started",
+	EventPaused:       "was paused",
+	EventCanceled:     "was canceled",
+	EventEnded:        "ended",
+	EventKeysRevealed: "had its encryption keys revealed",
+	EventResults:      "has final results",
+}
+
+func (n *Notifier) post(ctx context.Context, url string, note *Notification) error {
+	body, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *Notifier) mail(to, subject, body string) error {
+	if n.smtp == nil {
+		return fmt.Errorf("email notifications are disabled")
+	}
+	msg := strings.Join([]string{
+		"From: " + n.smtp.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+	addr := net.JoinHostPort(n.smtp.Host, strconv.Itoa(n.smtp.Port))
+	conn, err := net.DialTimeout("tcp", addr, deliveryTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// As smtp.SendMail, but bounded so a stuck server doesn't hold the deliveries
+	conn.SetDeadline(time.Now().Add(deliveryTimeout))
+	c, err := smtp.NewClient(conn, n.smtp.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.smtp.Host}); err != nil {
+			return err
+		}
+	}
+	if n.smtp.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.smtp.Username, n.smtp.Password, n.smtp.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.smtp.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// shortID abbreviates a hex id for email subjects
+func shortID(id string) string {
+	if len(id) <= 12 {
+		return id
+	}
+	return id[:6] + "…" + id[len(id)-6:]
+}
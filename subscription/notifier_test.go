@@ -0,0 +1,163 @@
+package subscription
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/mockgateway"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	"go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+func TestTransitions(t *testing.T) {
+	ready, paused, ended, results := int32(models.ProcessStatus_READY), int32(models.ProcessStatus_PAUSED),
+		int32(models.ProcessStatus_ENDED), int32(models.ProcessStatus_RESULTS)
+	for _, tc := range []struct {
+		name   string
+		prev   processState
+		cur    processState
+		events []string
+	}{
+		{"unchanged", processState{Status: ready, Started: true}, processState{Status: ready, Started: true}, nil},
+		{"started", processState{Status: ready}, processState{Status: ready, Started: true}, []string{EventStarted}},
+		{"paused", processState{Status: ready, Started: true}, processState{Status: paused, Started: true}, []string{EventPaused}},
+		{"resumed", processState{Status: paused, Started: true}, processState{Status: ready, Started: true}, nil},
+		{"ended", processState{Status: ready, Started: true}, processState{Status: ended, Started: true}, []string{EventEnded}},
+		{"results after the end", processState{Status: ended, Started: true},
+			processState{Status: results, Started: true, KeysRevealed: true, Results: true}, []string{EventKeysRevealed, EventResults}},
+		{"whole lifecycle missed", processState{Status: ready},
+			processState{Status: results, Started: true, KeysRevealed: true, Results: true},
+			[]string{EventStarted, EventEnded, EventKeysRevealed, EventResults}},
+	} {
+		prev, cur := tc.prev, tc.cur
+		if events := transitions(&prev, &cur); !reflect.DeepEqual(events, tc.events) {
+			t.Errorf("%s: got %v, want %v", tc.name, events, tc.events)
+		}
+	}
+}
+
+func TestOutboxPersists(t *testing.T) {
+	dir := tempDir(t)
+	o, err := openOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	state := &processState{Status: int32(models.ProcessStatus_READY)}
+	if err := o.record("a1", state, false, []*delivery{
+		{ID: "s1/a1/started", Note: &Notification{Event: EventStarted}, Due: now},
+		{ID: "s2/a1/started", Note: &Notification{Event: EventStarted}, Due: now.Add(time.Second)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := o.next(now); d == nil || d.ID != "s1/a1/started" {
+		t.Fatalf("got %+v, want the first delivery due", d)
+	}
+	if err := o.retry("s1/a1/started", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if d, wait := o.next(now); d != nil || wait <= 0 || wait > time.Second {
+		t.Fatalf("got %+v due in %s, want the second delivery due in 1s", d, wait)
+	}
+
+	// A restart finds the retry scheduled and the state notified
+	if o, err = openOutbox(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.done("s2/a1/started"); err != nil {
+		t.Fatal(err)
+	}
+	d, wait := o.next(now)
+	if d != nil || wait < 59*time.Minute {
+		t.Fatalf("got %+v due in %s, want the retry due in an hour", d, wait)
+	}
+	if d, _ := o.next(now.Add(time.Hour)); d == nil || d.Attempts != 1 {
+		t.Fatalf("got %+v, want the retry after one attempt", d)
+	}
+	if prev, stored, _ := o.state("a1"); !stored || prev == nil || *prev != *state {
+		t.Fatalf("got state %+v, stored %v", prev, stored)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	dir := tempDir(t)
+	st := openStore(t, dir)
+	sub := &Subscription{EntityID: "e1", Webhook: "https://example.org/hook"}
+	if err := st.Add(sub); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Confirm(sub.ID, sub.Token); err != nil {
+		t.Fatal(err)
+	}
+	genesis := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	process := func(id string, status models.ProcessStatus, created time.Time) *mockgateway.Process {
+		return &mockgateway.Process{Process: indexertypes.Process{
+			ID:           util.StringToHex(id),
+			EntityID:     util.StringToHex("e1"),
+			StartBlock:   10,
+			Status:       int32(status),
+			CreationTime: created,
+		}}
+	}
+	// chain serves the given processes, with the blocks below height committed
+	chain := func(height uint32, processes ...*mockgateway.Process) func(f *mockgateway.Fixtures) {
+		return func(f *mockgateway.Fixtures) {
+			f.Processes = processes
+			f.Blocks = nil
+			for f.Height() < height {
+				f.AddBlock()
+			}
+		}
+	}
+	gw, src := mockgateway.Start(t, nil)
+	gw.Update(chain(5, process("a1", models.ProcessStatus_READY, genesis)))
+	pending := func(n *Notifier) []string {
+		var ids []string
+		for id := range n.outbox.data.Pending {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// The first run only records the states of the processes followed
+	n, err := NewNotifier(st, nil, src, "https://explorer.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ids := pending(n); len(ids) != 0 {
+		t.Fatalf("first run queued %v", ids)
+	}
+	n.outbox.follow(genesis.Add(time.Minute))
+	if err := n.outbox.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// While stopped, a1 started and ended and a2 was created
+	gw.Update(chain(20, process("a1", models.ProcessStatus_ENDED, genesis),
+		process("a2", models.ProcessStatus_READY, genesis.Add(time.Hour))))
+	if n, err = NewNotifier(st, nil, src, "https://explorer.example.org", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{sub.ID + "/a1/ended", sub.ID + "/a1/started", sub.ID + "/a2/created", sub.ID + "/a2/started"}
+	if ids := pending(n); !reflect.DeepEqual(ids, want) {
+		t.Fatalf("got %v, want %v", ids, want)
+	}
+	// Nothing changed since, so checking again queues nothing more
+	if err := n.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ids := pending(n); len(ids) != len(want) {
+		t.Fatalf("got %v queued twice", ids)
+	}
+}
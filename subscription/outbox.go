@@ -0,0 +1,186 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.vocdoni.io/dvote/log"
+)
+
+// outboxName is the file under the data directory holding the deliveries not sent yet and
+// the states of the followed processes last notified, so the notifier resumes where it stopped
+const outboxName = "subscriptions.outbox.json"
+
+// processState is the state of a process as last notified to its subscriptions
+type processState struct {
+	Status       int32 `json:"status"`
+	Started      bool  `json:"started"`
+	KeysRevealed bool  `json:"keysRevealed"`
+	Results      bool  `json:"results"`
+}
+
+// outboxData is the content of the outbox file
+type outboxData struct {
+	// Pending are the deliveries not sent yet, by id
+	Pending map[string]*delivery `json:"pending"`
+	// Processes are the states last notified of the followed processes, by process id
+	Processes map[string]*processState `json:"processes"`
+	// Followed is the time up to which the live feed was followed, so the processes
+	// created after it are notified on start
+	Followed time.Time `json:"followed"`
+}
+
+// outbox holds the deliveries waiting to be sent and the process states notified, storing
+// every change before the deliveries are sent, so none is lost on shutdown or crash.
+// It's safe for concurrent use.
+type outbox struct {
+	path string
+
+	// lock guards data and the outbox file
+	lock sync.Mutex
+	data outboxData
+	// stored is false until the outbox has been written once, so a first run records the
+	// states of the followed processes without notifying their whole history
+	stored bool
+}
+
+// openOutbox opens the outbox stored under dataDir
+func openOutbox(dataDir string) (*outbox, error) {
+	o := &outbox{
+		path: filepath.Join(dataDir, outboxName),
+		data: outboxData{
+			Pending:   make(map[string]*delivery),
+			Processes: make(map[string]*processState),
+		},
+	}
+	data, err := ioutil.ReadFile(o.path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read subscriptions outbox: %v", err)
+	}
+	if err := json.Unmarshal(data, &o.data); err != nil {
+		return nil, fmt.Errorf("cannot decode subscriptions outbox: %v", err)
+	}
+	if o.data.Pending == nil {
+		o.data.Pending = make(map[string]*delivery)
+	}
+	if o.data.Processes == nil {
+		o.data.Processes = make(map[string]*processState)
+	}
+	o.stored = true
+	return o, nil
+}
+
+// state returns the state last notified of process pid, nil if it isn't followed yet,
+// whether the outbox was stored before and the time up to which the feed was followed
+func (o *outbox) state(pid string) (*processState, bool, time.Time) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	state, ok := o.data.Processes[pid]
+	if !ok {
+		return nil, o.stored, o.data.Followed
+	}
+	s := *state
+	return &s, o.stored, o.data.Followed
+}
+
+// record stores the state notified of process pid along with its deliveries. Final
+// processes are forgotten, since they won't change anymore.
+func (o *outbox) record(pid string, state *processState, final bool, deliveries []*delivery) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, d := range deliveries {
+		if len(o.data.Pending) >= queueSize {
+			log.Warnf("subscription %s: delivery queue full, dropping %s event", d.Sub.ID, d.Note.Event)
+			continue
+		}
+		o.data.Pending[d.ID] = d
+	}
+	if final {
+		delete(o.data.Processes, pid)
+	} else {
+		o.data.Processes[pid] = state
+	}
+	return o.save()
+}
+
+// follow records the feed was followed up to t, stored on the next change
+func (o *outbox) follow(t time.Time) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.data.Followed = t
+}
+
+// next returns the pending delivery due first if it's due at now, or else the time until
+// the next one is due, or a negative duration if there are none
+func (o *outbox) next(now time.Time) (*delivery, time.Duration) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var first *delivery
+	for _, d := range o.data.Pending {
+		if first == nil || d.Due.Before(first.Due) {
+			first = d
+		}
+	}
+	if first == nil {
+		return nil, -1
+	}
+	if wait := first.Due.Sub(now); wait > 0 {
+		return nil, wait
+	}
+	copied := *first
+	return &copied, 0
+}
+
+// done removes a delivery sent or given up
+func (o *outbox) done(id string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	delete(o.data.Pending, id)
+	return o.save()
+}
+
+// retry schedules a failed delivery again at due
+func (o *outbox) retry(id string, due time.Time) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	d, ok := o.data.Pending[id]
+	if !ok {
+		return nil
+	}
+	d.Attempts++
+	d.Due = due
+	return o.save()
+}
+
+// close stores the time up to which the feed was followed
+func (o *outbox) close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.save()
+}
+
+// save writes the outbox, replacing the stored one
+func (o *outbox) save() error {
+	data, err := json.Marshal(o.data)
+	if err != nil {
+		return err
+	}
+	// Write the new file aside and swap it, so a crash doesn't lose the outbox
+	tmp := o.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("cannot write subscriptions outbox: %v", err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return fmt.Errorf("cannot write subscriptions outbox: %v", err)
+	}
+	o.stored = true
+	return nil
+}
@@ -0,0 +1,435 @@
+// Package subscription lets users subscribe a webhook or an email address to the lifecycle
+// of a process, or of every process of an entity, and delivers the changes pushed by the
+// live feed to them.
+package subscription
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/vocdoni/vocexplorer/util"
+)
+
+const (
+	// fileName is the file under the data directory holding the subscriptions
+	fileName = "subscriptions.json"
+	// journalName is the file under the data directory where the changes made since the
+	// subscriptions file was written are appended, one JSON object per line
+	journalName = "subscriptions.journal"
+	// compactMin is the number of changes the journal holds at least before it's compacted
+	// into the subscriptions file, which happens once it holds more changes than subscriptions
+	compactMin = 100
+	// maxSubscriptions bounds the number of subscriptions stored
+	maxSubscriptions = 10000
+	// maxPerTarget bounds the number of subscriptions of a webhook host or an email address
+	maxPerTarget = 20
+	// confirmTimeout is the time after which the subscriptions not confirmed are dropped
+	confirmTimeout = 24 * time.Hour
+)
+
+// Process lifecycle events
+const (
+	EventCreated      = "created"
+	EventStarted      = "started"
+	EventPaused       = "paused"
+	EventCanceled     = "canceled"
+	EventEnded        = "ended"
+	EventKeysRevealed = "keysRevealed"
+	EventResults      = "results"
+)
+
+// Events lists every process lifecycle event, in lifecycle order
+var Events = []string{EventCreated, EventStarted, EventPaused, EventCanceled, EventEnded, EventKeysRevealed, EventResults}
+
+// Subscription delivers the lifecycle events of a process, or of every process of an
+// entity, to a webhook or an email address
+type Subscription struct {
+	ID string `json:"id"`
+	// Token authorizes managing the subscription. It's only returned when created.
+	Token string `json:"token,omitempty"`
+	// Exactly one of EntityID and ProcessID is set
+	EntityID  string `json:"entityId,omitempty"`
+	ProcessID string `json:"processId,omitempty"`
+	// Events are the events delivered, all of them if empty
+	Events []string `json:"events,omitempty"`
+	// Exactly one of Webhook and Email is set
+	Webhook string `json:"webhook,omitempty"`
+	Email   string `json:"email,omitempty"`
+	// Confirmed is false until the owner of the webhook or the email address confirms the
+	// subscription, so they can't be subscribed by anyone else
+	Confirmed bool      `json:"confirmed"`
+	Created   time.Time `json:"created"`
+}
+
+// Validate checks and normalizes a subscription request
+func (s *Subscription) Validate() error {
+	s.EntityID = strings.ToLower(util.TrimHex(s.EntityID))
+	s.ProcessID = strings.ToLower(util.TrimHex(s.ProcessID))
+	if (s.EntityID == "") == (s.ProcessID == "") {
+		return fmt.Errorf("either entityId or processId must be set")
+	}
+	for _, id := range []string{s.EntityID, s.ProcessID} {
+		if _, err := hex.DecodeString(id); err != nil {
+			return fmt.Errorf("invalid id %q", id)
+		}
+	}
+	for _, ev := range s.Events {
+		if !util.StringInSlice(ev, Events) {
+			return fmt.Errorf("unknown event %q, expected one of %s", ev, strings.Join(Events, ", "))
+		}
+	}
+	if (s.Webhook == "") == (s.Email == "") {
+		return fmt.Errorf("either webhook or email must be set")
+	}
+	if s.Webhook != "" {
+		u, err := url.Parse(s.Webhook)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Hostname() == "" {
+			return fmt.Errorf("webhook url is not http nor https")
+		}
+	}
+	if s.Email != "" {
+		addr, err := mail.ParseAddress(s.Email)
+		if err != nil {
+			return fmt.Errorf("invalid email: %v", err)
+		}
+		s.Email = addr.Address
+	}
+	return nil
+}
+
+// Matches returns true if the subscription wants event for process pid of entity eid
+func (s *Subscription) Matches(event, pid, eid string) bool {
+	if !s.Confirmed {
+		return false
+	}
+	if s.ProcessID != "" && s.ProcessID != pid || s.EntityID != "" && s.EntityID != eid {
+		return false
+	}
+	return len(s.Events) == 0 || util.StringInSlice(event, s.Events)
+}
+
+// target returns where the subscription is delivered: the webhook host or the email address
+func (s *Subscription) target() string {
+	if s.Email != "" {
+		return strings.ToLower(s.Email)
+	}
+	if u, err := url.Parse(s.Webhook); err == nil {
+		return strings.ToLower(u.Hostname())
+	}
+	return s.Webhook
+}
+
+// Store keeps the subscriptions in a file under the data directory, along with a journal
+// of the changes made since it was written. It's safe for concurrent use.
+type Store struct {
+	path        string
+	journalPath string
+
+	// lock guards every field below and the subscriptions files
+	lock sync.RWMutex
+	subs map[string]*Subscription
+	// journaled is the number of changes in the journal
+	journaled int
+}
+
+// change is an entry of the journal: a subscription added or updated, or the id of a
+// subscription removed
+type change struct {
+	Sub     *Subscription `json:"sub,omitempty"`
+	Removed string        `json:"removed,omitempty"`
+}
+
+// NewStore opens the subscriptions stored under dataDir
+func NewStore(dataDir string) (*Store, error) {
+	st := &Store{
+		path:        filepath.Join(dataDir, fileName),
+		journalPath: filepath.Join(dataDir, journalName),
+		subs:        make(map[string]*Subscription),
+	}
+	data, err := ioutil.ReadFile(st.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot read subscriptions: %v", err)
+	}
+	if err == nil {
+		var subs []*Subscription
+		if err := json.Unmarshal(data, &subs); err != nil {
+			return nil, fmt.Errorf("cannot decode subscriptions: %v", err)
+		}
+		for _, s := range subs {
+			st.subs[s.ID] = s
+		}
+	}
+	if err := st.replay(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// replay applies the changes in the journal
+func (st *Store) replay() error {
+	f, err := os.Open(st.journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read subscriptions journal: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var c change
+		// Skip a line cut short by a crash
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			continue
+		}
+		switch {
+		case c.Sub != nil:
+			st.subs[c.Sub.ID] = c.Sub
+		case c.Removed != "":
+			delete(st.subs, c.Removed)
+		}
+		st.journaled++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read subscriptions journal: %v", err)
+	}
+	return nil
+}
+
+// Errors returned when the subscriptions are bounded
+var (
+	ErrTooManySubscriptions = errors.New("too many subscriptions, try again later")
+	ErrTooManyForTarget     = errors.New("too many subscriptions for this webhook host or email address")
+)
+
+// Add validates and stores a new subscription, setting its id and token. It's only delivered
+// once confirmed, and dropped unless confirmed within a day.
+func (st *Store) Add(s *Subscription) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	s.ID, s.Token = randomHex(16), randomHex(32)
+	s.Confirmed = false
+	s.Created = time.Now().UTC().Truncate(time.Second)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if err := st.dropUnconfirmed(s.Created); err != nil {
+		return err
+	}
+	if len(st.subs) >= maxSubscriptions {
+		return ErrTooManySubscriptions
+	}
+	target, count := s.target(), 0
+	for _, other := range st.subs {
+		if other.target() == target {
+			count++
+		}
+	}
+	if count >= maxPerTarget {
+		return ErrTooManyForTarget
+	}
+	st.subs[s.ID] = s
+	if err := st.record(change{Sub: s}); err != nil {
+		delete(st.subs, s.ID)
+		return err
+	}
+	return nil
+}
+
+// dropUnconfirmed removes the subscriptions created confirmTimeout before now and not confirmed
+func (st *Store) dropUnconfirmed(now time.Time) error {
+	for id, s := range st.subs {
+		if !s.Confirmed && now.Sub(s.Created) > confirmTimeout {
+			delete(st.subs, id)
+			if err := st.record(change{Removed: id}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns the subscription with the given id, if token authorizes it
+func (st *Store) Get(id, token string) (*Subscription, error) {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	s, err := st.authorize(id, token)
+	if err != nil {
+		return nil, err
+	}
+	sub := *s
+	sub.Token = ""
+	return &sub, nil
+}
+
+// Confirm confirms the subscription with the given id, if token authorizes it
+func (st *Store) Confirm(id, token string) (*Subscription, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	s, err := st.authorize(id, token)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Confirmed {
+		s.Confirmed = true
+		if err := st.record(change{Sub: s}); err != nil {
+			return nil, err
+		}
+	}
+	sub := *s
+	sub.Token = ""
+	return &sub, nil
+}
+
+// Remove deletes the subscription with the given id, if token authorizes it
+func (st *Store) Remove(id, token string) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if _, err := st.authorize(id, token); err != nil {
+		return err
+	}
+	delete(st.subs, id)
+	return st.record(change{Removed: id})
+}
+
+// Matching returns the subscriptions wanting event for process pid of entity eid
+func (st *Store) Matching(event, pid, eid string) []Subscription {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	var subs []Subscription
+	for _, s := range st.subs {
+		if s.Matches(event, pid, eid) {
+			subs = append(subs, *s)
+		}
+	}
+	return subs
+}
+
+// Follows returns true if a confirmed subscription follows process pid of entity eid,
+// whichever events it wants
+func (st *Store) Follows(pid, eid string) bool {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	for _, s := range st.subs {
+		if s.Confirmed && (s.ProcessID != "" && s.ProcessID == pid || s.EntityID != "" && s.EntityID == eid) {
+			return true
+		}
+	}
+	return false
+}
+
+// Followed returns the processes and the entities followed by confirmed subscriptions
+func (st *Store) Followed() (pids, eids []string) {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	seen := make(map[string]bool)
+	for _, s := range st.subs {
+		switch {
+		case !s.Confirmed:
+		case s.ProcessID != "" && !seen[s.ProcessID]:
+			pids = append(pids, s.ProcessID)
+			seen[s.ProcessID] = true
+		case s.EntityID != "" && !seen[s.EntityID]:
+			eids = append(eids, s.EntityID)
+			seen[s.EntityID] = true
+		}
+	}
+	return pids, eids
+}
+
+// ErrNotFound is returned for unknown subscriptions, or when the token doesn't match
+var ErrNotFound = fmt.Errorf("subscription not found")
+
+func (st *Store) authorize(id, token string) (*Subscription, error) {
+	s, ok := st.subs[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(s.Token), []byte(token)) != 1 {
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+// record appends c to the journal, or compacts the journal into the subscriptions file once
+// it holds more changes than there are subscriptions
+func (st *Store) record(c change) error {
+	if st.journaled+1 > len(st.subs)+compactMin {
+		return st.compact()
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(st.journalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write subscriptions journal: %v", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write subscriptions journal: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot write subscriptions journal: %v", err)
+	}
+	st.journaled++
+	return nil
+}
+
+// compact writes every subscription to the subscriptions file and empties the journal.
+// Replaying the journal again over the new file is harmless, so a crash in between
+// doesn't lose anything.
+func (st *Store) compact() error {
+	if err := st.save(); err != nil {
+		return err
+	}
+	if err := os.Remove(st.journalPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove subscriptions journal: %v", err)
+	}
+	st.journaled = 0
+	return nil
+}
+
+// save writes every subscription, oldest first, replacing the stored ones
+func (st *Store) save() error {
+	subs := make([]*Subscription, 0, len(st.subs))
+	for _, s := range st.subs {
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Created.Before(subs[j].Created)
+	})
+	data, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write the new file aside and swap it, so a crash doesn't lose the subscriptions
+	tmp := st.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("cannot write subscriptions: %v", err)
+	}
+	if err := os.Rename(tmp, st.path); err != nil {
+		return fmt.Errorf("cannot write subscriptions: %v", err)
+	}
+	return nil
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,190 @@
+package subscription
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "vocexplorer-subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func openStore(t *testing.T, dir string) *Store {
+	st, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sub  Subscription
+		err  bool
+	}{
+		{"process webhook", Subscription{ProcessID: "0xA1", Webhook: "https://example.org/hook"}, false},
+		{"entity email", Subscription{EntityID: "b1", Email: "Voter <voter@example.org>", Events: []string{EventEnded}}, false},
+		{"no id", Subscription{Webhook: "https://example.org/hook"}, true},
+		{"both ids", Subscription{ProcessID: "a1", EntityID: "b1", Webhook: "https://example.org/hook"}, true},
+		{"bad id", Subscription{ProcessID: "zz", Webhook: "https://example.org/hook"}, true},
+		{"unknown event", Subscription{ProcessID: "a1", Webhook: "https://example.org/hook", Events: []string{"voted"}}, true},
+		{"no target", Subscription{ProcessID: "a1"}, true},
+		{"both targets", Subscription{ProcessID: "a1", Webhook: "https://example.org/hook", Email: "voter@example.org"}, true},
+		{"not http", Subscription{ProcessID: "a1", Webhook: "ftp://example.org/hook"}, true},
+		{"bad email", Subscription{ProcessID: "a1", Email: "voter"}, true},
+	} {
+		sub := tc.sub
+		if err := sub.Validate(); (err != nil) != tc.err {
+			t.Errorf("%s: got error %v, want error %v", tc.name, err, tc.err)
+		}
+	}
+	sub := Subscription{ProcessID: "0xA1", Email: "Voter <voter@example.org>"}
+	if err := sub.Validate(); err != nil || sub.ProcessID != "a1" || sub.Email != "voter@example.org" {
+		t.Errorf("not normalized: %+v, %v", sub, err)
+	}
+}
+
+func TestStoreJournal(t *testing.T) {
+	dir := tempDir(t)
+	st := openStore(t, dir)
+	kept := &Subscription{ProcessID: "a1", Webhook: "https://example.org/hook"}
+	removed := &Subscription{EntityID: "b1", Webhook: "https://example.org/hook"}
+	unconfirmed := &Subscription{ProcessID: "a2", Email: "voter@example.org"}
+	for _, s := range []*Subscription{kept, removed, unconfirmed} {
+		if err := st.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.Confirm(kept.ID, kept.Token); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Remove(removed.ID, removed.Token); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Remove(kept.ID, "wrong token"); err != ErrNotFound {
+		t.Fatalf("removed with a wrong token: %v", err)
+	}
+	// Leave a change cut short by a crash at the end of the journal
+	f, err := os.OpenFile(filepath.Join(dir, journalName), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"sub":{"id":"cut`)
+	f.Close()
+	if _, err := os.Stat(filepath.Join(dir, fileName)); !os.IsNotExist(err) {
+		t.Fatalf("subscriptions file written before compacting: %v", err)
+	}
+
+	st = openStore(t, dir)
+	for _, tc := range []struct {
+		sub       *Subscription
+		found     bool
+		confirmed bool
+	}{
+		{kept, true, true},
+		{removed, false, false},
+		{unconfirmed, true, false},
+	} {
+		s, err := st.Get(tc.sub.ID, tc.sub.Token)
+		if (err == nil) != tc.found {
+			t.Errorf("%s: got error %v, want found %v", tc.sub.ID, err, tc.found)
+			continue
+		}
+		if err == nil && (s.Confirmed != tc.confirmed || s.Token != "") {
+			t.Errorf("%s: got confirmed %v and token %q, want confirmed %v", s.ID, s.Confirmed, s.Token, tc.confirmed)
+		}
+	}
+	if subs := st.Matching(EventEnded, "a1", ""); len(subs) != 1 || subs[0].ID != kept.ID {
+		t.Errorf("got matching %+v, want %s", subs, kept.ID)
+	}
+	if subs := st.Matching(EventEnded, "a2", ""); len(subs) != 0 {
+		t.Errorf("unconfirmed subscription matched: %+v", subs)
+	}
+}
+
+func TestStoreCompaction(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// adds subscriptions are added and kept, and churn more are added and removed
+		adds    int
+		churn   int
+		compact bool
+	}{
+		{"few changes", 5, 10, false},
+		{"compacted", 5, compactMin, true},
+		{"many subscriptions", 60, compactMin / 4, false},
+	} {
+		dir := tempDir(t)
+		st := openStore(t, dir)
+		var kept []*Subscription
+		for i := 0; i < tc.adds; i++ {
+			s := &Subscription{ProcessID: "a1", Email: fmt.Sprintf("voter%d@example.org", i)}
+			if err := st.Add(s); err != nil {
+				t.Fatal(err)
+			}
+			kept = append(kept, s)
+		}
+		for i := 0; i < tc.churn; i++ {
+			s := &Subscription{ProcessID: "a1", Email: fmt.Sprintf("gone%d@example.org", i)}
+			if err := st.Add(s); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Remove(s.ID, s.Token); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := os.Stat(filepath.Join(dir, fileName))
+		if compacted := err == nil; compacted != tc.compact {
+			t.Errorf("%s: got compacted %v, want %v", tc.name, compacted, tc.compact)
+		}
+		if st.journaled > len(st.subs)+compactMin {
+			t.Errorf("%s: %d changes journaled for %d subscriptions", tc.name, st.journaled, len(st.subs))
+		}
+
+		st = openStore(t, dir)
+		if len(st.subs) != tc.adds {
+			t.Errorf("%s: got %d subscriptions after reopening, want %d", tc.name, len(st.subs), tc.adds)
+		}
+		for _, s := range kept {
+			if _, err := st.Get(s.ID, s.Token); err != nil {
+				t.Errorf("%s: %s lost: %v", tc.name, s.ID, err)
+			}
+		}
+	}
+}
+
+func TestStoreLimits(t *testing.T) {
+	st := openStore(t, tempDir(t))
+	for i := 0; i < maxPerTarget; i++ {
+		if err := st.Add(&Subscription{ProcessID: "a1", Webhook: fmt.Sprintf("https://example.org/hook/%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Add(&Subscription{ProcessID: "a1", Webhook: "https://EXAMPLE.org/other"}); err != ErrTooManyForTarget {
+		t.Errorf("got %v adding beyond the target limit, want %v", err, ErrTooManyForTarget)
+	}
+	if err := st.Add(&Subscription{ProcessID: "a1", Webhook: "https://example.com/hook"}); err != nil {
+		t.Errorf("another target rejected: %v", err)
+	}
+
+	// Unconfirmed subscriptions older than confirmTimeout are dropped on the next add
+	for _, s := range st.subs {
+		s.Created = s.Created.Add(-confirmTimeout - time.Minute)
+	}
+	if err := st.Add(&Subscription{ProcessID: "a1", Webhook: "https://example.org/hook"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.subs) != 1 {
+		t.Errorf("got %d subscriptions, want the unconfirmed ones dropped", len(st.subs))
+	}
+}
@@ -0,0 +1,112 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrInvalidWebhook is returned, wrapped, when subscribing a webhook the server won't post to
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// nonPublicNets are the address ranges webhooks can't be posted to, along with the
+// loopback, link-local, multicast and unspecified addresses, so subscriptions can't make
+// the server reach its own network or the metadata service of its cloud provider
+var nonPublicNets = parseCIDRs(
+	"0.0.0.0/8",     // this network
+	"10.0.0.0/8",    // private
+	"100.64.0.0/10", // carrier-grade NAT
+	"172.16.0.0/12", // private
+	"192.0.0.0/24",  // IETF protocol assignments
+	"192.168.0.0/16",
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved, and broadcast
+	"fc00::/7",      // unique local
+	"64:ff9b::/96",  // NAT64, which may map to any of the above
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = ipNet
+	}
+	return nets
+}
+
+// publicIP returns true if ip is a public unicast address
+func publicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, ipNet := range nonPublicNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhook returns an error unless every address the host of webhook resolves to is public
+func checkWebhook(ctx context.Context, webhook string) error {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return fmt.Errorf("%w: %s is not a public address", ErrInvalidWebhook, host)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s: %v", ErrInvalidWebhook, host, err)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s, which is not a public address", ErrInvalidWebhook, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// newWebhookClient returns the client posting to webhooks. Addresses are checked again when
+// connecting, so a webhook host resolving to another address since it was subscribed, or
+// redirecting elsewhere, can't reach a non-public address either.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicIP(net.ParseIP(host)) {
+				return fmt.Errorf("%w: %s is not a public address", ErrInvalidWebhook, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			// No proxy from the environment, it would connect to the webhooks instead
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: deliveryTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
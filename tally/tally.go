@@ -0,0 +1,267 @@
+package tally
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"gitlab.com/vocdoni/vocexplorer/export"
+	"gitlab.com/vocdoni/vocexplorer/util"
+	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+// Verification outcomes
+const (
+	// StatusMatch means the recomputed results equal the ones reported by the gateway
+	StatusMatch = "match"
+	// StatusMismatch means at least one recomputed option differs from the reported results
+	StatusMismatch = "mismatch"
+	// StatusIncomplete means some envelopes couldn't be decoded, so the results can't be
+	// recomputed. The partial tally is still compared.
+	StatusIncomplete = "incomplete"
+)
+
+// maxOptions bounds the options of all the questions of a process, MaxCount x (MaxValue+1),
+// since the tally holds a counter for each of them and the vote options come from the chain
+const maxOptions = 1 << 16
+
+// Source is the subset of the gateway client needed to verify the results of a process
+type Source interface {
+	export.EnvelopeSource
+	GetProcess(pid []byte) (*indexertypes.Process, error)
+	GetResults(pid []byte) ([][]string, string, string, bool, error)
+}
+
+// Report is the outcome of verifying the results of a process
+type Report struct {
+	ProcessID string `json:"processId"`
+	Status    string `json:"status"`
+	// State, Type and Final describe the results reported by the gateway
+	State string `json:"state"`
+	Type  string `json:"type"`
+	Final bool   `json:"final"`
+	// Envelopes is the number of envelopes found, of which Counted were added to the
+	// tally, Invalid broke the process vote rules and Undecoded couldn't be decoded
+	Envelopes int `json:"envelopes"`
+	Counted   int `json:"counted"`
+	Invalid   int `json:"invalid"`
+	Undecoded int `json:"undecoded"`
+	// Reported are the results given by the gateway, Computed the ones recomputed from
+	// the envelopes
+	Reported   [][]string `json:"reported"`
+	Computed   [][]string `json:"computed"`
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+	// Errors holds the reason of each invalid or undecoded envelope
+	Errors []EnvelopeError `json:"errors,omitempty"`
+}
+
+// Mismatch is an option whose recomputed votes differ from the reported ones.
+// Questions and options are numbered from 1.
+type Mismatch struct {
+	Question int    `json:"question"`
+	Option   int    `json:"option"`
+	Reported string `json:"reported"`
+	Computed string `json:"computed"`
+}
+
+// EnvelopeError tells why an envelope wasn't counted
+type EnvelopeError struct {
+	Nullifier string `json:"nullifier"`
+	Error     string `json:"error"`
+}
+
+// Verify fetches every envelope of the ended process pid, decrypting them with the revealed
+// keys, tallies them following the process envelope type and vote options, and compares
+// the tally against the results reported by the gateway.
+func Verify(ctx context.Context, src Source, pid []byte) (*Report, error) {
+	process, err := src.GetProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get process: %w", err)
+	}
+	switch models.ProcessStatus(process.Status) {
+	case models.ProcessStatus_ENDED, models.ProcessStatus_RESULTS:
+	default:
+		return nil, fmt.Errorf("process is %s, only ended processes can be verified",
+			models.ProcessStatus(process.Status))
+	}
+	if process.VoteOpts == nil {
+		return nil, fmt.Errorf("process has no vote options")
+	}
+	if options := uint64(process.VoteOpts.MaxCount) * (uint64(process.VoteOpts.MaxValue) + 1); options > maxOptions {
+		return nil, fmt.Errorf("process has %d questions with %d options each, more than the %d options supported",
+			process.VoteOpts.MaxCount, uint64(process.VoteOpts.MaxValue)+1, maxOptions)
+	}
+	envelopeType := process.Envelope
+	if envelopeType == nil {
+		envelopeType = &models.EnvelopeType{}
+	}
+	if envelopeType.Serial {
+		return nil, fmt.Errorf("serial processes are not supported")
+	}
+
+	reported, state, tp, final, err := src.GetResults(pid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get results: %w", err)
+	}
+	report := &Report{
+		ProcessID: util.HexToString(pid),
+		State:     state,
+		Type:      tp,
+		Final:     final,
+		Reported:  reported,
+	}
+	t := newTally(process.VoteOpts, envelopeType)
+	err = export.Envelopes(ctx, src, pid, func(e *export.Envelope) error {
+		report.Envelopes++
+		if e.VotePackage == nil {
+			report.Undecoded++
+			report.Errors = append(report.Errors, EnvelopeError{Nullifier: e.Nullifier, Error: e.DecodeError})
+			return nil
+		}
+		if err := t.add(e.VotePackage.Votes, e.Weight); err != nil {
+			report.Invalid++
+			report.Errors = append(report.Errors, EnvelopeError{Nullifier: e.Nullifier, Error: err.Error()})
+			return nil
+		}
+		report.Counted++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Computed = t.results()
+	report.Mismatches = compare(report.Reported, report.Computed)
+	switch {
+	case report.Undecoded > 0:
+		report.Status = StatusIncomplete
+	case len(report.Mismatches) > 0:
+		report.Status = StatusMismatch
+	default:
+		report.Status = StatusMatch
+	}
+	return report, nil
+}
+
+// tally adds up votes the way the vochain scrutinizer does: a MaxCount x (MaxValue+1)
+// matrix where each vote adds its weight to the chosen option of every question
+type tally struct {
+	opts         *models.ProcessVoteOptions
+	envelopeType *models.EnvelopeType
+	votes        [][]*big.Int
+}
+
+func newTally(opts *models.ProcessVoteOptions, envelopeType *models.EnvelopeType) *tally {
+	t := &tally{opts: opts, envelopeType: envelopeType}
+	t.votes = make([][]*big.Int, opts.MaxCount)
+	for q := range t.votes {
+		t.votes[q] = make([]*big.Int, opts.MaxValue+1)
+		for o := range t.votes[q] {
+			t.votes[q][o] = new(big.Int)
+		}
+	}
+	return t
+}
+
+// add counts a vote, or returns why it's not valid for the process
+func (t *tally) add(values []int, weight string) error {
+	w := big.NewInt(1)
+	if weight != "" {
+		if _, ok := w.SetString(weight, 10); !ok {
+			return fmt.Errorf("invalid weight %q", weight)
+		}
+	}
+	if len(values) > int(t.opts.MaxCount) {
+		return fmt.Errorf("%d values exceed the max count of %d", len(values), t.opts.MaxCount)
+	}
+	seen := make(map[int]bool, len(values))
+	for _, v := range values {
+		if v < 0 || v > int(t.opts.MaxValue) {
+			return fmt.Errorf("value %d out of range, max value is %d", v, t.opts.MaxValue)
+		}
+		if t.envelopeType.UniqueValues && seen[v] {
+			return fmt.Errorf("value %d repeated, values must be unique", v)
+		}
+		seen[v] = true
+	}
+	if err := t.checkCost(values, w); err != nil {
+		return err
+	}
+	for q, v := range values {
+		t.votes[q][v].Add(t.votes[q][v], w)
+	}
+	return nil
+}
+
+// checkCost checks the sum of each value raised to the cost exponent doesn't exceed the
+// max total cost, which is the voter weight when the cost comes from the weight
+func (t *tally) checkCost(values []int, weight *big.Int) error {
+	maxCost := new(big.Int).SetUint64(uint64(t.opts.MaxTotalCost))
+	if t.envelopeType.CostFromWeight {
+		maxCost.Set(weight)
+	}
+	if maxCost.Sign() == 0 || t.opts.CostExponent == 0 {
+		return nil
+	}
+	exp := big.NewInt(int64(t.opts.CostExponent))
+	cost := new(big.Int)
+	for _, v := range values {
+		cost.Add(cost, new(big.Int).Exp(big.NewInt(int64(v)), exp, nil))
+	}
+	if cost.Cmp(maxCost) > 0 {
+		return fmt.Errorf("cost %s exceeds the max total cost of %s", cost, maxCost)
+	}
+	return nil
+}
+
+func (t *tally) results() [][]string {
+	results := make([][]string, len(t.votes))
+	for q, options := range t.votes {
+		results[q] = make([]string, len(options))
+		for o, v := range options {
+			results[q][o] = v.String()
+		}
+	}
+	return results
+}
+
+// compare returns the options whose votes differ. Missing questions or options count as
+// zero votes, so results only padded differently don't mismatch.
+func compare(reported, computed [][]string) []Mismatch {
+	var mismatches []Mismatch
+	for q := 0; q < len(reported) || q < len(computed); q++ {
+		r, c := row(reported, q), row(computed, q)
+		for o := 0; o < len(r) || o < len(c); o++ {
+			rv, cv := value(r, o), value(c, o)
+			if rv.Cmp(cv) != 0 {
+				mismatches = append(mismatches, Mismatch{
+					Question: q + 1,
+					Option:   o + 1,
+					Reported: rv.String(),
+					Computed: cv.String(),
+				})
+			}
+		}
+	}
+	return mismatches
+}
+
+func row(results [][]string, q int) []string {
+	if q < len(results) {
+		return results[q]
+	}
+	return nil
+}
+
+// value parses the votes of option o, an unparseable count is reported as -1
+func value(options []string, o int) *big.Int {
+	v := new(big.Int)
+	if o >= len(options) || options[o] == "" {
+		return v
+	}
+	if _, ok := v.SetString(options[o], 10); !ok {
+		return big.NewInt(-1)
+	}
+	return v
+}
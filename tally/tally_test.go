@@ -0,0 +1,192 @@
+package tally
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"gitlab.com/vocdoni/vocexplorer/mockgateway"
+	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+	"go.vocdoni.io/proto/build/go/models"
+)
+
+// envelope is a vote of the given weight, or a package that can't be decoded if votes is nil
+type envelope struct {
+	votes  []int
+	weight string
+}
+
+// newProcess returns an ended process with the given reported results and envelopes
+func newProcess(opts *models.ProcessVoteOptions, tp *models.EnvelopeType, reported [][]string, envelopes ...envelope) *mockgateway.Process {
+	p := &mockgateway.Process{
+		Process: indexertypes.Process{
+			ID:       []byte{0xa1},
+			Status:   int32(models.ProcessStatus_RESULTS),
+			Envelope: tp,
+			VoteOpts: opts,
+		},
+		Results:      reported,
+		ResultsState: "RESULTS",
+		ResultsType:  "poll-vote",
+		FinalResults: true,
+	}
+	for i, e := range envelopes {
+		pkg := []byte("not a vote")
+		if e.votes != nil {
+			pkg, _ = json.Marshal(indexertypes.VotePackage{Votes: e.votes})
+		}
+		p.Envelopes = append(p.Envelopes, &indexertypes.EnvelopePackage{
+			Meta:        indexertypes.EnvelopeMetadata{ProcessId: p.ID, Nullifier: []byte{byte(i + 1)}},
+			VotePackage: pkg,
+			Weight:      e.weight,
+		})
+	}
+	return p
+}
+
+func TestVerify(t *testing.T) {
+	gw, cli := mockgateway.Start(t, nil)
+	poll := &models.ProcessVoteOptions{MaxCount: 2, MaxValue: 2}
+	for _, tc := range []struct {
+		name     string
+		process  *mockgateway.Process
+		status   string
+		computed [][]string
+		counted  int
+		invalid  int
+	}{
+		{
+			name: "match",
+			process: newProcess(poll, nil, [][]string{{"1", "1", "0"}, {"0", "1", "1"}},
+				envelope{[]int{0, 1}, "1"}, envelope{[]int{1, 2}, "1"}),
+			status:   StatusMatch,
+			computed: [][]string{{"1", "1", "0"}, {"0", "1", "1"}},
+			counted:  2,
+		},
+		{
+			name: "padded results",
+			process: newProcess(poll, nil, [][]string{{"1"}, {"1", "0"}},
+				envelope{[]int{0, 0}, ""}),
+			status:   StatusMatch,
+			computed: [][]string{{"1", "0", "0"}, {"1", "0", "0"}},
+			counted:  1,
+		},
+		{
+			name: "weighted",
+			process: newProcess(poll, nil, [][]string{{"3", "5"}, {"5", "0", "3"}},
+				envelope{[]int{0, 2}, "3"}, envelope{[]int{1, 0}, "5"}),
+			status:   StatusMatch,
+			computed: [][]string{{"3", "5", "0"}, {"5", "0", "3"}},
+			counted:  2,
+		},
+		{
+			name: "mismatch",
+			process: newProcess(poll, nil, [][]string{{"2"}, {"2"}},
+				envelope{[]int{0, 0}, "1"}, envelope{[]int{1, 1}, "1"}),
+			status:   StatusMismatch,
+			computed: [][]string{{"1", "1", "0"}, {"1", "1", "0"}},
+			counted:  2,
+		},
+		{
+			name: "invalid weight",
+			process: newProcess(poll, nil, [][]string{{"1"}, {"1"}},
+				envelope{[]int{0, 0}, "1"}, envelope{[]int{0, 0}, "lots"}),
+			status:   StatusMatch,
+			computed: [][]string{{"1", "0", "0"}, {"1", "0", "0"}},
+			counted:  1,
+			invalid:  1,
+		},
+		{
+			name: "out of range",
+			process: newProcess(poll, nil, nil,
+				envelope{[]int{0, 3}, "1"}, envelope{[]int{0, 0, 0}, "1"}),
+			status:   StatusMatch,
+			computed: [][]string{{"0", "0", "0"}, {"0", "0", "0"}},
+			invalid:  2,
+		},
+		{
+			name: "unique values",
+			process: newProcess(poll, &models.EnvelopeType{UniqueValues: true}, [][]string{{"0", "1"}, {"1"}},
+				envelope{[]int{1, 0}, "1"}, envelope{[]int{2, 2}, "1"}),
+			status:   StatusMatch,
+			computed: [][]string{{"0", "1", "0"}, {"1", "0", "0"}},
+			counted:  1,
+			invalid:  1,
+		},
+		{
+			name: "max total cost",
+			process: newProcess(&models.ProcessVoteOptions{MaxCount: 2, MaxValue: 3, MaxTotalCost: 5, CostExponent: 2},
+				nil, [][]string{{"0", "1"}, {"0", "0", "1"}},
+				envelope{[]int{1, 2}, "1"}, envelope{[]int{2, 2}, "1"}),
+			status:   StatusMatch,
+			computed: [][]string{{"0", "1", "0", "0"}, {"0", "0", "1", "0"}},
+			counted:  1,
+			invalid:  1,
+		},
+		{
+			name: "cost from weight",
+			process: newProcess(&models.ProcessVoteOptions{MaxCount: 1, MaxValue: 3, CostExponent: 2},
+				&models.EnvelopeType{CostFromWeight: true}, [][]string{{"0", "0", "4"}},
+				envelope{[]int{2}, "4"}, envelope{[]int{3}, "8"}),
+			status:   StatusMatch,
+			computed: [][]string{{"0", "0", "4", "0"}},
+			counted:  1,
+			invalid:  1,
+		},
+		{
+			name: "incomplete",
+			process: newProcess(poll, nil, [][]string{{"1"}, {"1"}},
+				envelope{[]int{0, 0}, "1"}, envelope{nil, "1"}),
+			status:   StatusIncomplete,
+			computed: [][]string{{"1", "0", "0"}, {"1", "0", "0"}},
+			counted:  1,
+		},
+	} {
+		gw.Update(func(f *mockgateway.Fixtures) { f.Processes = []*mockgateway.Process{tc.process} })
+		report, err := Verify(context.Background(), cli, []byte{0xa1})
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if report.Status != tc.status {
+			t.Errorf("%s: got status %s, want %s (mismatches %+v)", tc.name, report.Status, tc.status, report.Mismatches)
+		}
+		if !reflect.DeepEqual(report.Computed, tc.computed) {
+			t.Errorf("%s: computed %v, want %v", tc.name, report.Computed, tc.computed)
+		}
+		if report.Envelopes != len(tc.process.Envelopes) || report.Counted != tc.counted || report.Invalid != tc.invalid ||
+			report.Undecoded != report.Envelopes-tc.counted-tc.invalid {
+			t.Errorf("%s: got %d envelopes, %d counted, %d invalid and %d undecoded, want %d counted and %d invalid",
+				tc.name, report.Envelopes, report.Counted, report.Invalid, report.Undecoded, tc.counted, tc.invalid)
+		}
+		if len(report.Errors) != report.Invalid+report.Undecoded {
+			t.Errorf("%s: got %d errors for %d envelopes not counted", tc.name, len(report.Errors), report.Invalid+report.Undecoded)
+		}
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	gw, cli := mockgateway.Start(t, nil)
+	for _, tc := range []struct {
+		name    string
+		process indexertypes.Process
+	}{
+		{"not ended", indexertypes.Process{Status: int32(models.ProcessStatus_READY), VoteOpts: &models.ProcessVoteOptions{MaxCount: 1}}},
+		{"no vote options", indexertypes.Process{Status: int32(models.ProcessStatus_ENDED)}},
+		{"too many options", indexertypes.Process{Status: int32(models.ProcessStatus_ENDED),
+			VoteOpts: &models.ProcessVoteOptions{MaxCount: 100, MaxValue: 1 << 20}}},
+		{"max value overflowing", indexertypes.Process{Status: int32(models.ProcessStatus_ENDED),
+			VoteOpts: &models.ProcessVoteOptions{MaxCount: 1, MaxValue: math.MaxUint32}}},
+		{"serial", indexertypes.Process{Status: int32(models.ProcessStatus_ENDED), VoteOpts: &models.ProcessVoteOptions{MaxCount: 1},
+			Envelope: &models.EnvelopeType{Serial: true}}},
+	} {
+		process := &mockgateway.Process{Process: tc.process}
+		process.ID = []byte{0xa1}
+		gw.Update(func(f *mockgateway.Fixtures) { f.Processes = []*mockgateway.Process{process} })
+		if _, err := Verify(context.Background(), cli, []byte{0xa1}); err == nil {
+			t.Errorf("%s: verified", tc.name)
+		}
+	}
+}
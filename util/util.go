@@ -132,7 +132,7 @@ func TrimSlice(slice []string, lim int, page *int) []string {
 	return slice[start:end]
 }
 
-//TrimHex removes the hex prefix from a string
+// TrimHex removes the hex prefix from a string
 func TrimHex(str string) string {
 	if strings.HasPrefix(str, "0x") || strings.HasPrefix(str, "0X") {
 		return str[2:]
@@ -140,12 +140,12 @@ func TrimHex(str string) string {
 	return str
 }
 
-//HexToString converts an array of hexbytes to a string
+// HexToString converts an array of hexbytes to a string
 func HexToString(bytes []byte) string {
 	return TrimHex(strings.ToLower(hex.EncodeToString(bytes)))
 }
 
-//StringToHex converts an array of hexbytes to a string
+// StringToHex converts an array of hexbytes to a string
 func StringToHex(hexString string) []byte {
 	bz, err := hex.DecodeString(TrimHex(hexString))
 	if err != nil {
@@ -154,6 +154,11 @@ func StringToHex(hexString string) []byte {
 	return bz
 }
 
+// DecodeHex decodes a hex string, with or without the hex prefix, returning any decoding error
+func DecodeHex(hexString string) ([]byte, error) {
+	return hex.DecodeString(TrimHex(hexString))
+}
+
 // GetTransactionType translates a raw transaction to a type string
 func GetTransactionType(raw *models.Tx) string {
 	switch raw.Payload.(type) {
@@ -0,0 +1,83 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gitlab.com/vocdoni/vocexplorer/client"
+	"go.vocdoni.io/dvote/crypto/nacl"
+	indexertypes "go.vocdoni.io/dvote/vochain/scrutinizer/indexertypes"
+)
+
+// Source is the subset of the gateway client needed to decode the vote of an envelope
+type Source interface {
+	GetEnvelope(nullifier []byte) (*indexertypes.EnvelopePackage, error)
+	GetProcessKeys(pid []byte) ([]client.Key, []client.Key, error)
+}
+
+// Decode decodes a vote package, decrypting it first with keys if it's encrypted. Keys must
+// be in the order of the envelope encryption key indexes, as votes are encrypted with each
+// key in turn; they're applied in reverse.
+func Decode(votePackage []byte, keys []string) (*indexertypes.VotePackage, error) {
+	rawVote := make([]byte, len(votePackage))
+	copy(rawVote, votePackage)
+	for i := len(keys) - 1; i >= 0; i-- {
+		priv, err := nacl.DecodePrivate(keys[i])
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode private key %d: %v", i, err)
+		}
+		if rawVote, err = priv.Decrypt(rawVote); err != nil {
+			return nil, fmt.Errorf("cannot decrypt vote with key %d: %v", i, err)
+		}
+	}
+	var vote indexertypes.VotePackage
+	if err := json.Unmarshal(rawVote, &vote); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal vote: %v", err)
+	}
+	return &vote, nil
+}
+
+// KeysFor returns the private keys with the given indexes, in the same order
+func KeysFor(indexes []uint32, privKeys []client.Key) ([]string, error) {
+	keys := make([]string, 0, len(indexes))
+	for _, idx := range indexes {
+		found := false
+		for _, k := range privKeys {
+			if k.Idx == int(idx) {
+				keys = append(keys, k.Key)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("encryption key %d not revealed", idx)
+		}
+	}
+	return keys, nil
+}
+
+// DecodeEnvelope decodes the vote of envelope, picking the keys it was encrypted with
+// from the revealed private keys of its process
+func DecodeEnvelope(envelope *indexertypes.EnvelopePackage, privKeys []client.Key) (*indexertypes.VotePackage, error) {
+	keys, err := KeysFor(envelope.EncryptionKeyIndexes, privKeys)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(envelope.VotePackage, keys)
+}
+
+// Fetch gets the envelope with the given nullifier and the keys of its process, and
+// decodes its vote
+func Fetch(src Source, nullifier []byte) (*indexertypes.VotePackage, error) {
+	envelope, err := src.GetEnvelope(nullifier)
+	if err != nil {
+		return nil, err
+	}
+	var privKeys []client.Key
+	if len(envelope.EncryptionKeyIndexes) > 0 {
+		if _, privKeys, err = src.GetProcessKeys(envelope.Meta.ProcessId); err != nil {
+			return nil, fmt.Errorf("cannot get process keys: %v", err)
+		}
+	}
+	return DecodeEnvelope(envelope, privKeys)
+}